@@ -0,0 +1,48 @@
+// Package abort lets callers discard what was written to a ParquetFile
+// instead of publishing it. Closing a writer completes its upload, so a job
+// failing half way through would otherwise leave a truncated parquet file at
+// the destination:
+//
+//	if err := pw.WriteStop(); err != nil {
+//		abort.Abort(fw, err)
+//		return err
+//	}
+//	return fw.Close()
+package abort
+
+import (
+	"errors"
+
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// ErrAborted is the cause given to the upload when Abort is called with a nil
+// error.
+var ErrAborted = errors.New("write aborted")
+
+// Aborter is implemented by writers that can discard the data written so far.
+// Abort stops the upload with err as its cause, releases the resources of the
+// writer and makes sure nothing is visible at the destination. Writes after
+// Abort fail, and Abort has no effect once Close has returned.
+type Aborter interface {
+	Abort(err error) error
+}
+
+// Abort aborts file if it implements Aborter. Other files are left untouched,
+// they still have to be closed, and an error matching
+// sourceerrors.ErrNotSupported is returned.
+func Abort(file source.ParquetFile, err error) error {
+	if a, ok := file.(Aborter); ok {
+		return a.Abort(err)
+	}
+	return sourceerrors.Wrap(sourceerrors.ErrNotSupported, errors.New("file does not support Abort()"))
+}
+
+// Cause returns err, or ErrAborted if err is nil.
+func Cause(err error) error {
+	if err == nil {
+		return ErrAborted
+	}
+	return err
+}
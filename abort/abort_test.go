@@ -0,0 +1,56 @@
+package abort_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/abort"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"github.com/xitongsys/parquet-go-source/local"
+)
+
+func TestAbort(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "file.parquet")
+	w, err := local.NewLocalFileWriter(name)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if _, err = w.Write([]byte("PAR1")); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	if err = abort.Abort(w, nil); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if _, err = os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("expected the file to be removed but got %v", err)
+	}
+}
+
+func TestAbortAfterClose(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "file.parquet")
+	w, err := local.NewLocalFileWriter(name)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	if err = abort.Abort(w, nil); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if _, err = os.Stat(name); err != nil {
+		t.Errorf("expected the closed file to be kept but got %q", err.Error())
+	}
+}
+
+func TestAbortNotSupported(t *testing.T) {
+	err := abort.Abort(buffer.NewBufferFile(), nil)
+	if !errors.Is(err, sourceerrors.ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported but got %v", err)
+	}
+}
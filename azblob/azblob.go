@@ -3,12 +3,21 @@ package azblob
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+	"github.com/xitongsys/parquet-go-source/abort"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"github.com/xitongsys/parquet-go-source/footer"
+	"github.com/xitongsys/parquet-go-source/stream"
 	"github.com/xitongsys/parquet-go/source"
 )
 
@@ -17,15 +26,85 @@ type AzBlockBlob struct {
 	ctx             context.Context
 	URL             *url.URL
 	blockBlobClient *blockblob.Client
+	// serviceClient addresses the other blobs of the storage account, if known
+	serviceClient *service.Client
 
 	// write-related fields
-	writeDone  chan error
-	pipeReader *io.PipeReader
-	pipeWriter *io.PipeWriter
+	writeDone    chan error
+	cancel       context.CancelFunc
+	pipeReader   *io.PipeReader
+	pipeWriter   *io.PipeWriter
+	writerParams AzBlobFileWriterParams
+	versionID    string
+	// abortErr is the cause given to Abort
+	abortErr error
+	// closed is set for writers once Close or Abort is called
+	closed bool
 
 	// read-related fields
 	fileSize int64
 	offset   int64
+	// stream keeps a response open across sequential reads
+	stream      stream.Reader
+	etag        string
+	footerCache *footer.Cache
+	footer      *footer.Tail
+}
+
+// AzBlobFileReaderParams contains fields used to initialize and configure an AzBlockBlob reader
+type AzBlobFileReaderParams struct {
+	// ServiceClient is used by Open to read other blobs of the storage account.
+	// Without it Open only reads the blob of the client. Optional.
+	ServiceClient *service.Client
+	// MinRequestSize is the minimum amount of data requested from the blob at a
+	// time, see package stream. Defaults to the rest of the blob. Optional.
+	MinRequestSize int
+	// FooterCache, if set, makes the reader fetch the end of the blob in a single
+	// request when it is opened and serve the parquet footer from memory, sharing it
+	// with all readers created through Open. Optional.
+	FooterCache *footer.Cache
+}
+
+// AzBlobFileWriterParams contains fields used to configure an AzBlockBlob
+// writer. They map onto blockblob.UploadStreamOptions.
+type AzBlobFileWriterParams struct {
+	// BlobType is the type of the blob written: blob.BlobTypeBlockBlob (the
+	// default), blob.BlobTypeAppendBlob or blob.BlobTypePageBlob. Append and page
+	// blobs are created as soon as the writer is created and grow as data is
+	// written, and a failed upload or Abort deletes them. They must not exist yet
+	// unless AccessConditions is set: an append or page blob allowed to replace an
+	// existing blob destroys its data at once, and nothing is left if the upload
+	// then fails. Page blobs are padded with zeros to a multiple of 512 bytes, and
+	// the length of the data is stored in their metadata so that readers of this
+	// package ignore the padding. Append and page blobs require a ServiceClient.
+	// Optional.
+	BlobType blob.BlobType
+	// ServiceClient is used by Create to write other blobs of the storage
+	// account. Without it Create only writes the blob of the client. Optional.
+	ServiceClient *service.Client
+	// BlockSize is the size of the blocks staged by the upload of a block blob.
+	// Each concurrent upload buffers a block. Defaults to 1 MiB, and smaller
+	// sizes are raised to it. Optional.
+	BlockSize int64
+	// Concurrency is the number of blocks staged in parallel. Defaults to 1.
+	// Optional.
+	Concurrency int
+	// AccessTier of a block blob. Optional.
+	AccessTier *blob.AccessTier
+	// HTTPHeaders of the blob, such as its content type. Optional.
+	HTTPHeaders *blob.HTTPHeaders
+	// Metadata of the blob. Optional.
+	Metadata map[string]*string
+	// Tags of the blob. Optional.
+	Tags map[string]string
+	// AccessConditions must hold when the block list is committed, e.g. an
+	// IfNoneMatch of azcore.ETagAny to never replace an existing blob. For append
+	// and page blobs they apply to the creation of the blob, and default to an
+	// IfNoneMatch of azcore.ETagAny. Optional.
+	AccessConditions *blob.AccessConditions
+	// CPKInfo and CPKScopeInfo select the encryption key of the blob. Optional.
+	CPKInfo      *blob.CPKInfo
+	CPKScopeInfo *blob.CPKScopeInfo
 }
 
 var (
@@ -33,48 +112,46 @@ var (
 	errInvalidOffset  = errors.New("Seek: invalid offset")
 	errReadNotOpened  = errors.New("Read: url not opened")
 	errWriteNotOpened = errors.New("Write url not opened")
+	errNoService      = errors.New("Open: no service client to address other blobs")
+	errOtherAccount   = errors.New("Open: blob of another storage account")
 )
 
 // NewAzBlobFileWriter creates an Azure Blob FileWriter, to be used with NewParquetWriter
 func NewAzBlobFileWriter(ctx context.Context, URL string, credential azcore.TokenCredential, clientOptions blockblob.ClientOptions) (source.ParquetFile, error) {
-	var err error
-	var client *blockblob.Client
-	if credential == nil {
-		client, err = blockblob.NewClientWithNoCredential(URL, &clientOptions)
-	} else {
-		client, err = blockblob.NewClient(URL, credential, &clientOptions)
-	}
+	client, serviceClient, err := newClients(URL, credential, clientOptions)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewAzBlobFileWriterWithClient(ctx, URL, client)
+	return NewAzBlobFileWriterWithParams(ctx, URL, client, AzBlobFileWriterParams{ServiceClient: serviceClient})
 }
 
 // NewAzBlobFileWriterWithSharedKey creates an Azure Blob FileWriter, to be used with NewParquetWriter
 func NewAzBlobFileWriterWithSharedKey(ctx context.Context, URL string, credential *blob.SharedKeyCredential, clientOptions blockblob.ClientOptions) (source.ParquetFile, error) {
-	var err error
-	var client *blockblob.Client
-	if credential == nil {
-		client, err = blockblob.NewClientWithNoCredential(URL, &clientOptions)
-	} else {
-		client, err = blockblob.NewClientWithSharedKeyCredential(URL, credential, &clientOptions)
-	}
+	client, serviceClient, err := newSharedKeyClients(URL, credential, clientOptions)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewAzBlobFileWriterWithClient(ctx, URL, client)
+	return NewAzBlobFileWriterWithParams(ctx, URL, client, AzBlobFileWriterParams{ServiceClient: serviceClient})
 }
 
 // NewAzBlobFileWriterWithClient creates an Azure Blob FileWriter, to be used with NewParquetWriter
 func NewAzBlobFileWriterWithClient(ctx context.Context, URL string, client *blockblob.Client) (source.ParquetFile, error) {
+	return NewAzBlobFileWriterWithParams(ctx, URL, client, AzBlobFileWriterParams{})
+}
+
+// NewAzBlobFileWriterWithParams creates an Azure Blob FileWriter with the given params, to be used with NewParquetWriter.
+// Writers created with Create share them.
+func NewAzBlobFileWriterWithParams(ctx context.Context, URL string, client *blockblob.Client, params AzBlobFileWriterParams) (source.ParquetFile, error) {
 	if client == nil {
 		return nil, errors.New("client cannot be nil")
 	}
 	file := &AzBlockBlob{
 		ctx:             ctx,
 		blockBlobClient: client,
+		serviceClient:   params.ServiceClient,
+		writerParams:    params,
 	}
 
 	return file.Create(URL)
@@ -82,111 +159,105 @@ func NewAzBlobFileWriterWithClient(ctx context.Context, URL string, client *bloc
 
 // NewAzBlobFileReader creates an Azure Blob FileReader, to be used with NewParquetReader
 func NewAzBlobFileReader(ctx context.Context, URL string, credential azcore.TokenCredential, clientOptions blockblob.ClientOptions) (source.ParquetFile, error) {
-	var err error
-	var client *blockblob.Client
-	if credential == nil {
-		client, err = blockblob.NewClientWithNoCredential(URL, &clientOptions)
-	} else {
-		client, err = blockblob.NewClient(URL, credential, &clientOptions)
-	}
+	client, serviceClient, err := newClients(URL, credential, clientOptions)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewAzBlobFileReaderWithClient(ctx, URL, client)
+	return NewAzBlobFileReaderWithParams(ctx, URL, client, AzBlobFileReaderParams{ServiceClient: serviceClient})
 }
 
 // NewAzBlobFileReaderWithSharedKey creates an Azure Blob FileReader, to be used with NewParquetReader
 func NewAzBlobFileReaderWithSharedKey(ctx context.Context, URL string, credential *blob.SharedKeyCredential, clientOptions blockblob.ClientOptions) (source.ParquetFile, error) {
-	var err error
-	var client *blockblob.Client
-	if credential == nil {
-		client, err = blockblob.NewClientWithNoCredential(URL, &clientOptions)
-	} else {
-		client, err = blockblob.NewClientWithSharedKeyCredential(URL, credential, &clientOptions)
-	}
+	client, serviceClient, err := newSharedKeyClients(URL, credential, clientOptions)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewAzBlobFileReaderWithClient(ctx, URL, client)
+	return NewAzBlobFileReaderWithParams(ctx, URL, client, AzBlobFileReaderParams{ServiceClient: serviceClient})
 }
 
 // NewAzBlobFileReaderWithClient creates an Azure Blob FileReader, to be used with NewParquetReader
 func NewAzBlobFileReaderWithClient(ctx context.Context, URL string, client *blockblob.Client) (source.ParquetFile, error) {
+	return NewAzBlobFileReaderWithParams(ctx, URL, client, AzBlobFileReaderParams{})
+}
+
+// NewAzBlobFileReaderWithParams creates an Azure Blob FileReader with the given params, to be used with NewParquetReader
+func NewAzBlobFileReaderWithParams(ctx context.Context, URL string, client *blockblob.Client, params AzBlobFileReaderParams) (source.ParquetFile, error) {
 	if client == nil {
 		return nil, errors.New("client cannot be nil")
 	}
 	file := &AzBlockBlob{
 		ctx:             ctx,
 		blockBlobClient: client,
+		serviceClient:   params.ServiceClient,
+		stream:          stream.Reader{MinRequestSize: int64(params.MinRequestSize)},
+		footerCache:     params.FooterCache,
 	}
 
 	return file.Open(URL)
 }
 
-// Seek tracks the offset for the next Read. Has no effect on Write.
+// Seek tracks the offset for the next Read. Has no effect on Write. Seeking
+// past the end is allowed, the next Read returns io.EOF. The response being
+// read is kept unless the offset changes.
 func (s *AzBlockBlob) Seek(offset int64, whence int) (int64, error) {
 	if whence < io.SeekStart || whence > io.SeekEnd {
 		return 0, errWhence
 	}
 
 	switch whence {
-	case io.SeekStart:
-		offset = offset
 	case io.SeekCurrent:
 		offset = s.offset + offset
 	case io.SeekEnd:
 		offset = s.fileSize + offset
 	}
 
-	if offset < 0 || offset > s.fileSize {
+	if offset < 0 {
 		return 0, errInvalidOffset
 	}
 
+	if offset != s.offset {
+		s.stream.Close()
+	}
 	s.offset = offset
 
 	return s.offset, nil
 }
 
-// Read up to len(p) bytes into p and return the number of bytes read
+// Read up to len(p) bytes into p and return the number of bytes read. p is
+// filled completely unless the end of the blob is reached. Sequential reads
+// share a response of at least MinRequestSize bytes.
 func (s *AzBlockBlob) Read(p []byte) (n int, err error) {
 	if s.blockBlobClient == nil {
 		return 0, errReadNotOpened
 	}
 
-	if s.fileSize > 0 && s.offset >= s.fileSize {
+	if s.offset >= s.fileSize {
 		return 0, io.EOF
 	}
 
-	count := int64(len(p))
-	resp, err := s.blockBlobClient.DownloadStream(s.ctx, &blob.DownloadStreamOptions{
-		Range: blob.HTTPRange{
-			Offset: s.offset,
-			Count:  count,
-		},
-	})
-	if err != nil {
-		return 0, err
-	}
-	if s.fileSize < 0 {
-		s.fileSize = *resp.ContentLength
+	if n, ok := s.footer.ReadAt(p, s.offset); ok {
+		s.stream.Close()
+		s.offset += int64(n)
+		return n, nil
 	}
 
-	toRead := s.fileSize - s.offset
-	if toRead > count {
-		toRead = count
+	n, err = s.stream.Read(p, s.offset, s.fileSize, s.openRange)
+	s.offset += int64(n)
+	if err != nil && err != io.EOF {
+		err = s.wrapError(err)
 	}
+	return n, err
+}
 
-	body := resp.Body
-	bytesRead, err := io.ReadFull(body, p[:toRead])
+// openRange issues a download request for the stream.
+func (s *AzBlockBlob) openRange(offset, length int64) (io.ReadCloser, error) {
+	resp, err := s.blockBlobClient.DownloadStream(s.ctx, s.downloadOptions(offset, length))
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-
-	s.offset += int64(bytesRead)
-
-	return bytesRead, nil
+	return resp.Body, nil
 }
 
 // Write len(p) bytes from p
@@ -198,7 +269,7 @@ func (s *AzBlockBlob) Write(p []byte) (n int, err error) {
 	bytesWritten, writeError := s.pipeWriter.Write(p)
 	if writeError != nil {
 		s.pipeWriter.CloseWithError(err)
-		return 0, writeError
+		return 0, s.wrapError(writeError)
 	}
 
 	return bytesWritten, nil
@@ -209,77 +280,383 @@ func (s *AzBlockBlob) Write(p []byte) (n int, err error) {
 func (s *AzBlockBlob) Close() error {
 	var err error
 
+	s.stream.Close()
+	if s.abortErr != nil {
+		return s.abortErr
+	}
+
 	if s.pipeWriter != nil {
+		s.closed = true
 		if err = s.pipeWriter.Close(); err != nil {
-			return err
+			return s.wrapError(err)
 		}
 
 		// wait for pending uploads
 		err = <-s.writeDone
+		s.cancel()
 	}
 
-	return err
+	return s.wrapError(err)
 }
 
-// Open creates a new block blob to perform reads
-func (s *AzBlockBlob) Open(URL string) (source.ParquetFile, error) {
-	var u *url.URL
-	if len(URL) == 0 && s.URL != nil {
-		// ColumnBuffer passes in an empty string for name
-		u = s.URL
-	} else {
-		var err error
-		if u, err = url.Parse(URL); err != nil {
-			return s, err
-		}
+// Abort discards the data written so far instead of publishing it. The upload
+// is cancelled before the block list is committed, so the blob is left as it
+// was and the staged blocks are garbage collected by the service. Append and
+// page blobs are deleted instead, along with the data of any blob they replaced,
+// see BlobType, and Abort returns the error of the delete. Close then returns
+// err. Abort has no effect once Close has returned.
+func (s *AzBlockBlob) Abort(err error) error {
+	if s.pipeWriter == nil || s.closed {
+		return nil
+	}
+	s.closed = true
+	s.abortErr = abort.Cause(err)
+
+	s.pipeWriter.CloseWithError(s.abortErr)
+	s.cancel()
+	var discardErr *discardError
+	if errors.As(<-s.writeDone, &discardErr) {
+		return discardErr.deleteErr
+	}
+	return nil
+}
+
+// Identity names the blob and the version being read, e.g. for use as a
+// cache key. It is empty until the blob is opened for reading.
+func (s *AzBlockBlob) Identity() string {
+	if s.etag == "" || s.blockBlobClient == nil {
+		return ""
+	}
+	return s.blobName() + "#" + s.etag
+}
+
+// ETag returns the ETag of the blob being read, or of the blob written once
+// Close has returned.
+func (s *AzBlockBlob) ETag() string {
+	return s.etag
+}
+
+// VersionID returns the version of the blob written once Close has returned.
+// It is empty unless versioning is enabled on the storage account.
+func (s *AzBlockBlob) VersionID() string {
+	return s.versionID
+}
+
+// blobName returns the URL of the blob without SAS tokens.
+func (s *AzBlockBlob) blobName() string {
+	u, err := url.Parse(s.blockBlobClient.URL())
+	if err != nil {
+		return ""
 	}
-	fileSize := int64(-1)
-	props, err := s.blockBlobClient.GetProperties(s.ctx, nil)
+	u.RawQuery = ""
+	return u.String()
+}
+
+// Open creates a new block blob to perform reads. URL is either empty for the
+// blob of s, the name of a blob in the same container or the URL of a blob in
+// the same storage account.
+func (s *AzBlockBlob) Open(URL string) (source.ParquetFile, error) {
+	u, client, err := s.resolve(URL)
 	if err != nil {
 		return &AzBlockBlob{}, err
 	}
-	fileSize = *props.ContentLength
+
+	// clones read the version and share the footer of an opened blob
+	if len(URL) == 0 && s.etag != "" {
+		return &AzBlockBlob{
+			ctx:             s.ctx,
+			URL:             u,
+			blockBlobClient: client,
+			serviceClient:   s.serviceClient,
+			fileSize:        s.fileSize,
+			stream:          stream.Reader{MinRequestSize: s.stream.MinRequestSize},
+			etag:            s.etag,
+			footerCache:     s.footerCache,
+			footer:          s.footer,
+		}, nil
+	}
 
 	pf := &AzBlockBlob{
 		ctx:             s.ctx,
 		URL:             u,
-		blockBlobClient: s.blockBlobClient,
-		fileSize:        fileSize,
+		blockBlobClient: client,
+		serviceClient:   s.serviceClient,
+		stream:          stream.Reader{MinRequestSize: s.stream.MinRequestSize},
+		footerCache:     s.footerCache,
+	}
+	props, err := client.GetProperties(s.ctx, nil)
+	if err != nil {
+		return &AzBlockBlob{}, pf.wrapError(err)
+	}
+	pf.fileSize = *props.ContentLength
+	if length, ok := pageBlobLength(props); ok {
+		pf.fileSize = length
+	}
+	if props.ETag != nil {
+		pf.etag = string(*props.ETag)
+	}
+	if err := pf.loadFooter(); err != nil {
+		return &AzBlockBlob{}, err
 	}
 
 	return pf, nil
 }
 
-// Create a new blob url to perform writes
-func (s *AzBlockBlob) Create(URL string) (source.ParquetFile, error) {
-	var u *url.URL
-	if len(URL) == 0 && s.URL != nil {
-		// ColumnBuffer passes in an empty string for name
-		u = s.URL
-	} else {
-		var err error
-		if u, err = url.Parse(URL); err != nil {
-			return s, err
+// loadFooter fetches the end of the blob through the footer cache, if one
+// is configured.
+func (s *AzBlockBlob) loadFooter() error {
+	if s.footerCache == nil || s.fileSize < 1 {
+		return nil
+	}
+
+	tail, err := s.footerCache.Get(footer.Key{
+		Backend: "azblob",
+		Name:    s.blobName(),
+		Version: s.etag,
+		Size:    s.fileSize,
+	}, s.fetchRange)
+	if err != nil {
+		return err
+	}
+	s.footer = tail
+	return nil
+}
+
+// fetchRange reads length bytes at offset with a single download request.
+func (s *AzBlockBlob) fetchRange(offset, length int64) ([]byte, error) {
+	resp, err := s.blockBlobClient.DownloadStream(s.ctx, s.downloadOptions(offset, length))
+	if err != nil {
+		return nil, s.wrapError(err)
+	}
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// downloadOptions returns the options to download count bytes at offset from
+// the version of the blob seen when it was opened.
+func (s *AzBlockBlob) downloadOptions(offset, count int64) *blob.DownloadStreamOptions {
+	options := &blob.DownloadStreamOptions{
+		Range: blob.HTTPRange{
+			Offset: offset,
+			Count:  count,
+		},
+	}
+	if s.etag != "" {
+		etag := azcore.ETag(s.etag)
+		options.AccessConditions = &blob.AccessConditions{
+			ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfMatch: &etag},
+		}
+	}
+	return options
+}
+
+// wrapError returns an ObjectChangedError if err reports that the blob no
+// longer matches the ETag seen when it was opened, and otherwise annotates err
+// with its kind from sourceerrors.
+func (s *AzBlockBlob) wrapError(err error) error {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return sourceerrors.Classify(err)
+	}
+	if respErr.StatusCode == http.StatusPreconditionFailed && s.etag != "" {
+		return &sourceerrors.ObjectChangedError{
+			Name:    s.blobName(),
+			Version: s.etag,
+			Err:     err,
 		}
 	}
+	if kind := sourceerrors.KindOfCode(respErr.ErrorCode); kind != nil {
+		return sourceerrors.Wrap(kind, err)
+	}
+	return sourceerrors.Wrap(sourceerrors.KindOfStatus(respErr.StatusCode), err)
+}
+
+// Create a new blob url to perform writes. URL is resolved as by Open.
+func (s *AzBlockBlob) Create(URL string) (source.ParquetFile, error) {
+	u, client, err := s.resolve(URL)
+	if err != nil {
+		return s, err
+	}
+	if blobType := s.writerParams.BlobType; blobType != "" && blobType != blob.BlobTypeBlockBlob && s.serviceClient == nil {
+		return s, sourceerrors.Wrap(sourceerrors.ErrNotSupported, fmt.Errorf("Create: %s needs a service client", blobType))
+	}
 
 	pf := &AzBlockBlob{
 		ctx:             s.ctx,
 		URL:             u,
-		blockBlobClient: s.blockBlobClient,
+		blockBlobClient: client,
+		serviceClient:   s.serviceClient,
 		writeDone:       make(chan error),
+		writerParams:    s.writerParams,
 	}
 
 	pf.pipeReader, pf.pipeWriter = io.Pipe()
+	ctx, cancel := context.WithCancel(pf.ctx)
+	pf.cancel = cancel
+
+	go pf.upload(ctx)
 
-	go func(ctx context.Context, blobURL *blockblob.Client, reader io.Reader, readerPipeSource *io.PipeWriter, done chan error) {
-		defer close(done)
+	return pf, nil
+}
+
+// upload uploads the data written to the pipe and signals done when complete.
+// The ETag and version of the blob are recorded before Close returns.
+func (s *AzBlockBlob) upload(ctx context.Context) {
+	defer close(s.writeDone)
 
-		// upload data and signal done when complete
-		_, err := blobURL.UploadStream(ctx, reader, &blockblob.UploadStreamOptions{})
+	var err error
+	switch s.writerParams.BlobType {
+	case blob.BlobTypeAppendBlob:
+		err = s.uploadAppendBlob(ctx)
+	case blob.BlobTypePageBlob:
+		err = s.uploadPageBlob(ctx)
+	default:
+		err = s.uploadBlockBlob(ctx)
+	}
+	if err != nil {
+		// unblock pending writes
+		s.pipeReader.CloseWithError(err)
+	}
 
-		done <- err
-	}(pf.ctx, pf.blockBlobClient, pf.pipeReader, pf.pipeWriter, pf.writeDone)
+	s.writeDone <- err
+}
 
-	return pf, nil
+// uploadBlockBlob stages the data written as blocks and commits them once the
+// pipe is closed.
+func (s *AzBlockBlob) uploadBlockBlob(ctx context.Context) error {
+	params := s.writerParams
+	resp, err := s.blockBlobClient.UploadStream(ctx, s.pipeReader, &blockblob.UploadStreamOptions{
+		BlockSize:        params.BlockSize,
+		Concurrency:      params.Concurrency,
+		HTTPHeaders:      params.HTTPHeaders,
+		Metadata:         params.Metadata,
+		AccessConditions: params.AccessConditions,
+		AccessTier:       params.AccessTier,
+		Tags:             params.Tags,
+		CPKInfo:          params.CPKInfo,
+		CPKScopeInfo:     params.CPKScopeInfo,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.setVersion(resp.ETag, resp.VersionID)
+	return nil
+}
+
+// setVersion records the ETag and version of the blob written.
+func (s *AzBlockBlob) setVersion(etag *azcore.ETag, versionID *string) {
+	if etag != nil {
+		s.etag = string(*etag)
+	}
+	if versionID != nil {
+		s.versionID = *versionID
+	}
+}
+
+// resolve returns the URL and the client of the blob addressed by name: the
+// blob of s if name is empty, a blob of the same container if name is a blob
+// name, or a blob of the same storage account if name is a URL. Blob names are
+// used as they are, only URLs are unescaped.
+func (s *AzBlockBlob) resolve(name string) (*url.URL, *blockblob.Client, error) {
+	current, err := blob.ParseURL(s.blockBlobClient.URL())
+	if err != nil {
+		return nil, nil, err
+	}
+	if name == "" {
+		// ColumnBuffer passes in an empty string for name
+		u := s.URL
+		if u == nil {
+			u, err = url.Parse(s.blockBlobClient.URL())
+		}
+		return u, s.blockBlobClient, err
+	}
+
+	var u *url.URL
+	target := current
+	if strings.Contains(name, "://") {
+		if u, err = url.Parse(name); err != nil {
+			return nil, nil, err
+		}
+		if target, err = blob.ParseURL(name); err != nil {
+			return nil, nil, err
+		}
+		// emulator URLs name the account in their first path segment
+		if target.Host != current.Host || target.IPEndpointStyleInfo != current.IPEndpointStyleInfo {
+			return nil, nil, sourceerrors.Wrap(sourceerrors.ErrNotSupported, errOtherAccount)
+		}
+	} else {
+		target.BlobName = name
+		u, _ = url.Parse(current.String())
+		u.Path = strings.TrimSuffix(u.Path, current.BlobName) + name
+	}
+
+	if target.ContainerName == current.ContainerName && target.BlobName == current.BlobName {
+		return u, s.blockBlobClient, nil
+	}
+	if s.serviceClient == nil {
+		return nil, nil, sourceerrors.Wrap(sourceerrors.ErrNotSupported, errNoService)
+	}
+	return u, s.serviceClient.NewContainerClient(target.ContainerName).NewBlockBlobClient(target.BlobName), nil
+}
+
+// newClients creates the client of the blob at URL and the client of its
+// storage account, authenticated with credential if it is not nil.
+func newClients(URL string, credential azcore.TokenCredential, clientOptions blockblob.ClientOptions) (*blockblob.Client, *service.Client, error) {
+	serviceURL, err := serviceURL(URL)
+	if err != nil {
+		return nil, nil, err
+	}
+	serviceOptions := service.ClientOptions(clientOptions)
+
+	if credential == nil {
+		client, err := blockblob.NewClientWithNoCredential(URL, &clientOptions)
+		if err != nil {
+			return nil, nil, err
+		}
+		serviceClient, err := service.NewClientWithNoCredential(serviceURL, &serviceOptions)
+		return client, serviceClient, err
+	}
+
+	client, err := blockblob.NewClient(URL, credential, &clientOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+	serviceClient, err := service.NewClient(serviceURL, credential, &serviceOptions)
+	return client, serviceClient, err
+}
+
+// newSharedKeyClients is the same as newClients for a shared key.
+func newSharedKeyClients(URL string, credential *blob.SharedKeyCredential, clientOptions blockblob.ClientOptions) (*blockblob.Client, *service.Client, error) {
+	if credential == nil {
+		return newClients(URL, nil, clientOptions)
+	}
+
+	serviceURL, err := serviceURL(URL)
+	if err != nil {
+		return nil, nil, err
+	}
+	serviceOptions := service.ClientOptions(clientOptions)
+
+	client, err := blockblob.NewClientWithSharedKeyCredential(URL, credential, &clientOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+	serviceClient, err := service.NewClientWithSharedKeyCredential(serviceURL, credential, &serviceOptions)
+	return client, serviceClient, err
+}
+
+// serviceURL returns the URL of the storage account of the blob at URL,
+// keeping its SAS token.
+func serviceURL(URL string) (string, error) {
+	parts, err := blob.ParseURL(URL)
+	if err != nil {
+		return "", err
+	}
+	parts.ContainerName = ""
+	parts.BlobName = ""
+	parts.Snapshot = ""
+	parts.VersionID = ""
+	return parts.String(), nil
 }
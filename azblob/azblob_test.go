@@ -1,16 +1,25 @@
 package azblob
 
 import (
+	"bytes"
 	"context"
 	"errors"
-	"net"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"strings"
 	"testing"
-	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+	"github.com/xitongsys/parquet-go-source/abort"
+	"github.com/xitongsys/parquet-go-source/azblobfake"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"github.com/xitongsys/parquet-go/source"
 )
 
 type ErrorMatcher struct {
@@ -23,18 +32,17 @@ func (em ErrorMatcher) String() string {
 }
 
 type testCase struct {
-	url string
-	err *ErrorMatcher
+	blob string
+	err  *ErrorMatcher
 }
 
 var testCases []testCase = []testCase{
 	{
-		// Public accessible data: https://azure.microsoft.com/en-us/services/open-datasets/catalog/
-		url: "https://azureopendatastorage.blob.core.windows.net/censusdatacontainer/release/us_population_zip/year=2010/part-00178-tid-5434563040420806442-84b5e4ab-8ab1-4e28-beb1-81caf32ca312-1919656.c000.snappy.parquet",
-		err: nil,
+		blob: "dir/file.parquet",
+		err:  nil,
 	},
 	{
-		url: "https://azureopendatastorage.blob.core.windows.net/censusdatacontainer/release/us_population_zip/",
+		blob: "dir/",
 		err: &ErrorMatcher{
 			Match: func(err error) bool {
 				return bloberror.HasCode(err, bloberror.BlobNotFound)
@@ -43,87 +51,616 @@ var testCases []testCase = []testCase{
 		},
 	},
 	{
-		// the idea is that Azure blob does now allow "-" in storage account name so there should be no such a storage account
-		url: "https://non-existent.blob.core.windows.net/container/blob",
+		blob: "missing.parquet",
 		err: &ErrorMatcher{
 			Match: func(err error) bool {
-				var dnsErr *net.DNSError
-				return errors.As(err, &dnsErr) && dnsErr.Err == "no such host"
+				return errors.Is(err, sourceerrors.ErrNotFound)
 			},
-			Desc: "no such host",
+			Desc: "ErrNotFound",
 		},
 	},
 }
 
+// newTestServer starts a fake storage account holding the blob of testCases.
+func newTestServer() *azblobfake.Server {
+	srv := azblobfake.NewServer()
+	srv.PutBlob("container", "dir/file.parquet", []byte("PAR1 data PAR1"))
+	return srv
+}
+
+var testClientOptions = blockblob.ClientOptions{
+	ClientOptions: policy.ClientOptions{
+		Retry: policy.RetryOptions{
+			MaxRetries: -1,
+		},
+	},
+}
+
+func checkOpenError(t *testing.T, tc testCase, err error) {
+	if tc.err == nil {
+		if err != nil {
+			t.Errorf("expected no error but got %s", err.Error())
+		}
+		return
+	}
+	if err == nil {
+		t.Errorf("expected [%s] error but got nil", tc.err)
+	} else if !tc.err.Match(err) {
+		t.Errorf("expected [%s] error but got: %s", tc.err, err.Error())
+	}
+}
+
 func TestOpen_NewAzBlobFileReader(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+
+	// the server accepts anonymous requests, as for a public container
 	for _, tc := range testCases {
-		_, err := NewAzBlobFileReader(context.Background(), tc.url, nil, blockblob.ClientOptions{
-			ClientOptions: policy.ClientOptions{
-				Retry: policy.RetryOptions{
-					TryTimeout: 10 * time.Second,
-					MaxRetries: 1,
-				},
-			},
+		_, err := NewAzBlobFileReader(context.Background(), srv.BlobURL("container", tc.blob), nil, testClientOptions)
+		checkOpenError(t, tc, err)
+	}
+}
+
+func TestOpen_NewAzBlobFileReaderWithSharedKey(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+
+	for _, tc := range testCases {
+		_, err := NewAzBlobFileReaderWithSharedKey(context.Background(), srv.BlobURL("container", tc.blob), srv.Credential(), testClientOptions)
+		checkOpenError(t, tc, err)
+	}
+}
+
+func TestOpen_NewAzBlobFileReaderWithClient(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+
+	for _, tc := range testCases {
+		URL := srv.BlobURL("container", tc.blob)
+		_, err := NewAzBlobFileReaderWithClient(context.Background(), URL, srv.BlockBlobClient("container", tc.blob))
+		checkOpenError(t, tc, err)
+	}
+	_, err := NewAzBlobFileReaderWithClient(context.Background(), "dummy-url", nil)
+	expected := "client cannot be nil"
+	if err == nil {
+		t.Errorf("expected [%s] but got: <nil>", expected)
+	} else if !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected [%s] error but got: %s", expected, err.Error())
+	}
+}
+
+func TestOpen_WrongSharedKey(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+
+	credential, err := blob.NewSharedKeyCredential(azblobfake.Account, "d3Jvbmcta2V5")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	_, err = NewAzBlobFileReaderWithSharedKey(context.Background(), srv.BlobURL("container", "dir/file.parquet"), credential, testClientOptions)
+	if !errors.Is(err, sourceerrors.ErrPermissionDenied) || !bloberror.HasCode(err, bloberror.AuthenticationFailed) {
+		t.Errorf("expected AuthenticationFailed but got %v", err)
+	}
+}
+
+func TestObjectChanged(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	URL := srv.BlobURL("container", "dir/file.parquet")
+	r, err := NewAzBlobFileReaderWithParams(ctx, URL, srv.BlockBlobClient("container", "dir/file.parquet"), AzBlobFileReaderParams{MinRequestSize: 4})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	b := make([]byte, 4)
+	if _, err = r.Read(b); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	opened := r.(*AzBlockBlob).ETag()
+
+	srv.PutBlob("container", "dir/file.parquet", []byte("PAR1 other data PAR1"))
+	_, err = r.Read(b)
+	var changed *sourceerrors.ObjectChangedError
+	if !errors.As(err, &changed) || changed.Version != opened {
+		t.Errorf("expected ObjectChangedError for the opened version but got %v", err)
+	}
+}
+
+// writeBlob writes data in uneven chunks through a writer with params and
+// reads it back.
+func writeBlob(t *testing.T, srv *azblobfake.Server, name string, data []byte, params AzBlobFileWriterParams) []byte {
+	ctx := context.Background()
+	URL := srv.BlobURL("container", name)
+	client := srv.BlockBlobClient("container", name)
+
+	w, err := NewAzBlobFileWriterWithParams(ctx, URL, client, params)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	for offset, size := 0, 1; offset < len(data); offset, size = offset+size, size*3 {
+		end := offset + size
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err = w.Write(data[offset:end]); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	r, err := NewAzBlobFileReaderWithClient(ctx, URL, client)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	defer r.Close()
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	return got
+}
+
+func TestBlobTypes(t *testing.T) {
+	srv := azblobfake.NewServer()
+	defer srv.Close()
+	srv.CreateContainer("container")
+
+	// larger than a single Append Block or Put Page request
+	data := make([]byte, 5<<20+1000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	for _, blobType := range []blob.BlobType{blob.BlobTypeBlockBlob, blob.BlobTypeAppendBlob, blob.BlobTypePageBlob} {
+		name := string(blobType)
+		got := writeBlob(t, srv, name, data, AzBlobFileWriterParams{
+			BlobType:      blobType,
+			ServiceClient: srv.ServiceClient(),
 		})
-		if tc.err == nil {
-			if err != nil {
-				t.Errorf("expected no error but got %s", err.Error())
-			}
-			continue
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: expected to read back %d bytes but got %d", blobType, len(data), len(got))
 		}
-		if err == nil {
-			t.Errorf("expected [%s] error but got nil", tc.err)
-		} else if !tc.err.Match(err) {
-			t.Errorf("expected [%s] error but got: %s", tc.err, err.Error())
+		stored, _ := srv.GetBlob("container", name)
+		if stored.Type != string(blobType) {
+			t.Errorf("expected a %s but got a %s", blobType, stored.Type)
 		}
 	}
+
+	// page blobs are padded to whole pages
+	stored, _ := srv.GetBlob("container", string(blob.BlobTypePageBlob))
+	if len(stored.Data)%azblobfake.PageSize != 0 {
+		t.Errorf("expected page blob to be padded but got %d bytes", len(stored.Data))
+	}
+
+	_, err := NewAzBlobFileWriterWithParams(context.Background(), srv.BlobURL("container", "append"), srv.BlockBlobClient("container", "append"), AzBlobFileWriterParams{
+		BlobType: blob.BlobTypeAppendBlob,
+	})
+	if !errors.Is(err, sourceerrors.ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported without a service client but got %v", err)
+	}
 }
 
-func TestOpen_NewAzBlobFileReaderWithSharedKey(t *testing.T) {
-	for _, tc := range testCases {
-		_, err := NewAzBlobFileReaderWithSharedKey(context.Background(), tc.url, nil, blockblob.ClientOptions{
-			ClientOptions: policy.ClientOptions{
-				Retry: policy.RetryOptions{
-					TryTimeout: 10 * time.Second,
-					MaxRetries: 1,
-				},
-			},
+func TestAbort(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	URL := srv.BlobURL("container", "dir/file.parquet")
+	w, err := NewAzBlobFileWriterWithClient(ctx, URL, srv.BlockBlobClient("container", "dir/file.parquet"))
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if _, err = w.Write([]byte("partial")); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	cause := errors.New("job failed")
+	if err = abort.Abort(w, cause); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if err = w.Close(); !errors.Is(err, cause) {
+		t.Errorf("expected Close after Abort to fail with the cause but got %v", err)
+	}
+	if b, _ := srv.GetBlob("container", "dir/file.parquet"); string(b.Data) != "PAR1 data PAR1" {
+		t.Errorf("expected the blob to be left as it was but got %q", b.Data)
+	}
+}
+
+func TestAbortAfterClose(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	ctx := context.Background()
+	URL := srv.BlobURL("container", "dir/file.parquet")
+	cause := errors.New("job failed")
+
+	// Abort has no effect on readers
+	r, err := NewAzBlobFileReaderWithClient(ctx, URL, srv.BlockBlobClient("container", "dir/file.parquet"))
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if err = abort.Abort(r, cause); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if err = r.Close(); err != nil {
+		t.Errorf("expected Close of a reader to ignore Abort but got %v", err)
+	}
+
+	// nor once Close has returned
+	w, err := NewAzBlobFileWriterWithClient(ctx, URL, srv.BlockBlobClient("container", "dir/file.parquet"))
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	w.Write([]byte("new"))
+	if err = w.Close(); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if err = abort.Abort(w, cause); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if err = w.Close(); err != nil {
+		t.Errorf("expected Close to ignore a later Abort but got %v", err)
+	}
+	if b, _ := srv.GetBlob("container", "dir/file.parquet"); string(b.Data) != "new" {
+		t.Errorf("expected the blob to be kept but got %q", b.Data)
+	}
+}
+
+func TestAppendAndPageBlobsKeepExistingBlobs(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	ctx := context.Background()
+	URL := srv.BlobURL("container", "dir/file.parquet")
+	client := srv.BlockBlobClient("container", "dir/file.parquet")
+
+	for _, blobType := range []blob.BlobType{blob.BlobTypeAppendBlob, blob.BlobTypePageBlob} {
+		w, err := NewAzBlobFileWriterWithParams(ctx, URL, client, AzBlobFileWriterParams{
+			BlobType:      blobType,
+			ServiceClient: srv.ServiceClient(),
 		})
-		if tc.err == nil {
-			if err != nil {
-				t.Errorf("expected no error but got %s", err.Error())
-			}
-			continue
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		if _, err = w.Write([]byte("data")); err == nil {
+			err = w.Close()
 		}
-		if err == nil {
-			t.Errorf("expected [%s] error but got nil", tc.err)
-		} else if !tc.err.Match(err) {
-			t.Errorf("expected [%s] error but got: %s", tc.err, err.Error())
+		if !errors.Is(err, sourceerrors.ErrPreconditionFailed) {
+			t.Errorf("%s: expected ErrPreconditionFailed but got %v", blobType, err)
 		}
+		if b, _ := srv.GetBlob("container", "dir/file.parquet"); string(b.Data) != "PAR1 data PAR1" {
+			t.Errorf("%s: expected the blob to be left as it was but got %q", blobType, b.Data)
+		}
+	}
+
+	// replacing the blob must be asked for
+	got := writeBlob(t, srv, "dir/file.parquet", []byte("new data"), AzBlobFileWriterParams{
+		BlobType:         blob.BlobTypeAppendBlob,
+		ServiceClient:    srv.ServiceClient(),
+		AccessConditions: &blob.AccessConditions{},
+	})
+	if string(got) != "new data" {
+		t.Errorf("expected the blob to be replaced but got %q", got)
 	}
 }
 
-func TestOpen_NewAzBlobFileReaderWithClient(t *testing.T) {
-	for _, tc := range testCases {
-		testClient, _ := blockblob.NewClientWithNoCredential(tc.url, &blockblob.ClientOptions{})
-		_, err := NewAzBlobFileReaderWithClient(context.Background(), tc.url, testClient)
-		if tc.err == nil {
+// failDeletes fails the Delete Blob requests of a client.
+type failDeletes struct{}
+
+var errDeleteRefused = errors.New("delete refused")
+
+func (failDeletes) Do(req *policy.Request) (*http.Response, error) {
+	if req.Raw().Method == http.MethodDelete {
+		return nil, errDeleteRefused
+	}
+	return req.Next()
+}
+
+func TestAbortAppendAndPageBlobs(t *testing.T) {
+	srv := azblobfake.NewServer()
+	defer srv.Close()
+	srv.CreateContainer("container")
+	ctx := context.Background()
+
+	failingClient, err := service.NewClientWithSharedKeyCredential(srv.URL+"/", srv.Credential(), &service.ClientOptions{
+		ClientOptions: policy.ClientOptions{
+			PerCallPolicies: []policy.Policy{failDeletes{}},
+			Retry:           policy.RetryOptions{MaxRetries: -1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	for _, blobType := range []blob.BlobType{blob.BlobTypeAppendBlob, blob.BlobTypePageBlob} {
+		for _, serviceClient := range []*service.Client{srv.ServiceClient(), failingClient} {
+			name := string(blobType)
+			w, err := NewAzBlobFileWriterWithParams(ctx, srv.BlobURL("container", name), srv.BlockBlobClient("container", name), AzBlobFileWriterParams{
+				BlobType:      blobType,
+				ServiceClient: serviceClient,
+			})
 			if err != nil {
-				t.Errorf("expected no error but got %s", err.Error())
+				t.Fatalf("expected error to be nil but got %q", err.Error())
+			}
+			// the blob is created before the first write returns
+			if _, err = w.Write([]byte("partial")); err != nil {
+				t.Fatalf("expected error to be nil but got %q", err.Error())
 			}
+
+			cause := errors.New("job failed")
+			err = abort.Abort(w, cause)
+			_, exists := srv.GetBlob("container", name)
+			if serviceClient == failingClient {
+				if !errors.Is(err, errDeleteRefused) || !exists {
+					t.Errorf("%s: expected Abort to return the error of the delete but got %v", blobType, err)
+				}
+			} else if err != nil || exists {
+				t.Errorf("%s: expected Abort to delete the blob but got %v", blobType, err)
+			}
+			if err = w.Close(); !errors.Is(err, cause) {
+				t.Errorf("%s: expected Close after Abort to fail with the cause but got %v", blobType, err)
+			}
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	srv := azblobfake.NewServer()
+	defer srv.Close()
+	blobs := map[string]string{
+		"dir/file.parquet":  "file",
+		"dir/other.parquet": "other",
+		"dir/a%20b.parquet": "escaped",
+		"dir/100%.parquet":  "percent",
+	}
+	for name, data := range blobs {
+		srv.PutBlob("container", name, []byte(data))
+	}
+	srv.PutBlob("other", "dir/file.parquet", []byte("other container"))
+	ctx := context.Background()
+
+	r, err := NewAzBlobFileReaderWithParams(ctx, srv.BlobURL("container", "dir/file.parquet"), srv.BlockBlobClient("container", "dir/file.parquet"), AzBlobFileReaderParams{
+		ServiceClient: srv.ServiceClient(),
+	})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"", "file"},
+		{"dir/other.parquet", "other"},
+		// blob names are not unescaped
+		{"dir/a%20b.parquet", "escaped"},
+		{"dir/100%.parquet", "percent"},
+		{srv.BlobURL("container", "dir/other.parquet"), "other"},
+		{srv.BlobURL("other", "dir/file.parquet"), "other container"},
+	}
+	for _, test := range tests {
+		pf, err := r.Open(test.name)
+		if err != nil {
+			t.Errorf("%q: expected error to be nil but got %q", test.name, err.Error())
 			continue
 		}
-		if err == nil {
-			t.Errorf("expected [%s] error but got nil", tc.err)
-		} else if !tc.err.Match(err) {
-			t.Errorf("expected [%s] error but got: %s", tc.err, err.Error())
+		data := make([]byte, len(test.data))
+		if _, err = pf.Read(data); err != nil || string(data) != test.data {
+			t.Errorf("%q: expected to read %q but got %q (%v)", test.name, test.data, data, err)
 		}
+		pf.Close()
 	}
-	_, err := NewAzBlobFileReaderWithClient(context.Background(), "dummy-url", nil)
-	expected := "client cannot be nil"
-	if err == nil {
-		t.Errorf("expected [%s] but got: <nil>", expected)
-	} else if !strings.Contains(err.Error(), expected) {
-		t.Errorf("expected [%s] error but got: %s", expected, err.Error())
+
+	// blobs of another storage account are not reachable with its credential
+	_, err = r.Open("http://other.example.com/" + azblobfake.Account + "/container/dir/file.parquet")
+	if !errors.Is(err, sourceerrors.ErrNotSupported) || !errors.Is(err, errOtherAccount) {
+		t.Errorf("expected ErrNotSupported for another account but got %v", err)
+	}
+
+	// without a service client only the blob of the client is reachable
+	bare, err := NewAzBlobFileReaderWithClient(ctx, srv.BlobURL("container", "dir/file.parquet"), srv.BlockBlobClient("container", "dir/file.parquet"))
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if _, err = bare.Open(""); err != nil {
+		t.Errorf("expected error to be nil but got %q", err.Error())
+	}
+	if _, err = bare.Open("dir/file.parquet"); err != nil {
+		t.Errorf("expected error to be nil but got %q", err.Error())
+	}
+	if _, err = bare.Open("dir/other.parquet"); !errors.Is(err, sourceerrors.ErrNotSupported) || !errors.Is(err, errNoService) {
+		t.Errorf("expected ErrNotSupported without a service client but got %v", err)
+	}
+
+	// Create resolves names the same way
+	w, err := NewAzBlobFileWriterWithParams(ctx, srv.BlobURL("container", "dir/file.parquet"), srv.BlockBlobClient("container", "dir/file.parquet"), AzBlobFileWriterParams{
+		ServiceClient: srv.ServiceClient(),
+	})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	sibling, err := w.Create("dir/new%20file.parquet")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	sibling.Write([]byte("new"))
+	if err = sibling.Close(); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	w.Close()
+	if b, ok := srv.GetBlob("container", "dir/new%20file.parquet"); !ok || string(b.Data) != "new" {
+		t.Errorf("expected Create to write the sibling blob")
+	}
+}
+
+func TestStreamingReads(t *testing.T) {
+	srv := azblobfake.NewServer()
+	defer srv.Close()
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	srv.PutBlob("container", "blob", data)
+	ctx := context.Background()
+
+	tests := []struct {
+		minRequestSize int
+		requests       int
+	}{
+		// a single response for the whole blob
+		{0, 1},
+		{100, 10},
+	}
+	for _, test := range tests {
+		pf, err := NewAzBlobFileReaderWithParams(ctx, srv.BlobURL("container", "blob"), srv.BlockBlobClient("container", "blob"), AzBlobFileReaderParams{
+			MinRequestSize: test.minRequestSize,
+		})
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+
+		// clones read the same way
+		for _, r := range []source.ParquetFile{pf, mustOpen(t, pf)} {
+			before := srv.Requests()
+			got := make([]byte, 0, len(data))
+			buf := make([]byte, 10)
+			for {
+				n, err := r.Read(buf)
+				got = append(got, buf[:n]...)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("expected error to be nil but got %q", err.Error())
+				}
+				// seeking to the current offset keeps the response
+				r.Seek(0, io.SeekCurrent)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("MinRequestSize %d: expected to read the blob", test.minRequestSize)
+			}
+			if requests := srv.Requests() - before; requests != test.requests {
+				t.Errorf("MinRequestSize %d: expected %d requests but got %d", test.minRequestSize, test.requests, requests)
+			}
+			r.Close()
+		}
+	}
+
+	r, err := NewAzBlobFileReaderWithParams(ctx, srv.BlobURL("container", "blob"), srv.BlockBlobClient("container", "blob"), AzBlobFileReaderParams{
+		MinRequestSize: 100,
+	})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	defer r.Close()
+
+	// reads spanning several responses fill p
+	buf := make([]byte, 250)
+	if n, err := r.Read(buf); n != len(buf) || err != nil || !bytes.Equal(buf, data[:250]) {
+		t.Errorf("expected to read 250 bytes but got %d (%v)", n, err)
+	}
+
+	// seeking elsewhere opens a new response at the offset
+	before := srv.Requests()
+	if _, err = r.Seek(700, io.SeekStart); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if n, err := r.Read(buf[:10]); n != 10 || err != nil || !bytes.Equal(buf[:10], data[700:710]) {
+		t.Errorf("expected to read 10 bytes at 700 but got %d (%v)", n, err)
+	}
+	if requests := srv.Requests() - before; requests != 1 {
+		t.Errorf("expected a single request after Seek but got %d", requests)
+	}
+
+	// past the end
+	if _, err = r.Seek(10, io.SeekEnd); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if _, err = r.Read(buf); err != io.EOF {
+		t.Errorf("expected io.EOF but got %v", err)
+	}
+}
+
+func mustOpen(t *testing.T, pf source.ParquetFile) source.ParquetFile {
+	clone, err := pf.Open("")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	return clone
+}
+
+func TestWriterParams(t *testing.T) {
+	srv := azblobfake.NewServer()
+	defer srv.Close()
+	srv.CreateContainer("container")
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("x"), 5<<20)
+
+	contentType := "application/vnd.apache.parquet"
+	rows := "10"
+	tier := blob.AccessTierCool
+	params := AzBlobFileWriterParams{
+		ServiceClient: srv.ServiceClient(),
+		BlockSize:     2 << 20,
+		Concurrency:   2,
+		AccessTier:    &tier,
+		HTTPHeaders:   &blob.HTTPHeaders{BlobContentType: &contentType},
+		Metadata:      map[string]*string{"rows": &rows},
+		Tags:          map[string]string{"stage": "raw"},
+	}
+	w, err := NewAzBlobFileWriterWithParams(ctx, srv.BlobURL("container", "blob"), srv.BlockBlobClient("container", "blob"), params)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	before := srv.Requests()
+	if _, err = w.Write(data); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	// three blocks and the block list
+	if requests := srv.Requests() - before; requests != 4 {
+		t.Errorf("expected 4 requests but got %d", requests)
+	}
+	b, _ := srv.GetBlob("container", "blob")
+	if !bytes.Equal(b.Data, data) {
+		t.Fatalf("expected the data to be uploaded")
+	}
+	if b.ContentType != contentType || b.Metadata["rows"] != rows || b.AccessTier != string(tier) || b.Tags["stage"] != "raw" {
+		t.Errorf("expected the blob to be uploaded with the params but got %q, %v, %q and %v", b.ContentType, b.Metadata, b.AccessTier, b.Tags)
+	}
+	if etag := w.(*AzBlockBlob).ETag(); etag != b.ETag {
+		t.Errorf("expected ETag %s after Close but got %s", b.ETag, etag)
+	}
+
+	// writers created with Create share the params
+	clone, err := w.Create("other")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	clone.Write(data)
+	if err = clone.Close(); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if b, _ = srv.GetBlob("container", "other"); b.ContentType != contentType || b.AccessTier != string(tier) {
+		t.Errorf("expected the clone to be uploaded with the params but got %q and %q", b.ContentType, b.AccessTier)
+	}
+
+	// access conditions are checked when the block list is committed
+	anyETag := azcore.ETagAny
+	params.AccessConditions = &blob.AccessConditions{ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfNoneMatch: &anyETag}}
+	w, err = NewAzBlobFileWriterWithParams(ctx, srv.BlobURL("container", "blob"), srv.BlockBlobClient("container", "blob"), params)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	w.Write([]byte("new"))
+	if err = w.Close(); !errors.Is(err, sourceerrors.ErrPreconditionFailed) {
+		t.Errorf("expected ErrPreconditionFailed but got %v", err)
+	}
+	if b, _ = srv.GetBlob("container", "blob"); !bytes.Equal(b.Data, data) {
+		t.Errorf("expected the blob to be left as it was")
 	}
 }
@@ -0,0 +1,237 @@
+package azblob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/appendblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/pageblob"
+)
+
+const (
+	// maxAppendBytes is the largest block accepted by Append Block, and the
+	// largest range accepted by Put Page.
+	maxAppendBytes = 4 << 20
+
+	// pageBlobLengthKey is the metadata key holding the length of the data of a
+	// page blob, without the padding to a whole page.
+	pageBlobLengthKey = "parquetlength"
+)
+
+// containerClient returns the client of the container of the blob, which
+// creates clients of other blob types sharing its credential.
+func (s *AzBlockBlob) containerClient() (*container.Client, string, error) {
+	parts, err := blob.ParseURL(s.blockBlobClient.URL())
+	if err != nil {
+		return nil, "", err
+	}
+	return s.serviceClient.NewContainerClient(parts.ContainerName), parts.BlobName, nil
+}
+
+// uploadAppendBlob creates an append blob and appends the data written in
+// blocks of at most 4 MiB. Every block must land at the end of the data written
+// so far, so concurrent writers fail instead of interleaving.
+func (s *AzBlockBlob) uploadAppendBlob(ctx context.Context) error {
+	containerClient, name, err := s.containerClient()
+	if err != nil {
+		return err
+	}
+	client := containerClient.NewAppendBlobClient(name)
+
+	params := s.writerParams
+	resp, err := client.Create(ctx, &appendblob.CreateOptions{
+		AccessConditions: s.createConditions(),
+		HTTPHeaders:      params.HTTPHeaders,
+		CPKInfo:          params.CPKInfo,
+		CPKScopeInfo:     params.CPKScopeInfo,
+		Tags:             params.Tags,
+		Metadata:         params.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+	s.setVersion(resp.ETag, resp.VersionID)
+
+	buf := make([]byte, maxAppendBytes)
+	var offset int64
+	for {
+		n, readErr := io.ReadFull(s.pipeReader, buf)
+		if n > 0 {
+			position := offset
+			resp, err := client.AppendBlock(ctx, streaming.NopCloser(bytes.NewReader(buf[:n])), &appendblob.AppendBlockOptions{
+				AppendPositionAccessConditions: &appendblob.AppendPositionAccessConditions{AppendPosition: &position},
+				CPKInfo:                        params.CPKInfo,
+				CPKScopeInfo:                   params.CPKScopeInfo,
+			})
+			if err != nil {
+				return s.discard(client.Delete, err)
+			}
+			s.setVersion(resp.ETag, nil)
+			offset += int64(n)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if readErr != nil {
+			return s.discard(client.Delete, readErr)
+		}
+	}
+}
+
+// uploadPageBlob creates a page blob and writes the data written in ranges of
+// at most 4 MiB, growing the blob as needed. The last range is padded with
+// zeros to a whole page, and the length of the data is recorded in the metadata
+// of the blob when the pipe is closed.
+func (s *AzBlockBlob) uploadPageBlob(ctx context.Context) error {
+	containerClient, name, err := s.containerClient()
+	if err != nil {
+		return err
+	}
+	client := containerClient.NewPageBlobClient(name)
+
+	params := s.writerParams
+	resp, err := client.Create(ctx, 0, &pageblob.CreateOptions{
+		AccessConditions: s.createConditions(),
+		HTTPHeaders:      params.HTTPHeaders,
+		CPKInfo:          params.CPKInfo,
+		CPKScopeInfo:     params.CPKScopeInfo,
+		Tags:             params.Tags,
+		Metadata:         params.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+	s.setVersion(resp.ETag, resp.VersionID)
+
+	buf := make([]byte, maxAppendBytes)
+	var offset, length int64
+	for {
+		n, readErr := io.ReadFull(s.pipeReader, buf)
+		if n > 0 {
+			padded := (n + pageblob.PageBytes - 1) / pageblob.PageBytes * pageblob.PageBytes
+			for i := n; i < padded; i++ {
+				buf[i] = 0
+			}
+
+			err = s.writePages(ctx, client, buf[:padded], offset)
+			if err != nil {
+				return s.discard(client.Delete, err)
+			}
+			offset += int64(padded)
+			length += int64(n)
+		}
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return s.discard(client.Delete, readErr)
+		}
+		if readErr != nil {
+			break
+		}
+	}
+
+	metadata := map[string]*string{}
+	for k, v := range params.Metadata {
+		metadata[k] = v
+	}
+	lengthValue := strconv.FormatInt(length, 10)
+	metadata[pageBlobLengthKey] = &lengthValue
+	metaResp, err := client.SetMetadata(ctx, metadata, &blob.SetMetadataOptions{
+		CPKInfo:      params.CPKInfo,
+		CPKScopeInfo: params.CPKScopeInfo,
+	})
+	if err != nil {
+		return s.discard(client.Delete, err)
+	}
+	s.setVersion(metaResp.ETag, metaResp.VersionID)
+	return nil
+}
+
+// writePages grows the page blob to hold data at offset and writes it.
+func (s *AzBlockBlob) writePages(ctx context.Context, client *pageblob.Client, data []byte, offset int64) error {
+	params := s.writerParams
+	_, err := client.Resize(ctx, offset+int64(len(data)), &pageblob.ResizeOptions{
+		CPKInfo:      params.CPKInfo,
+		CPKScopeInfo: params.CPKScopeInfo,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = client.UploadPages(ctx, streaming.NopCloser(bytes.NewReader(data)), blob.HTTPRange{
+		Offset: offset,
+		Count:  int64(len(data)),
+	}, &pageblob.UploadPagesOptions{
+		CPKInfo:      params.CPKInfo,
+		CPKScopeInfo: params.CPKScopeInfo,
+	})
+	return err
+}
+
+// createConditions returns the access conditions of the creation of an append
+// or page blob. Creating one replaces an existing blob at once rather than when
+// the upload completes, so unless AccessConditions is set the blob must not
+// exist yet.
+func (s *AzBlockBlob) createConditions() *blob.AccessConditions {
+	if s.writerParams.AccessConditions != nil {
+		return s.writerParams.AccessConditions
+	}
+	anyETag := azcore.ETagAny
+	return &blob.AccessConditions{
+		ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfNoneMatch: &anyETag},
+	}
+}
+
+// discard deletes a blob that was created by an upload failed with err, and
+// returns err. The context of the file is used as the one of the upload may be
+// cancelled.
+func (s *AzBlockBlob) discard(deleteBlob func(context.Context, *blob.DeleteOptions) (blob.DeleteResponse, error), err error) error {
+	if _, deleteErr := deleteBlob(s.ctx, nil); deleteErr != nil {
+		return &discardError{err: err, deleteErr: s.wrapError(deleteErr)}
+	}
+	return err
+}
+
+// discardError reports a blob that could not be deleted after a failed or
+// aborted upload. It matches both the error of the upload and the one of the
+// delete.
+type discardError struct {
+	err       error
+	deleteErr error
+}
+
+func (e *discardError) Error() string {
+	return fmt.Sprintf("%v, and deleting the blob failed: %v", e.err, e.deleteErr)
+}
+
+// Is makes errors.Is match the error of the delete.
+func (e *discardError) Is(target error) bool {
+	return errors.Is(e.deleteErr, target)
+}
+
+// Unwrap returns the error of the upload.
+func (e *discardError) Unwrap() error {
+	return e.err
+}
+
+// pageBlobLength returns the length of the data of a page blob written by this
+// package.
+func pageBlobLength(props blob.GetPropertiesResponse) (int64, bool) {
+	if props.BlobType == nil || *props.BlobType != blob.BlobTypePageBlob {
+		return 0, false
+	}
+	for k, v := range props.Metadata {
+		if strings.EqualFold(k, pageBlobLengthKey) && v != nil {
+			length, err := strconv.ParseInt(*v, 10, 64)
+			return length, err == nil && length <= *props.ContentLength
+		}
+	}
+	return 0, false
+}
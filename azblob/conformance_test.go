@@ -0,0 +1,54 @@
+package azblob
+
+import (
+	"context"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/azblobfake"
+	"github.com/xitongsys/parquet-go-source/sourcetest"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+func TestConformance(t *testing.T) {
+	srv := azblobfake.NewServer()
+	defer srv.Close()
+	srv.CreateContainer("container")
+	ctx := context.Background()
+	put := func(name string, data []byte) error {
+		srv.PutBlob("container", name, data)
+		return nil
+	}
+
+	// files built from a bare client only address their own blob
+	t.Run("Client", func(t *testing.T) {
+		sourcetest.RunConformance(t, sourcetest.Factory{
+			Open: func(name string) (source.ParquetFile, error) {
+				return NewAzBlobFileReaderWithClient(ctx, srv.BlobURL("container", name), srv.BlockBlobClient("container", name))
+			},
+			Create: func(name string) (source.ParquetFile, error) {
+				return NewAzBlobFileWriterWithClient(ctx, srv.BlobURL("container", name), srv.BlockBlobClient("container", name))
+			},
+			Put:          put,
+			SingleObject: true,
+		})
+	})
+
+	t.Run("ServiceClient", func(t *testing.T) {
+		serviceClient := srv.ServiceClient()
+		sourcetest.RunConformance(t, sourcetest.Factory{
+			Open: func(name string) (source.ParquetFile, error) {
+				return NewAzBlobFileReaderWithParams(ctx, srv.BlobURL("container", name), srv.BlockBlobClient("container", name), AzBlobFileReaderParams{
+					ServiceClient:  serviceClient,
+					MinRequestSize: 1000,
+				})
+			},
+			Create: func(name string) (source.ParquetFile, error) {
+				return NewAzBlobFileWriterWithParams(ctx, srv.BlobURL("container", name), srv.BlockBlobClient("container", name), AzBlobFileWriterParams{
+					ServiceClient: serviceClient,
+					BlockSize:     4096,
+					Concurrency:   2,
+				})
+			},
+		})
+	})
+}
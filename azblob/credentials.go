@@ -0,0 +1,148 @@
+package azblob
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// sasClockSkew is subtracted from the start time of generated SAS tokens, so
+// that they are valid on servers whose clock is behind.
+const sasClockSkew = 5 * time.Minute
+
+var (
+	errNoSAS         = errors.New("URL has no SAS signature")
+	errCannotSignSAS = errors.New("ReadSASURL: neither a shared key nor a token credential to sign with")
+)
+
+// NewAzBlobFileWriterWithConnectionString creates an Azure Blob FileWriter for a blob of the storage account of a
+// connection string, to be used with NewParquetWriter
+func NewAzBlobFileWriterWithConnectionString(ctx context.Context, connectionString, containerName, blobName string, clientOptions blockblob.ClientOptions) (source.ParquetFile, error) {
+	client, serviceClient, err := newConnectionStringClients(connectionString, containerName, blobName, clientOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAzBlobFileWriterWithParams(ctx, client.URL(), client, AzBlobFileWriterParams{ServiceClient: serviceClient})
+}
+
+// NewAzBlobFileReaderWithConnectionString creates an Azure Blob FileReader for a blob of the storage account of a
+// connection string, to be used with NewParquetReader
+func NewAzBlobFileReaderWithConnectionString(ctx context.Context, connectionString, containerName, blobName string, clientOptions blockblob.ClientOptions) (source.ParquetFile, error) {
+	client, serviceClient, err := newConnectionStringClients(connectionString, containerName, blobName, clientOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAzBlobFileReaderWithParams(ctx, client.URL(), client, AzBlobFileReaderParams{ServiceClient: serviceClient})
+}
+
+// NewAzBlobFileWriterWithSAS creates an Azure Blob FileWriter for a URL signed with a SAS token, to be used with
+// NewParquetWriter. Open and Create reuse the token for other blobs, which requires a container or account SAS.
+func NewAzBlobFileWriterWithSAS(ctx context.Context, sasURL string, clientOptions blockblob.ClientOptions) (source.ParquetFile, error) {
+	if err := checkSAS(sasURL); err != nil {
+		return nil, err
+	}
+
+	return NewAzBlobFileWriter(ctx, sasURL, nil, clientOptions)
+}
+
+// NewAzBlobFileReaderWithSAS creates an Azure Blob FileReader for a URL signed with a SAS token, to be used with
+// NewParquetReader. Open reuses the token for other blobs, which requires a container or account SAS.
+func NewAzBlobFileReaderWithSAS(ctx context.Context, sasURL string, clientOptions blockblob.ClientOptions) (source.ParquetFile, error) {
+	if err := checkSAS(sasURL); err != nil {
+		return nil, err
+	}
+
+	return NewAzBlobFileReader(ctx, sasURL, nil, clientOptions)
+}
+
+// checkSAS verifies that URL carries a SAS signature, as a URL without one
+// would silently be used anonymously.
+func checkSAS(URL string) error {
+	parts, err := blob.ParseURL(URL)
+	if err != nil {
+		return err
+	}
+	if parts.SAS.Signature() == "" {
+		return errNoSAS
+	}
+	return nil
+}
+
+// newConnectionStringClients creates the client of a blob and the client of its
+// storage account from a connection string.
+func newConnectionStringClients(connectionString, containerName, blobName string, clientOptions blockblob.ClientOptions) (*blockblob.Client, *service.Client, error) {
+	client, err := blockblob.NewClientFromConnectionString(connectionString, containerName, blobName, &clientOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serviceOptions := service.ClientOptions(clientOptions)
+	serviceClient, err := service.NewClientFromConnectionString(connectionString, &serviceOptions)
+	return client, serviceClient, err
+}
+
+// ReadSASURL returns the URL of the blob signed with a SAS token granting read
+// access for the given duration, e.g. for http.NewHttpReader or an external
+// consumer. The token is signed with the shared key of the file if it has one,
+// and otherwise with a user delegation key requested with its token
+// credential.
+func (s *AzBlockBlob) ReadSASURL(ctx context.Context, validity time.Duration) (string, error) {
+	now := time.Now().UTC()
+	start := now.Add(-sasClockSkew)
+	expiry := now.Add(validity)
+	permissions := sas.BlobPermissions{Read: true}
+
+	parts, err := blob.ParseURL(s.blockBlobClient.URL())
+	if err != nil {
+		return "", err
+	}
+
+	// the blob client of a blockblob.Client does not carry its shared key,
+	// unlike the one derived from the service client
+	blobClient := s.blockBlobClient.BlobClient()
+	if s.serviceClient != nil {
+		blobClient = s.serviceClient.NewContainerClient(parts.ContainerName).NewBlobClient(parts.BlobName)
+	}
+	signed, err := blobClient.GetSASURL(permissions, expiry, &blob.GetSASURLOptions{StartTime: &start})
+	if !errors.Is(err, bloberror.MissingSharedKeyCredential) {
+		return signed, s.wrapError(err)
+	}
+	// files authenticated with a SAS token have no credential to sign with
+	if s.serviceClient == nil || parts.SAS.Signature() != "" {
+		return "", sourceerrors.Wrap(sourceerrors.ErrNotSupported, errCannotSignSAS)
+	}
+
+	credential, err := s.serviceClient.GetUserDelegationCredential(ctx, service.KeyInfo{
+		Start:  toPtr(start.Format(sas.TimeFormat)),
+		Expiry: toPtr(expiry.Format(sas.TimeFormat)),
+	}, nil)
+	if err != nil {
+		return "", s.wrapError(err)
+	}
+
+	parts.SAS, err = sas.BlobSignatureValues{
+		StartTime:     start,
+		ExpiryTime:    expiry,
+		Permissions:   permissions.String(),
+		ContainerName: parts.ContainerName,
+		BlobName:      parts.BlobName,
+	}.SignWithUserDelegation(credential)
+	if err != nil {
+		return "", err
+	}
+	return parts.String(), nil
+}
+
+func toPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,105 @@
+package azblob
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/xitongsys/parquet-go-source/azblobfake"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	httpsource "github.com/xitongsys/parquet-go-source/http"
+)
+
+func TestConnectionString(t *testing.T) {
+	srv := azblobfake.NewServer()
+	defer srv.Close()
+	srv.CreateContainer("container")
+	ctx := context.Background()
+
+	w, err := NewAzBlobFileWriterWithConnectionString(ctx, srv.ConnectionString(), "container", "dir/file.parquet", testClientOptions)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if _, err = w.Write([]byte("PAR1 data PAR1")); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	r, err := NewAzBlobFileReaderWithConnectionString(ctx, srv.ConnectionString(), "container", "dir/file.parquet", testClientOptions)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil || string(data) != "PAR1 data PAR1" {
+		t.Errorf("expected to read back the blob but got %q (%v)", data, err)
+	}
+
+	// the connection string gives access to the whole account
+	srv.PutBlob("other", "file.parquet", []byte("other"))
+	if _, err = r.Open(srv.BlobURL("other", "file.parquet")); err != nil {
+		t.Errorf("expected error to be nil but got %q", err.Error())
+	}
+}
+
+func TestSAS(t *testing.T) {
+	srv := azblobfake.NewServer()
+	defer srv.Close()
+	srv.PutBlob("container", "dir/file.parquet", []byte("PAR1 data PAR1"))
+	ctx := context.Background()
+	URL := srv.BlobURL("container", "dir/file.parquet")
+
+	// an unsigned URL would silently be used anonymously
+	if _, err := NewAzBlobFileReaderWithSAS(ctx, URL, testClientOptions); !errors.Is(err, errNoSAS) {
+		t.Errorf("expected errNoSAS but got %v", err)
+	}
+	if _, err := NewAzBlobFileWriterWithSAS(ctx, URL, testClientOptions); !errors.Is(err, errNoSAS) {
+		t.Errorf("expected errNoSAS but got %v", err)
+	}
+
+	pf, err := NewAzBlobFileReaderWithSharedKey(ctx, URL, srv.Credential(), testClientOptions)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	sasURL, err := pf.(*AzBlockBlob).ReadSASURL(ctx, time.Hour)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	u, err := url.Parse(sasURL)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if query := u.Query(); query.Get("sig") == "" || query.Get("sp") != "r" {
+		t.Errorf("expected a read-only SAS but got %s", u.RawQuery)
+	}
+
+	// the URL can be handed to the HTTP reader
+	hr, err := httpsource.NewHttpReader(sasURL, false, false, nil)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	data, err := ioutil.ReadAll(hr)
+	hr.Close()
+	if err != nil || string(data) != "PAR1 data PAR1" {
+		t.Errorf("expected to read the blob over HTTP but got %q (%v)", data, err)
+	}
+
+	// files authenticated with a SAS have no key to sign another one with
+	sasFile, err := NewAzBlobFileReaderWithSAS(ctx, sasURL, testClientOptions)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	defer sasFile.Close()
+	if data, err = ioutil.ReadAll(sasFile); err != nil || string(data) != "PAR1 data PAR1" {
+		t.Errorf("expected to read the blob with the SAS but got %q (%v)", data, err)
+	}
+	_, err = sasFile.(*AzBlockBlob).ReadSASURL(ctx, time.Hour)
+	if !errors.Is(err, sourceerrors.ErrNotSupported) || !errors.Is(err, errCannotSignSAS) {
+		t.Errorf("expected ErrNotSupported but got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package azblobfake
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// authorize verifies the shared key signature of a request, if it has one. It
+// returns the error code to reply with otherwise.
+func (s *Server) authorize(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return "", true
+	}
+
+	credential := strings.TrimPrefix(auth, "SharedKey ")
+	i := strings.LastIndexByte(credential, ':')
+	if credential == auth || i < 0 || credential[:i] != Account {
+		return "AuthenticationFailed", false
+	}
+	expected, err := sign(stringToSign(r))
+	if err != nil || !hmac.Equal([]byte(credential[i+1:]), []byte(expected)) {
+		return "AuthenticationFailed", false
+	}
+	return "", true
+}
+
+// sign returns the signature of stringToSign with Key.
+func sign(stringToSign string) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(Key)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// stringToSign builds the string signed by a shared key for the Blob service.
+// See https://learn.microsoft.com/rest/api/storageservices/authorize-with-shared-key.
+func stringToSign(r *http.Request) string {
+	header := r.Header
+	contentLength := header.Get("Content-Length")
+	if contentLength == "" && r.ContentLength > 0 {
+		contentLength = strconv.FormatInt(r.ContentLength, 10)
+	}
+	if contentLength == "0" {
+		contentLength = ""
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		header.Get("Content-Encoding"),
+		header.Get("Content-Language"),
+		contentLength,
+		header.Get("Content-MD5"),
+		header.Get("Content-Type"),
+		// x-ms-date is signed instead of Date
+		"",
+		header.Get("If-Modified-Since"),
+		header.Get("If-Match"),
+		header.Get("If-None-Match"),
+		header.Get("If-Unmodified-Since"),
+		header.Get("Range"),
+		canonicalizedHeaders(header),
+		canonicalizedResource(r.URL),
+	}, "\n")
+}
+
+// canonicalizedHeaders lists the x-ms-* headers, sorted by name.
+func canonicalizedHeaders(header http.Header) string {
+	var names []string
+	values := map[string][]string{}
+	for name, v := range header {
+		lower := strings.ToLower(strings.TrimSpace(name))
+		if strings.HasPrefix(lower, "x-ms-") {
+			names = append(names, lower)
+			values[lower] = v
+		}
+	}
+	sort.Strings(names)
+
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = name + ":" + strings.Join(values[name], ",")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// canonicalizedResource names the account, the escaped path and the query
+// parameters sorted by name. The path of emulator style URLs repeats the
+// account.
+func canonicalizedResource(u *url.URL) string {
+	resource := "/" + Account + u.EscapedPath()
+	if u.Path == "" {
+		resource += "/"
+	}
+
+	query := u.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := query[name]
+		sort.Strings(values)
+		resource += "\n" + name + ":" + strings.Join(values, ",")
+	}
+	return resource
+}
@@ -0,0 +1,729 @@
+// Package azblobfake runs an in-memory server speaking enough of the Azure Blob
+// Storage REST API to test the azblob backend without network access or mocks:
+//
+//	srv := azblobfake.NewServer()
+//	defer srv.Close()
+//	srv.CreateContainer("container")
+//	pf, err := azblob.NewAzBlobFileWriterWithClient(ctx, srv.BlobURL("container", "blob"), srv.BlockBlobClient("container", "blob"))
+//
+// URLs are in the style of the storage emulator, with the account name as the
+// first path segment. The server supports block blobs (Put Blob, Put Block and
+// Put Block List), append blobs (Append Block), page blobs (Put Page and
+// resizing), Get Blob with ranges, Get Blob Properties, Set Blob Metadata,
+// Delete Blob and the If-Match and If-None-Match conditions. Requests signed
+// with a shared key are verified against Key; requests without an
+// Authorization header, such as SAS requests, are accepted without checks.
+package azblobfake
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Account is the name of the storage account of the server.
+	Account = "devstoreaccount1"
+	// Key is the base64 encoded shared key of Account.
+	Key = "YXpibG9iZmFrZS1zaGFyZWQta2V5LWZvci10ZXN0cw=="
+
+	// PageSize is the size of the pages of page blobs.
+	PageSize = 512
+	// MaxAppendSize is the largest block accepted by Append Block and the
+	// largest range accepted by Put Page.
+	MaxAppendSize = 4 << 20
+)
+
+// Blob types, as sent in the x-ms-blob-type header.
+const (
+	BlockBlob  = "BlockBlob"
+	AppendBlob = "AppendBlob"
+	PageBlob   = "PageBlob"
+)
+
+// Blob is a blob stored by the server.
+type Blob struct {
+	Data         []byte
+	ETag         string
+	LastModified time.Time
+	// Type is BlockBlob, AppendBlob or PageBlob.
+	Type string
+	// ContentType and Metadata are taken from the x-ms-blob-content-type and
+	// x-ms-meta-* headers of the request creating the blob, or of Set Blob
+	// Metadata. The keys of Metadata are lower case.
+	ContentType string
+	Metadata    map[string]string
+	// AccessTier and Tags are taken from the x-ms-access-tier and x-ms-tags
+	// headers of the request creating the blob.
+	AccessTier string
+	Tags       map[string]string
+
+	// blocks lists the committed blocks of a block blob
+	blocks []block
+}
+
+type block struct {
+	id   string
+	data []byte
+}
+
+const metaPrefix = "x-ms-meta-"
+
+// setProperties records the properties sent with the request creating the
+// blob.
+func (b *Blob) setProperties(header http.Header) {
+	b.ContentType = header.Get("x-ms-blob-content-type")
+	b.setMetadata(header)
+	b.AccessTier = header.Get("x-ms-access-tier")
+	b.Tags = nil
+	if tags, err := url.ParseQuery(header.Get("x-ms-tags")); err == nil && len(tags) > 0 {
+		b.Tags = map[string]string{}
+		for k := range tags {
+			b.Tags[k] = tags.Get(k)
+		}
+	}
+}
+
+// setMetadata replaces the user metadata with the one sent with a request.
+func (b *Blob) setMetadata(header http.Header) {
+	b.Metadata = nil
+	for name := range header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, metaPrefix) {
+			if b.Metadata == nil {
+				b.Metadata = map[string]string{}
+			}
+			b.Metadata[strings.TrimPrefix(lower, metaPrefix)] = header.Get(name)
+		}
+	}
+}
+
+type container struct {
+	blobs map[string]*Blob
+	// staged holds the uncommitted blocks of every blob name
+	staged map[string]map[string][]byte
+}
+
+// Server is an in-memory Azure Blob Storage server listening on a local port.
+type Server struct {
+	// URL is the endpoint of the storage account, e.g.
+	// http://127.0.0.1:1234/devstoreaccount1.
+	URL string
+
+	srv *httptest.Server
+
+	lock       sync.Mutex
+	containers map[string]*container
+	nextETag   int64
+	requests   int
+}
+
+// NewServer starts a server without containers.
+func NewServer() *Server {
+	s := &Server{containers: map[string]*container{}}
+	s.srv = httptest.NewServer(s)
+	s.URL = s.srv.URL + "/" + Account
+	return s
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// CreateContainer creates an empty container, if it does not exist yet.
+func (s *Server) CreateContainer(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.createContainer(name)
+}
+
+// createContainer creates a container and reports whether it did not exist.
+// The lock must be held.
+func (s *Server) createContainer(name string) bool {
+	if s.containers[name] != nil {
+		return false
+	}
+	s.containers[name] = &container{blobs: map[string]*Blob{}, staged: map[string]map[string][]byte{}}
+	return true
+}
+
+// BlobURL returns the URL of a blob of the server.
+func (s *Server) BlobURL(containerName, blobName string) string {
+	return s.URL + "/" + containerName + "/" + blobName
+}
+
+// PutBlob stores data as a block blob, bypassing the HTTP API. The container is
+// created if needed.
+func (s *Server) PutBlob(containerName, blobName string, data []byte) *Blob {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.createContainer(containerName)
+	b := &Blob{Data: data, Type: BlockBlob}
+	s.store(s.containers[containerName], blobName, b)
+	return b
+}
+
+// GetBlob returns a blob.
+func (s *Server) GetBlob(containerName, blobName string) (*Blob, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c := s.containers[containerName]
+	if c == nil {
+		return nil, false
+	}
+	b := c.blobs[blobName]
+	return b, b != nil
+}
+
+// Requests returns the number of requests received so far.
+func (s *Server) Requests() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests
+}
+
+// store replaces the blob called name with b. The lock must be held.
+func (s *Server) store(c *container, name string, b *Blob) {
+	s.touch(b)
+	c.blobs[name] = b
+}
+
+// touch gives a modified blob a new ETag. The lock must be held.
+func (s *Server) touch(b *Blob) {
+	s.nextETag++
+	b.ETag = fmt.Sprintf(`"0x8D%013X"`, s.nextETag)
+	// Last-Modified has a resolution of a second
+	b.LastModified = time.Now().UTC().Truncate(time.Second)
+}
+
+// ServeHTTP implements the Blob REST API for emulator style URLs.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	s.requests++
+	s.lock.Unlock()
+
+	w.Header().Set("x-ms-request-id", "azblobfake")
+	w.Header().Set("x-ms-version", r.Header.Get("x-ms-version"))
+	if code, ok := s.authorize(r); !ok {
+		// the body is drained so that clients see the response rather than
+		// a reset connection
+		io.Copy(ioutil.Discard, r.Body)
+		writeError(w, r, http.StatusForbidden, code, "Server failed to authenticate the request.")
+		return
+	}
+
+	account, containerName, blobName := splitPath(r.URL.Path)
+	query := r.URL.Query()
+	switch {
+	case account != Account:
+		writeError(w, r, http.StatusBadRequest, "InvalidUri", "the account does not exist")
+	case containerName == "":
+		writeError(w, r, http.StatusNotImplemented, "UnsupportedHeader", "service operations are not supported")
+	case blobName == "":
+		s.serveContainer(w, r, containerName)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		s.getBlob(w, r, containerName, blobName)
+	case r.Method == http.MethodDelete:
+		s.deleteBlob(w, r, containerName, blobName)
+	case r.Method != http.MethodPut:
+		writeError(w, r, http.StatusMethodNotAllowed, "UnsupportedHttpVerb", "method not allowed")
+	case query.Get("comp") == "":
+		s.putBlob(w, r, containerName, blobName)
+	case query.Get("comp") == "block":
+		s.putBlock(w, r, containerName, blobName)
+	case query.Get("comp") == "blocklist":
+		s.putBlockList(w, r, containerName, blobName)
+	case query.Get("comp") == "appendblock":
+		s.appendBlock(w, r, containerName, blobName)
+	case query.Get("comp") == "page":
+		s.putPage(w, r, containerName, blobName)
+	case query.Get("comp") == "properties":
+		s.setProperties(w, r, containerName, blobName)
+	case query.Get("comp") == "metadata":
+		s.setMetadata(w, r, containerName, blobName)
+	default:
+		writeError(w, r, http.StatusNotImplemented, "UnsupportedQueryParameter", "blob operation is not supported")
+	}
+}
+
+// splitPath splits /account/container/blob into its parts.
+func splitPath(path string) (string, string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 3)
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	return parts[0], parts[1], parts[2]
+}
+
+func (s *Server) serveContainer(w http.ResponseWriter, r *http.Request, name string) {
+	if r.URL.Query().Get("restype") != "container" {
+		writeError(w, r, http.StatusNotImplemented, "UnsupportedQueryParameter", "container operation is not supported")
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		if !s.createContainer(name) {
+			writeError(w, r, http.StatusConflict, "ContainerAlreadyExists", "The specified container already exists.")
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet, http.MethodHead:
+		if s.containers[name] == nil {
+			writeError(w, r, http.StatusNotFound, "ContainerNotFound", "The specified container does not exist.")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		if s.containers[name] == nil {
+			writeError(w, r, http.StatusNotFound, "ContainerNotFound", "The specified container does not exist.")
+			return
+		}
+		delete(s.containers, name)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "UnsupportedHttpVerb", "method not allowed")
+	}
+}
+
+// lookup returns the container and the blob called name, or writes the
+// matching error. The blob is nil if it does not exist and mustExist is false.
+// The lock must be held.
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request, containerName, name string, mustExist bool) (*container, *Blob, bool) {
+	c := s.containers[containerName]
+	if c == nil {
+		writeError(w, r, http.StatusNotFound, "ContainerNotFound", "The specified container does not exist.")
+		return nil, nil, false
+	}
+	b := c.blobs[name]
+	if b == nil && mustExist {
+		writeError(w, r, http.StatusNotFound, "BlobNotFound", "The specified blob does not exist.")
+		return nil, nil, false
+	}
+	return c, b, true
+}
+
+// lookupType is lookup for operations restricted to one type of blob.
+func (s *Server) lookupType(w http.ResponseWriter, r *http.Request, containerName, name, blobType string) (*Blob, bool) {
+	_, b, ok := s.lookup(w, r, containerName, name, true)
+	if !ok || !checkConditions(w, r, b) {
+		return nil, false
+	}
+	if b.Type != blobType {
+		writeError(w, r, http.StatusConflict, "InvalidBlobType", "The blob type is invalid for this operation.")
+		return nil, false
+	}
+	return b, true
+}
+
+// checkConditions writes the response of a failed If-Match or If-None-Match
+// condition. b is nil if the blob does not exist.
+func checkConditions(w http.ResponseWriter, r *http.Request, b *Blob) bool {
+	if match := r.Header.Get("If-Match"); match != "" {
+		if b == nil || !etagMatches(match, b.ETag) {
+			writeError(w, r, http.StatusPreconditionFailed, "ConditionNotMet", "The condition specified using HTTP conditional header(s) is not met.")
+			return false
+		}
+	}
+	if noneMatch := r.Header.Get("If-None-Match"); noneMatch != "" && b != nil {
+		if etagMatches(noneMatch, b.ETag) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotModified)
+			} else {
+				writeError(w, r, http.StatusPreconditionFailed, "ConditionNotMet", "The condition specified using HTTP conditional header(s) is not met.")
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// etagMatches reports whether one of the ETags listed in a condition header
+// matches etag.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// setBlobHeaders writes the properties of a blob shared by all responses.
+func setBlobHeaders(w http.ResponseWriter, b *Blob) {
+	w.Header().Set("ETag", b.ETag)
+	w.Header().Set("Last-Modified", b.LastModified.Format(http.TimeFormat))
+}
+
+func (s *Server) getBlob(w http.ResponseWriter, r *http.Request, containerName, name string) {
+	s.lock.Lock()
+	_, b, ok := s.lookup(w, r, containerName, name, true)
+	s.lock.Unlock()
+	if !ok || !checkConditions(w, r, b) {
+		return
+	}
+
+	size := int64(len(b.Data))
+	start, end := int64(0), size-1
+	status := http.StatusOK
+	// x-ms-range takes precedence over Range
+	header := r.Header.Get("x-ms-range")
+	if header == "" {
+		header = r.Header.Get("Range")
+	}
+	if header != "" && r.Method == http.MethodGet {
+		if start, end, ok = parseRange(header, size); !ok {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			writeError(w, r, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The range specified is invalid for the current size of the resource.")
+			return
+		}
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	}
+
+	h := w.Header()
+	h.Set("Accept-Ranges", "bytes")
+	h.Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	h.Set("Content-Type", "application/octet-stream")
+	if b.ContentType != "" {
+		h.Set("Content-Type", b.ContentType)
+	}
+	for name, value := range b.Metadata {
+		h.Set(metaPrefix+name, value)
+	}
+	h.Set("x-ms-blob-type", b.Type)
+	if b.Type == AppendBlob {
+		h.Set("x-ms-blob-committed-block-count", strconv.Itoa(len(b.blocks)))
+	}
+	setBlobHeaders(w, b)
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		w.Write(b.Data[start : end+1])
+	}
+}
+
+// parseRange parses a "bytes=start-" or "bytes=start-end" range. It returns
+// false if the range cannot be satisfied.
+func parseRange(header string, size int64) (int64, int64, bool) {
+	spec := strings.TrimPrefix(header, "bytes=")
+	i := strings.IndexByte(spec, '-')
+	if spec == header || i <= 0 {
+		return 0, 0, false
+	}
+
+	start, err := strconv.ParseInt(spec[:i], 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if last := spec[i+1:]; last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, true
+}
+
+func (s *Server) deleteBlob(w http.ResponseWriter, r *http.Request, containerName, name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c, b, ok := s.lookup(w, r, containerName, name, true)
+	if !ok || !checkConditions(w, r, b) {
+		return
+	}
+	delete(c.blobs, name)
+	delete(c.staged, name)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// putBlob creates a block blob with the data of the request, or an empty
+// append or page blob.
+func (s *Server) putBlob(w http.ResponseWriter, r *http.Request, containerName, name string) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "InvalidInput", err.Error())
+		return
+	}
+
+	b := &Blob{Type: r.Header.Get("x-ms-blob-type")}
+	switch b.Type {
+	case BlockBlob:
+		b.Data = data
+	case AppendBlob:
+	case PageBlob:
+		size, err := strconv.ParseInt(r.Header.Get("x-ms-blob-content-length"), 10, 64)
+		if err != nil || size < 0 || size%PageSize != 0 {
+			writeError(w, r, http.StatusBadRequest, "InvalidHeaderValue", "invalid x-ms-blob-content-length")
+			return
+		}
+		b.Data = make([]byte, size)
+	default:
+		writeError(w, r, http.StatusBadRequest, "InvalidHeaderValue", "invalid x-ms-blob-type")
+		return
+	}
+	if b.Type != BlockBlob && len(data) > 0 {
+		writeError(w, r, http.StatusBadRequest, "InvalidHeaderValue", "only block blobs are created with data")
+		return
+	}
+	b.setProperties(r.Header)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c, old, ok := s.lookup(w, r, containerName, name, false)
+	if !ok || !checkConditions(w, r, old) {
+		return
+	}
+	s.store(c, name, b)
+	delete(c.staged, name)
+	setBlobHeaders(w, b)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) putBlock(w http.ResponseWriter, r *http.Request, containerName, name string) {
+	id := r.URL.Query().Get("blockid")
+	if _, err := base64.StdEncoding.DecodeString(id); err != nil || id == "" {
+		writeError(w, r, http.StatusBadRequest, "InvalidQueryParameterValue", "invalid blockid")
+		return
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "InvalidInput", err.Error())
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c, _, ok := s.lookup(w, r, containerName, name, false)
+	if !ok {
+		return
+	}
+	if c.staged[name] == nil {
+		c.staged[name] = map[string][]byte{}
+	}
+	c.staged[name][id] = data
+	w.WriteHeader(http.StatusCreated)
+}
+
+// blockList is the body of Put Block List. Its entries keep their order.
+type blockList struct {
+	Entries []struct {
+		XMLName xml.Name
+		ID      string `xml:",chardata"`
+	} `xml:",any"`
+}
+
+func (s *Server) putBlockList(w http.ResponseWriter, r *http.Request, containerName, name string) {
+	var list blockList
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = xml.Unmarshal(body, &list)
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "InvalidXmlDocument", "invalid block list")
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c, old, ok := s.lookup(w, r, containerName, name, false)
+	if !ok || !checkConditions(w, r, old) {
+		return
+	}
+	if old != nil && old.Type != BlockBlob {
+		writeError(w, r, http.StatusConflict, "InvalidBlobType", "The blob type is invalid for this operation.")
+		return
+	}
+
+	committed := map[string][]byte{}
+	if old != nil {
+		for _, blk := range old.blocks {
+			committed[blk.id] = blk.data
+		}
+	}
+	b := &Blob{Type: BlockBlob, Data: []byte{}}
+	for _, entry := range list.Entries {
+		data, ok := c.staged[name][entry.ID]
+		switch entry.XMLName.Local {
+		case "Committed":
+			data, ok = committed[entry.ID]
+		case "Latest":
+			if !ok {
+				data, ok = committed[entry.ID]
+			}
+		}
+		if !ok {
+			writeError(w, r, http.StatusBadRequest, "InvalidBlockList", "The specified block list is invalid.")
+			return
+		}
+		b.blocks = append(b.blocks, block{id: entry.ID, data: data})
+		b.Data = append(b.Data, data...)
+	}
+	b.setProperties(r.Header)
+
+	s.store(c, name, b)
+	delete(c.staged, name)
+	setBlobHeaders(w, b)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) appendBlock(w http.ResponseWriter, r *http.Request, containerName, name string) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "InvalidInput", err.Error())
+		return
+	}
+	if len(data) > MaxAppendSize {
+		writeError(w, r, http.StatusRequestEntityTooLarge, "RequestBodyTooLarge", "The request body is too large.")
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	b, ok := s.lookupType(w, r, containerName, name, AppendBlob)
+	if !ok {
+		return
+	}
+	if position := r.Header.Get("x-ms-blob-condition-appendpos"); position != "" && position != strconv.Itoa(len(b.Data)) {
+		writeError(w, r, http.StatusPreconditionFailed, "AppendPositionConditionNotMet", "The append position condition specified was not met.")
+		return
+	}
+
+	offset := len(b.Data)
+	b.Data = append(b.Data, data...)
+	b.blocks = append(b.blocks, block{data: data})
+	s.touch(b)
+	setBlobHeaders(w, b)
+	w.Header().Set("x-ms-blob-append-offset", strconv.Itoa(offset))
+	w.Header().Set("x-ms-blob-committed-block-count", strconv.Itoa(len(b.blocks)))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) putPage(w http.ResponseWriter, r *http.Request, containerName, name string) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "InvalidInput", err.Error())
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	b, ok := s.lookupType(w, r, containerName, name, PageBlob)
+	if !ok {
+		return
+	}
+
+	header := r.Header.Get("x-ms-range")
+	if header == "" {
+		header = r.Header.Get("Range")
+	}
+	start, end, ok := parseRange(header, int64(len(b.Data)))
+	length := end - start + 1
+	if !ok || start%PageSize != 0 || length%PageSize != 0 || length > MaxAppendSize {
+		writeError(w, r, http.StatusRequestedRangeNotSatisfiable, "InvalidPageRange", "The page range specified is invalid.")
+		return
+	}
+
+	switch r.Header.Get("x-ms-page-write") {
+	case "update":
+		if int64(len(data)) != length {
+			writeError(w, r, http.StatusBadRequest, "InvalidHeaderValue", "the body does not match the range")
+			return
+		}
+		copy(b.Data[start:], data)
+	case "clear":
+		copy(b.Data[start:end+1], make([]byte, length))
+	default:
+		writeError(w, r, http.StatusBadRequest, "InvalidHeaderValue", "invalid x-ms-page-write")
+		return
+	}
+	s.touch(b)
+	setBlobHeaders(w, b)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// setProperties implements Set Blob Properties, which resizes page blobs.
+func (s *Server) setProperties(w http.ResponseWriter, r *http.Request, containerName, name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, b, ok := s.lookup(w, r, containerName, name, true)
+	if !ok || !checkConditions(w, r, b) {
+		return
+	}
+
+	if value := r.Header.Get("x-ms-blob-content-length"); value != "" {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size < 0 || size%PageSize != 0 {
+			writeError(w, r, http.StatusBadRequest, "InvalidHeaderValue", "invalid x-ms-blob-content-length")
+			return
+		}
+		if b.Type != PageBlob {
+			writeError(w, r, http.StatusConflict, "InvalidBlobType", "The blob type is invalid for this operation.")
+			return
+		}
+		data := make([]byte, size)
+		copy(data, b.Data)
+		b.Data = data
+	}
+	if contentType := r.Header.Get("x-ms-blob-content-type"); contentType != "" {
+		b.ContentType = contentType
+	}
+	s.touch(b)
+	setBlobHeaders(w, b)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) setMetadata(w http.ResponseWriter, r *http.Request, containerName, name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, b, ok := s.lookup(w, r, containerName, name, true)
+	if !ok || !checkConditions(w, r, b) {
+		return
+	}
+	b.setMetadata(r.Header)
+	s.touch(b)
+	setBlobHeaders(w, b)
+	w.WriteHeader(http.StatusOK)
+}
+
+type errorResponse struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string
+	Message string
+}
+
+// writeError writes a Blob service error response. The code is also sent in
+// the x-ms-error-code header, which is all HEAD responses carry.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	w.Header().Set("x-ms-error-code", code)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+
+	data, err := xml.Marshal(errorResponse{Code: code, Message: message})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Length", strconv.Itoa(len(xml.Header)+len(data)))
+	w.WriteHeader(status)
+	io.WriteString(w, xml.Header)
+	w.Write(data)
+}
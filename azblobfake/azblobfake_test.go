@@ -0,0 +1,161 @@
+package azblobfake
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/appendblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+)
+
+func statusOf(err error) int {
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode
+	}
+	return 0
+}
+
+func TestSharedKey(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.PutBlob("container", "blob", []byte("data"))
+	ctx := context.Background()
+
+	if _, err := srv.BlockBlobClient("container", "blob").GetProperties(ctx, nil); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	req, err := http.NewRequest(http.MethodHead, srv.BlobURL("container", "blob"), nil)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	req.Header.Set("x-ms-date", "Mon, 02 Jan 2006 15:04:05 GMT")
+	req.Header.Set("Authorization", "SharedKey "+Account+":"+base64.StdEncoding.EncodeToString([]byte("forged")))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden || resp.Header.Get("x-ms-error-code") != "AuthenticationFailed" {
+		t.Errorf("expected 403 AuthenticationFailed but got %d %s", resp.StatusCode, resp.Header.Get("x-ms-error-code"))
+	}
+}
+
+func TestRangeAndConditions(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	b := srv.PutBlob("container", "blob", []byte("0123456789"))
+	client := srv.BlockBlobClient("container", "blob")
+	ctx := context.Background()
+
+	etag := azcore.ETag(b.ETag)
+	resp, err := client.DownloadStream(ctx, &blob.DownloadStreamOptions{
+		Range:            blob.HTTPRange{Offset: 2, Count: 3},
+		AccessConditions: &blob.AccessConditions{ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfMatch: &etag}},
+	})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(data) != "234" || *resp.ContentRange != "bytes 2-4/10" {
+		t.Errorf("expected bytes 2-4 but got %q (%s)", data, *resp.ContentRange)
+	}
+
+	other := azcore.ETag(`"0x8D0"`)
+	_, err = client.GetProperties(ctx, &blob.GetPropertiesOptions{
+		AccessConditions: &blob.AccessConditions{ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfMatch: &other}},
+	})
+	if statusOf(err) != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 but got %v", err)
+	}
+
+	_, err = client.DownloadStream(ctx, &blob.DownloadStreamOptions{Range: blob.HTTPRange{Offset: 10}})
+	if statusOf(err) != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("expected 416 but got %v", err)
+	}
+
+	_, err = srv.BlockBlobClient("container", "missing").GetProperties(ctx, nil)
+	if !bloberror.HasCode(err, bloberror.BlobNotFound) {
+		t.Errorf("expected BlobNotFound but got %v", err)
+	}
+}
+
+func TestBlockList(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.CreateContainer("container")
+	client := srv.BlockBlobClient("container", "blob")
+	ctx := context.Background()
+
+	var ids []string
+	for i, data := range []string{"first ", "second"} {
+		id := base64.StdEncoding.EncodeToString([]byte{byte(i)})
+		if _, err := client.StageBlock(ctx, id, streaming.NopCloser(bytes.NewReader([]byte(data))), nil); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		ids = append(ids, id)
+	}
+	if _, ok := srv.GetBlob("container", "blob"); ok {
+		t.Error("expected staged blocks not to be visible")
+	}
+
+	if _, err := client.CommitBlockList(ctx, []string{ids[1], "bWlzc2luZw=="}, nil); err == nil {
+		t.Error("expected committing an unknown block to fail")
+	}
+	resp, err := client.CommitBlockList(ctx, ids, nil)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	b, ok := srv.GetBlob("container", "blob")
+	if !ok || string(b.Data) != "first second" || b.ETag != string(*resp.ETag) {
+		t.Errorf("expected the blocks to be committed but got %v", b)
+	}
+
+	// If-None-Match: * only creates blobs
+	anyETag := azcore.ETagAny
+	_, err = client.Upload(ctx, streaming.NopCloser(bytes.NewReader(nil)), &blockblob.UploadOptions{
+		AccessConditions: &blob.AccessConditions{ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfNoneMatch: &anyETag}},
+	})
+	if !bloberror.HasCode(err, bloberror.ConditionNotMet) {
+		t.Errorf("expected ConditionNotMet but got %v", err)
+	}
+}
+
+func TestAppendPosition(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.CreateContainer("container")
+	client := srv.ServiceClient().NewContainerClient("container").NewAppendBlobClient("blob")
+	ctx := context.Background()
+
+	if _, err := client.Create(ctx, nil); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	appendAt := func(position int64) error {
+		_, err := client.AppendBlock(ctx, streaming.NopCloser(bytes.NewReader([]byte("data"))), &appendblob.AppendBlockOptions{
+			AppendPositionAccessConditions: &appendblob.AppendPositionAccessConditions{AppendPosition: &position},
+		})
+		return err
+	}
+	if err := appendAt(0); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	// a second writer expecting an empty blob must fail
+	if err := appendAt(0); !bloberror.HasCode(err, bloberror.AppendPositionConditionNotMet) {
+		t.Errorf("expected AppendPositionConditionNotMet but got %v", err)
+	}
+	if b, _ := srv.GetBlob("container", "blob"); string(b.Data) != "data" {
+		t.Errorf("expected a single block to be appended but got %q", b.Data)
+	}
+}
@@ -0,0 +1,49 @@
+package azblobfake
+
+import (
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+)
+
+// clientOptions fail fast instead of retrying against a server that is not
+// flaky.
+func clientOptions() policy.ClientOptions {
+	return policy.ClientOptions{Retry: policy.RetryOptions{MaxRetries: -1}}
+}
+
+// Credential returns the shared key of the account of the server.
+func (s *Server) Credential() *blob.SharedKeyCredential {
+	credential, err := blob.NewSharedKeyCredential(Account, Key)
+	if err != nil {
+		panic(err)
+	}
+	return credential
+}
+
+// ConnectionString returns a connection string for the account of the server,
+// e.g. for azblob.NewAzBlobFileReaderWithConnectionString.
+func (s *Server) ConnectionString() string {
+	return "DefaultEndpointsProtocol=http;AccountName=" + Account + ";AccountKey=" + Key + ";BlobEndpoint=" + s.URL + ";"
+}
+
+// ServiceClient returns a client of the account of the server, authenticated
+// with its shared key.
+func (s *Server) ServiceClient() *service.Client {
+	client, err := service.NewClientWithSharedKeyCredential(s.URL+"/", s.Credential(), &service.ClientOptions{ClientOptions: clientOptions()})
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
+
+// BlockBlobClient returns a client of a blob of the server, authenticated with
+// its shared key.
+func (s *Server) BlockBlobClient(containerName, blobName string) *blockblob.Client {
+	client, err := blockblob.NewClientWithSharedKeyCredential(s.BlobURL(containerName, blobName), s.Credential(), &blockblob.ClientOptions{ClientOptions: clientOptions()})
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
@@ -53,7 +53,8 @@ func (bf BufferFile) Open(string) (source.ParquetFile, error) {
 	return NewBufferFileFromBytes(bf.buff), nil
 }
 
-// Seek seeks in the underlying memory buffer.
+// Seek seeks in the underlying memory buffer. Seeking past the end is allowed,
+// a following Write fills the gap with zeros.
 func (bf *BufferFile) Seek(offset int64, whence int) (int64, error) {
 	newLoc := bf.loc
 	switch whence {
@@ -63,30 +64,29 @@ func (bf *BufferFile) Seek(offset int64, whence int) (int64, error) {
 		newLoc += int(offset)
 	case io.SeekEnd:
 		newLoc = len(bf.buff) + int(offset)
+	default:
+		return int64(bf.loc), errors.New("invalid whence")
 	}
 
 	if newLoc < 0 {
 		return int64(bf.loc), errors.New("unable to seek to a location <0")
 	}
 
-	if newLoc > len(bf.buff) {
-		newLoc = len(bf.buff)
-	}
-
 	bf.loc = newLoc
 
 	return int64(bf.loc), nil
 }
 
-// Read reads data form BufferFile into p.
+// Read reads data form BufferFile into p. It returns io.EOF only once there
+// is no data left to read.
 func (bf *BufferFile) Read(p []byte) (n int, err error) {
+	if bf.loc >= len(bf.buff) {
+		return 0, io.EOF
+	}
+
 	n = copy(p, bf.buff[bf.loc:len(bf.buff)])
 	bf.loc += n
 
-	if bf.loc == len(bf.buff) {
-		return n, io.EOF
-	}
-
 	return n, nil
 }
 
@@ -99,8 +99,12 @@ func (bf *BufferFile) Write(p []byte) (n int, err error) {
 		if addCap < len(p) {
 			addCap = len(p)
 		}
+		newCap := cap(bf.buff) + addCap
+		if newCap < bf.loc+len(p) {
+			newCap = bf.loc + len(p)
+		}
 
-		newBuff := make([]byte, len(bf.buff), cap(bf.buff)+addCap)
+		newBuff := make([]byte, len(bf.buff), newCap)
 
 		copy(newBuff, bf.buff)
 
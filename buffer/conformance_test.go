@@ -0,0 +1,27 @@
+package buffer
+
+import (
+	"testing"
+
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"github.com/xitongsys/parquet-go-source/sourcetest"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+func TestConformance(t *testing.T) {
+	files := map[string]*BufferFile{}
+	sourcetest.RunConformance(t, sourcetest.Factory{
+		Open: func(name string) (source.ParquetFile, error) {
+			file, ok := files[name]
+			if !ok {
+				return nil, sourceerrors.ErrNotFound
+			}
+			return file.Open("")
+		},
+		Create: func(name string) (source.ParquetFile, error) {
+			files[name] = NewBufferFile()
+			return files[name], nil
+		},
+		SingleObject: true,
+	})
+}
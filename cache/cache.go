@@ -0,0 +1,263 @@
+// Package cache wraps a ParquetFile reader with a block cache.
+//
+// Reads are served from fixed-size blocks aligned on multiples of the block
+// size, which are fetched from the wrapped reader on first use and kept in a
+// Store. Readers created with Open("") share the cache of their parent and
+// wait for each other instead of fetching the same block twice.
+package cache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+const (
+	// DefaultBlockSize is the block size used when none is set.
+	DefaultBlockSize = 1 << 20
+	// DefaultMemorySize is the limit of a MemoryStore created with a limit of zero.
+	DefaultMemorySize = 64 << 20
+	// DefaultDiskSize is the limit of a DiskStore created with a limit of zero.
+	DefaultDiskSize = 1 << 30
+)
+
+// Identifier is implemented by readers that can name the object version they
+// read. Identity returns a string made of the backend, the object and its
+// version (ETag, generation, ...), or "" if the version is unknown.
+type Identifier interface {
+	Identity() string
+}
+
+var (
+	errWhence        = errors.New("Seek: invalid whence")
+	errInvalidOffset = errors.New("Seek: invalid offset")
+)
+
+// CacheFileReaderParams contains fields used to configure a CacheFile
+type CacheFileReaderParams struct {
+	// Store holds the cached blocks and may be shared between readers of
+	// different objects. Defaults to a new MemoryStore of DefaultMemorySize
+	// shared by the reader and its clones. Optional.
+	Store Store
+	// BlockSize is the size of the blocks read from the wrapped file. Defaults
+	// to DefaultBlockSize. Optional.
+	BlockSize int64
+	// Key identifies the object and its version in the Store. Defaults to the
+	// Identity of the wrapped file if it implements Identifier. Blocks of files
+	// without a key are only shared by the reader and its clones. Optional.
+	Key string
+}
+
+// CacheFile is a read-only ParquetFile serving reads from a block cache
+type CacheFile struct {
+	file   source.ParquetFile
+	shared *shared
+	offset int64
+}
+
+// shared is the state common to a CacheFile and its clones.
+type shared struct {
+	params CacheFileReaderParams
+	prefix string
+	size   int64
+
+	lock  sync.Mutex
+	calls map[int64]*call
+}
+
+// call is an in-flight block fetch.
+type call struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// NewCacheFileReader wraps the reader file with a block cache. The CacheFile
+// owns file and closes it on Close.
+func NewCacheFileReader(file source.ParquetFile, params CacheFileReaderParams) (source.ParquetFile, error) {
+	if params.BlockSize <= 0 {
+		params.BlockSize = DefaultBlockSize
+	}
+	if params.Store == nil {
+		params.Store = NewMemoryStore(0)
+	}
+
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	key := params.Key
+	if id, ok := file.(Identifier); ok && key == "" {
+		key = id.Identity()
+	}
+	if key == "" {
+		// unique to this reader and its clones
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		key = "anonymous:" + hex.EncodeToString(b)
+	}
+
+	return &CacheFile{
+		file: file,
+		shared: &shared{
+			params: params,
+			prefix: fmt.Sprintf("%s#%d#%d#", key, size, params.BlockSize),
+			size:   size,
+			calls:  map[int64]*call{},
+		},
+	}, nil
+}
+
+// Seek sets the offset for the next Read. Seeking past the end is allowed,
+// the next Read returns io.EOF.
+func (c *CacheFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += c.offset
+	case io.SeekEnd:
+		offset += c.shared.size
+	default:
+		return 0, errWhence
+	}
+
+	if offset < 0 {
+		return 0, errInvalidOffset
+	}
+	c.offset = offset
+
+	return c.offset, nil
+}
+
+// Read fills p from cached blocks unless the end of the file is reached.
+func (c *CacheFile) Read(p []byte) (n int, err error) {
+	if c.offset >= c.shared.size {
+		return 0, io.EOF
+	}
+
+	blockSize := c.shared.params.BlockSize
+	for n < len(p) && c.offset < c.shared.size {
+		index := c.offset / blockSize
+		data, err := c.block(index)
+		if err != nil {
+			return n, err
+		}
+
+		start := c.offset - index*blockSize
+		if start >= int64(len(data)) {
+			// the file is shorter than its size claimed
+			break
+		}
+		m := copy(p[n:], data[start:])
+		n += m
+		c.offset += int64(m)
+	}
+
+	if n == 0 && len(p) > 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// block returns the block at index from the store, fetching it if needed.
+// Concurrent clones asking for the same block wait for a single fetch.
+func (c *CacheFile) block(index int64) ([]byte, error) {
+	s := c.shared
+	key := s.prefix + fmt.Sprint(index)
+	if data, ok := s.params.Store.Get(key); ok {
+		return data, nil
+	}
+
+	s.lock.Lock()
+	if cl, ok := s.calls[index]; ok {
+		s.lock.Unlock()
+		<-cl.done
+		return cl.data, cl.err
+	}
+	// a fetch may have completed since the first lookup
+	if data, ok := s.params.Store.Get(key); ok {
+		s.lock.Unlock()
+		return data, nil
+	}
+	cl := &call{done: make(chan struct{})}
+	s.calls[index] = cl
+	s.lock.Unlock()
+
+	cl.data, cl.err = c.fetch(index)
+	if cl.err == nil {
+		s.params.Store.Put(key, cl.data)
+	}
+
+	s.lock.Lock()
+	delete(s.calls, index)
+	s.lock.Unlock()
+	close(cl.done)
+
+	return cl.data, cl.err
+}
+
+// fetch reads the block at index from the wrapped file.
+func (c *CacheFile) fetch(index int64) ([]byte, error) {
+	offset := index * c.shared.params.BlockSize
+	length := c.shared.size - offset
+	if length > c.shared.params.BlockSize {
+		length = c.shared.params.BlockSize
+	}
+
+	if _, err := c.file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data := make([]byte, length)
+	n, err := io.ReadFull(c.file, data)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		err = nil
+	}
+	return data[:n], err
+}
+
+// Open returns a reader sharing the cache of c if name is empty, or a new
+// CacheFile with the same params for another file.
+func (c *CacheFile) Open(name string) (source.ParquetFile, error) {
+	file, err := c.file.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if name != "" {
+		params := c.shared.params
+		params.Key = ""
+		return NewCacheFileReader(file, params)
+	}
+
+	return &CacheFile{
+		file:   file,
+		shared: c.shared,
+	}, nil
+}
+
+// Create is not supported
+func (c *CacheFile) Create(_ string) (source.ParquetFile, error) {
+	return nil, sourceerrors.Wrap(sourceerrors.ErrNotSupported, errors.New("CacheFile does not support Create()"))
+}
+
+// Write is not supported
+func (c *CacheFile) Write(_ []byte) (int, error) {
+	return 0, sourceerrors.Wrap(sourceerrors.ErrNotSupported, errors.New("CacheFile does not support Write()"))
+}
+
+// Close closes the wrapped file
+func (c *CacheFile) Close() error {
+	return c.file.Close()
+}
@@ -0,0 +1,231 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// countingFile is a read-only ParquetFile over data counting the reads made
+// by itself and its clones.
+type countingFile struct {
+	*bytes.Reader
+	data  []byte
+	id    string
+	reads *int32
+}
+
+func newCountingFile(data []byte, id string) *countingFile {
+	return &countingFile{Reader: bytes.NewReader(data), data: data, id: id, reads: new(int32)}
+}
+
+func (f *countingFile) Read(p []byte) (int, error) {
+	atomic.AddInt32(f.reads, 1)
+	// give concurrent clones a chance to ask for the same block
+	time.Sleep(time.Millisecond)
+	return f.Reader.Read(p)
+}
+
+func (f *countingFile) Open(_ string) (source.ParquetFile, error) {
+	return &countingFile{Reader: bytes.NewReader(f.data), data: f.data, id: f.id, reads: f.reads}, nil
+}
+
+func (f *countingFile) Identity() string {
+	return f.id
+}
+
+func (f *countingFile) Create(string) (source.ParquetFile, error) {
+	return nil, errors.New("read-only")
+}
+
+func (f *countingFile) Write([]byte) (int, error) {
+	return 0, errors.New("read-only")
+}
+
+func (f *countingFile) Close() error {
+	return nil
+}
+
+func testData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+func TestConcurrentClonesShareFetches(t *testing.T) {
+	data := testData(10000)
+	file := newCountingFile(data, "")
+	r, err := NewCacheFileReader(file, CacheFileReaderParams{BlockSize: 1000})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		clone, err := r.Open("")
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		wg.Add(1)
+		go func(clone source.ParquetFile) {
+			defer wg.Done()
+			got, err := ioutil.ReadAll(clone)
+			if err != nil {
+				t.Errorf("expected error to be nil but got %q", err.Error())
+			}
+			if !bytes.Equal(got, data) {
+				t.Error("clone read unexpected data")
+			}
+		}(clone)
+	}
+	wg.Wait()
+
+	if reads := atomic.LoadInt32(file.reads); reads != 10 {
+		t.Errorf("expected 10 block reads but got %d", reads)
+	}
+}
+
+func TestSharedStore(t *testing.T) {
+	data := testData(2500)
+	store := NewMemoryStore(0)
+	params := CacheFileReaderParams{Store: store, BlockSize: 1000}
+
+	first := newCountingFile(data, "object#v1")
+	r, err := NewCacheFileReader(first, params)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if _, err = ioutil.ReadAll(r); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if *first.reads != 3 {
+		t.Errorf("expected 3 block reads but got %d", *first.reads)
+	}
+	if store.Size() != 2500 {
+		t.Errorf("expected store to hold 2500 bytes but got %d", store.Size())
+	}
+
+	// same version, served from the store
+	second := newCountingFile(data, "object#v1")
+	if r, err = NewCacheFileReader(second, params); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if !bytes.Equal(got, data) || *second.reads != 0 {
+		t.Errorf("expected cached data without reads but got %d reads", *second.reads)
+	}
+
+	// new version, fetched again
+	changed := testData(2500)
+	changed[0]++
+	third := newCountingFile(changed, "object#v2")
+	if r, err = NewCacheFileReader(third, params); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if got, err = ioutil.ReadAll(r); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if !bytes.Equal(got, changed) || *third.reads != 3 {
+		t.Errorf("expected new version to be read but got %d reads", *third.reads)
+	}
+}
+
+func TestReadAcrossBlocks(t *testing.T) {
+	data := testData(2500)
+	r, err := NewCacheFileReader(newCountingFile(data, ""), CacheFileReaderParams{BlockSize: 1000})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	if _, err = r.Seek(900, io.SeekStart); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	p := make([]byte, 1200)
+	n, err := r.Read(p)
+	if err != nil || n != 1200 || !bytes.Equal(p, data[900:2100]) {
+		t.Errorf("expected 1200 bytes from offset 900 but got %d, %v", n, err)
+	}
+
+	n, err = r.Read(p)
+	if err != nil || n != 400 || !bytes.Equal(p[:n], data[2100:]) {
+		t.Errorf("expected final 400 bytes but got %d, %v", n, err)
+	}
+	if n, err = r.Read(p); n != 0 || err != io.EOF {
+		t.Errorf("expected io.EOF but got %d, %v", n, err)
+	}
+}
+
+func TestMemoryStoreEviction(t *testing.T) {
+	store := NewMemoryStore(250)
+	for _, key := range []string{"a", "b", "a", "c"} {
+		store.Put(key, make([]byte, 100))
+	}
+
+	if _, ok := store.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := store.Get(key); !ok {
+			t.Errorf("expected %s to be cached", key)
+		}
+	}
+	if store.Size() != 200 {
+		t.Errorf("expected store to hold 200 bytes but got %d", store.Size())
+	}
+
+	store.Put("big", make([]byte, 300))
+	if _, ok := store.Get("big"); ok {
+		t.Error("expected block larger than the store not to be cached")
+	}
+}
+
+func TestDiskStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskStore(dir, 250)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	store.Put("a", []byte("first"))
+	store.Put("b", bytes.Repeat([]byte("b"), 100))
+	store.Put("c", bytes.Repeat([]byte("c"), 100))
+	if got, ok := store.Get("a"); !ok || string(got) != "first" {
+		t.Errorf("expected a to be cached but got %q, %v", got, ok)
+	}
+	store.Put("d", bytes.Repeat([]byte("d"), 100))
+	if _, ok := store.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if len(files) != 3 {
+		t.Errorf("expected 3 files in the store but got %d", len(files))
+	}
+
+	// a new store picks up the blocks left in the directory
+	reopened, err := NewDiskStore(dir, 250)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if reopened.Size() != store.Size() {
+		t.Errorf("expected reopened store to hold %d bytes but got %d", store.Size(), reopened.Size())
+	}
+	if got, ok := reopened.Get("d"); !ok || string(got) != string(bytes.Repeat([]byte("d"), 100)) {
+		t.Errorf("expected d to be cached after reopening")
+	}
+}
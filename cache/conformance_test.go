@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go-source/sourcetest"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+func TestConformance(t *testing.T) {
+	for _, blockSize := range []int64{1000, DefaultBlockSize} {
+		blockSize := blockSize
+		t.Run(fmt.Sprintf("BlockSize=%d", blockSize), func(t *testing.T) {
+			dir := t.TempDir()
+			sourcetest.RunConformance(t, sourcetest.Factory{
+				Open: func(name string) (source.ParquetFile, error) {
+					file, err := local.NewLocalFileReader(name)
+					if err != nil {
+						return nil, err
+					}
+					return NewCacheFileReader(file, CacheFileReaderParams{BlockSize: blockSize})
+				},
+				Put: func(name string, data []byte) error {
+					w, err := local.NewLocalFileWriter(name)
+					if err != nil {
+						return err
+					}
+					if _, err = w.Write(data); err != nil {
+						return err
+					}
+					return w.Close()
+				},
+				Path: func(name string) string {
+					return filepath.Join(dir, name)
+				},
+			})
+		})
+	}
+}
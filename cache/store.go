@@ -0,0 +1,253 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store holds cached blocks. Stores are best effort: a block that cannot be
+// kept is simply fetched again. Implementations must be safe for concurrent
+// use and must not modify the slices passed to Put or returned by Get.
+type Store interface {
+	Get(key string) ([]byte, bool)
+	Put(key string, data []byte)
+}
+
+// MemoryStore keeps blocks in memory, evicting the least recently used ones
+// once it holds more than its limit.
+type MemoryStore struct {
+	maxBytes int64
+
+	lock    sync.Mutex
+	size    int64
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type memoryEntry struct {
+	key  string
+	data []byte
+}
+
+// NewMemoryStore returns a MemoryStore holding up to maxBytes of blocks. A
+// limit of zero selects DefaultMemorySize.
+func NewMemoryStore(maxBytes int64) *MemoryStore {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMemorySize
+	}
+	return &MemoryStore{
+		maxBytes: maxBytes,
+		entries:  map[string]*list.Element{},
+		lru:      list.New(),
+	}
+}
+
+// Get returns the block stored under key.
+func (m *MemoryStore) Get(key string) ([]byte, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	el, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	m.lru.MoveToFront(el)
+	return el.Value.(*memoryEntry).data, true
+}
+
+// Put stores data under key. Blocks larger than the limit are not stored.
+func (m *MemoryStore) Put(key string, data []byte) {
+	if int64(len(data)) > m.maxBytes {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if el, ok := m.entries[key]; ok {
+		m.size -= int64(len(el.Value.(*memoryEntry).data))
+		m.lru.Remove(el)
+	}
+	m.entries[key] = m.lru.PushFront(&memoryEntry{key: key, data: data})
+	m.size += int64(len(data))
+
+	for m.size > m.maxBytes {
+		el := m.lru.Back()
+		e := el.Value.(*memoryEntry)
+		m.lru.Remove(el)
+		delete(m.entries, e.key)
+		m.size -= int64(len(e.data))
+	}
+}
+
+// Size returns the number of bytes held.
+func (m *MemoryStore) Size() int64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.size
+}
+
+// DiskStore keeps blocks as files in a directory, evicting the least
+// recently used ones once it holds more than its limit. Blocks already in the
+// directory are picked up when the store is created, so a cache directory can
+// be reused across processes.
+type DiskStore struct {
+	dir      string
+	maxBytes int64
+
+	lock    sync.Mutex
+	size    int64
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type diskEntry struct {
+	name string
+	size int64
+}
+
+const (
+	diskSuffix = ".block"
+	tempPrefix = "tmp-"
+)
+
+// NewDiskStore returns a DiskStore keeping up to maxBytes of blocks in dir,
+// creating the directory if needed. A limit of zero selects DefaultDiskSize.
+func NewDiskStore(dir string, maxBytes int64) (*DiskStore, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultDiskSize
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DiskStore{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  map[string]*list.Element{},
+		lru:      list.New(),
+	}
+
+	// most recently used first
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().After(infos[j].ModTime())
+	})
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, diskSuffix) {
+			if strings.HasPrefix(name, tempPrefix) {
+				// left behind by an interrupted Put
+				os.Remove(filepath.Join(dir, name))
+			}
+			continue
+		}
+		d.entries[name] = d.lru.PushBack(&diskEntry{name: name, size: info.Size()})
+		d.size += info.Size()
+	}
+
+	d.lock.Lock()
+	d.evict()
+	d.lock.Unlock()
+
+	return d, nil
+}
+
+func diskName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:]) + diskSuffix
+}
+
+// Get returns the block stored under key.
+func (d *DiskStore) Get(key string) ([]byte, bool) {
+	name := diskName(key)
+
+	d.lock.Lock()
+	el, ok := d.entries[name]
+	if ok {
+		d.lru.MoveToFront(el)
+	}
+	d.lock.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	path := filepath.Join(d.dir, name)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		// evicted in the meantime or removed from outside
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return data, true
+}
+
+// Put stores data under key. Blocks larger than the limit or that cannot be
+// written are not stored.
+func (d *DiskStore) Put(key string, data []byte) {
+	if int64(len(data)) > d.maxBytes {
+		return
+	}
+
+	f, err := ioutil.TempFile(d.dir, tempPrefix)
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return
+	}
+
+	name := diskName(key)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if err := os.Rename(f.Name(), filepath.Join(d.dir, name)); err != nil {
+		os.Remove(f.Name())
+		return
+	}
+	if el, ok := d.entries[name]; ok {
+		d.size -= el.Value.(*diskEntry).size
+		d.lru.Remove(el)
+	}
+	d.entries[name] = d.lru.PushFront(&diskEntry{name: name, size: int64(len(data))})
+	d.size += int64(len(data))
+	d.evict()
+}
+
+// Size returns the number of bytes held.
+func (d *DiskStore) Size() int64 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.size
+}
+
+// evict removes the least recently used blocks beyond the limit. It must be
+// called with the lock held.
+func (d *DiskStore) evict() {
+	for d.size > d.maxBytes {
+		el := d.lru.Back()
+		e := el.Value.(*diskEntry)
+		d.lru.Remove(el)
+		delete(d.entries, e.name)
+		d.size -= e.size
+		os.Remove(filepath.Join(d.dir, e.name))
+	}
+}
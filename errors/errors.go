@@ -0,0 +1,216 @@
+// Package errors defines the error values shared by all backends of this
+// module, so that callers can handle failures without knowing which storage
+// SDK produced them:
+//
+//	if errors.Is(err, sourceerrors.ErrNotFound) {
+//		...
+//	}
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+)
+
+// The kinds of failures callers are expected to handle. Errors returned by
+// the backends match them with errors.Is, while errors.As still reaches the
+// error of the storage SDK.
+var (
+	// ErrNotFound is matched when the object, bucket or container does not
+	// exist.
+	ErrNotFound = errors.New("object not found")
+	// ErrPermissionDenied is matched when the credentials are missing or not
+	// allowed to perform the operation.
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrPreconditionFailed is matched when a condition of the request, such
+	// as the version of the object, does not hold.
+	ErrPreconditionFailed = errors.New("precondition failed")
+	// ErrThrottled is matched when the storage rejected the request because of
+	// its rate or a temporary overload.
+	ErrThrottled = errors.New("request throttled")
+	// ErrNotSupported is matched when the operation is not supported by the
+	// backend or the server, e.g. Write on a reader.
+	ErrNotSupported = errors.New("operation not supported")
+)
+
+// codeKinds maps the error codes of the storage services to kinds.
+var codeKinds = map[string]error{
+	// S3
+	"NoSuchKey":             ErrNotFound,
+	"NoSuchBucket":          ErrNotFound,
+	"NoSuchVersion":         ErrNotFound,
+	"NotFound":              ErrNotFound,
+	"AccessDenied":          ErrPermissionDenied,
+	"Forbidden":             ErrPermissionDenied,
+	"InvalidAccessKeyId":    ErrPermissionDenied,
+	"SignatureDoesNotMatch": ErrPermissionDenied,
+	"PreconditionFailed":    ErrPreconditionFailed,
+	"SlowDown":              ErrThrottled,
+	"Throttling":            ErrThrottled,
+	"ThrottlingException":   ErrThrottled,
+	"RequestLimitExceeded":  ErrThrottled,
+	"NotImplemented":        ErrNotSupported,
+	// Azure
+	"BlobNotFound":                    ErrNotFound,
+	"ContainerNotFound":               ErrNotFound,
+	"ResourceNotFound":                ErrNotFound,
+	"AuthenticationFailed":            ErrPermissionDenied,
+	"AuthorizationFailure":            ErrPermissionDenied,
+	"AuthorizationPermissionMismatch": ErrPermissionDenied,
+	"ConditionNotMet":                 ErrPreconditionFailed,
+	"BlobAlreadyExists":               ErrPreconditionFailed,
+	"ServerBusy":                      ErrThrottled,
+	"UnsupportedHeader":               ErrNotSupported,
+}
+
+// Error attaches one of the kinds above to the error of a backend. Its message
+// is the one of the wrapped error.
+type Error struct {
+	// Kind is one of the sentinel errors of this package.
+	Kind error
+	// Err is the error returned by the storage.
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Is makes errors.Is(err, e.Kind) match.
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Unwrap returns the error of the storage.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap annotates err with kind. It returns err unchanged if it is nil, kind is
+// nil or err already matches kind.
+func Wrap(kind, err error) error {
+	if err == nil || kind == nil || errors.Is(err, kind) {
+		return err
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// KindOfStatus returns the kind of a failed HTTP response with the given
+// status, or nil if it has none.
+func KindOfStatus(status int) error {
+	switch status {
+	case http.StatusNotFound, http.StatusGone:
+		return ErrNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrPermissionDenied
+	case http.StatusPreconditionFailed:
+		return ErrPreconditionFailed
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return ErrThrottled
+	case http.StatusNotImplemented, http.StatusMethodNotAllowed:
+		return ErrNotSupported
+	}
+	return nil
+}
+
+// KindOfCode returns the kind of an error code of S3 or Azure, or nil if it has
+// none.
+func KindOfCode(code string) error {
+	return codeKinds[code]
+}
+
+// awsError is implemented by errors of aws-sdk-go.
+type awsError interface {
+	Code() string
+}
+
+// apiError is implemented by service errors of aws-sdk-go-v2.
+type apiError interface {
+	ErrorCode() string
+}
+
+// statusCoder is implemented by request failures of aws-sdk-go.
+type statusCoder interface {
+	StatusCode() int
+}
+
+// httpStatusCoder is implemented by response errors of aws-sdk-go-v2.
+type httpStatusCoder interface {
+	HTTPStatusCode() int
+}
+
+// Classify annotates err with its kind when it can be told without knowing the
+// storage SDK: file system errors, and errors exposing an S3 error code or an
+// HTTP status through methods. Other errors, including io.EOF, are returned
+// unchanged.
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return Wrap(ErrNotFound, err)
+	case errors.Is(err, fs.ErrPermission):
+		return Wrap(ErrPermissionDenied, err)
+	}
+
+	var awsErr awsError
+	if errors.As(err, &awsErr) {
+		if kind := KindOfCode(awsErr.Code()); kind != nil {
+			return Wrap(kind, err)
+		}
+	}
+	var apiErr apiError
+	if errors.As(err, &apiErr) {
+		if kind := KindOfCode(apiErr.ErrorCode()); kind != nil {
+			return Wrap(kind, err)
+		}
+	}
+	var failure statusCoder
+	if errors.As(err, &failure) {
+		return Wrap(KindOfStatus(failure.StatusCode()), err)
+	}
+	var httpErr httpStatusCoder
+	if errors.As(err, &httpErr) {
+		return Wrap(KindOfStatus(httpErr.HTTPStatusCode()), err)
+	}
+	return err
+}
+
+// ErrObjectChanged is matched by errors returned when an object was
+// overwritten or deleted after it was opened for reading.
+var ErrObjectChanged = errors.New("object changed since it was opened")
+
+// ObjectChangedError is returned by readers that pin the version of the object
+// they opened when a later read finds another version.
+type ObjectChangedError struct {
+	// Name identifies the object, e.g. bucket/key or its URL.
+	Name string
+	// Version is the ETag, generation or version ID seen when the object was
+	// opened.
+	Version string
+	// Err is the error returned by the storage, if any.
+	Err error
+}
+
+func (e *ObjectChangedError) Error() string {
+	msg := fmt.Sprintf("%s: %s (opened version %s)", e.Name, ErrObjectChanged, e.Version)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Is makes errors.Is(err, ErrObjectChanged) and
+// errors.Is(err, ErrPreconditionFailed) match.
+func (e *ObjectChangedError) Is(target error) bool {
+	return target == ErrObjectChanged || target == ErrPreconditionFailed
+}
+
+// Unwrap returns the error of the storage.
+func (e *ObjectChangedError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,73 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+func TestClassify(t *testing.T) {
+	_, notExist := os.Open("does-not-exist")
+
+	cases := []struct {
+		err  error
+		kind error
+	}{
+		{notExist, ErrNotFound},
+		{&os.PathError{Op: "open", Path: "f", Err: os.ErrPermission}, ErrPermissionDenied},
+		{awserr.New("NoSuchKey", "not found", nil), ErrNotFound},
+		{awserr.NewRequestFailure(awserr.New("NotFound", "", nil), http.StatusNotFound, "id"), ErrNotFound},
+		{awserr.NewRequestFailure(awserr.New("Unknown", "", nil), http.StatusForbidden, "id"), ErrPermissionDenied},
+		{awserr.New("SlowDown", "slow down", nil), ErrThrottled},
+		{&smithyhttp.ResponseError{Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusPreconditionFailed}}}, ErrPreconditionFailed},
+		{fmt.Errorf("wrapped: %w", &smithyhttp.ResponseError{Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusNotImplemented}}}), ErrNotSupported},
+	}
+
+	for _, c := range cases {
+		err := Classify(c.err)
+		if !errors.Is(err, c.kind) {
+			t.Errorf("Classify(%v): expected %v but got %v", c.err, c.kind, err)
+		}
+		if err.Error() != c.err.Error() {
+			t.Errorf("Classify(%v): expected the message to be kept but got %q", c.err, err.Error())
+		}
+	}
+
+	for _, err := range []error{nil, io.EOF, errors.New("boom")} {
+		if got := Classify(err); got != err {
+			t.Errorf("Classify(%v): expected the error unchanged but got %v", err, got)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	cause := awserr.New("NoSuchKey", "not found", nil)
+	err := Wrap(ErrNotFound, cause)
+
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) || awsErr != cause {
+		t.Errorf("expected errors.As to reach the SDK error but got %v", err)
+	}
+	if errors.Is(err, ErrThrottled) {
+		t.Error("expected the error not to match another kind")
+	}
+	if again := Wrap(ErrNotFound, err); again != err {
+		t.Errorf("expected an error of the same kind not to be wrapped again but got %v", again)
+	}
+	if Wrap(ErrNotFound, nil) != nil {
+		t.Error("expected a nil error to stay nil")
+	}
+}
+
+func TestObjectChangedError(t *testing.T) {
+	err := fmt.Errorf("read: %w", &ObjectChangedError{Name: "bucket/key", Version: `"abc"`})
+	if !errors.Is(err, ErrObjectChanged) || !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expected %v to match ErrObjectChanged and ErrPreconditionFailed", err)
+	}
+}
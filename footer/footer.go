@@ -0,0 +1,153 @@
+// Package footer prefetches and caches the trailing bytes of remote objects.
+//
+// parquet-go starts reading a file by seeking to its end for the 4-byte footer
+// length and then for the footer itself, and every reader cloned through
+// Open("") repeats this. Remote backends accept a *Cache to fetch the last
+// bytes of an object in a single request when it is opened, and serve all
+// later reads in that range from memory.
+package footer
+
+import (
+	"container/list"
+	"sync"
+)
+
+const (
+	// DefaultSize is the number of trailing bytes fetched per object when the
+	// cache is created with a size of zero.
+	DefaultSize = 64 << 10
+	// DefaultEntries is the number of objects kept when the cache is created
+	// with a limit of zero.
+	DefaultEntries = 1024
+)
+
+// Key identifies one version of an object. Backend and Name identify the
+// object, Version is its ETag, generation or version ID.
+type Key struct {
+	Backend string
+	Name    string
+	Version string
+	Size    int64
+}
+
+// Tail holds the last bytes of an object.
+type Tail struct {
+	// Offset is the position of Data[0] in the object.
+	Offset int64
+	Data   []byte
+}
+
+// ReadAt copies the cached bytes at off into p. ok is false if off lies
+// before the cached range, in which case the caller must read from the
+// backend. Since the tail ends with the object, a read starting inside it is
+// always served in full. ReadAt may be called on a nil *Tail.
+func (t *Tail) ReadAt(p []byte, off int64) (n int, ok bool) {
+	if t == nil || off < t.Offset || off > t.Offset+int64(len(t.Data)) {
+		return 0, false
+	}
+	return copy(p, t.Data[off-t.Offset:]), true
+}
+
+// FetchFunc reads length bytes starting at offset from an object.
+type FetchFunc func(offset, length int64) ([]byte, error)
+
+// Cache shares the tails of objects between all readers of the same object
+// version. It is safe for concurrent use.
+type Cache struct {
+	size       int64
+	maxEntries int
+
+	lock    sync.Mutex
+	entries map[Key]*list.Element
+	lru     *list.List
+}
+
+type entry struct {
+	key   Key
+	ready chan struct{}
+	tail  *Tail
+	err   error
+}
+
+// NewCache returns a cache that prefetches size bytes per object and keeps the
+// tails of up to maxEntries objects. Zero values select DefaultSize and
+// DefaultEntries.
+func NewCache(size int64, maxEntries int) *Cache {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	if maxEntries <= 0 {
+		maxEntries = DefaultEntries
+	}
+	return &Cache{
+		size:       size,
+		maxEntries: maxEntries,
+		entries:    map[Key]*list.Element{},
+		lru:        list.New(),
+	}
+}
+
+// Size returns the number of trailing bytes fetched per object.
+func (c *Cache) Size() int64 {
+	return c.size
+}
+
+// Get returns the tail of the object identified by key, calling fetch at most
+// once for concurrent callers asking for the same key. Objects without a
+// version are fetched but not stored, as a later open could not tell whether
+// they were overwritten; readers share such a tail through Open("") only.
+func (c *Cache) Get(key Key, fetch FetchFunc) (*Tail, error) {
+	if key.Version == "" {
+		return c.fetch(key, fetch)
+	}
+
+	c.lock.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(el)
+		e := el.Value.(*entry)
+		c.lock.Unlock()
+
+		<-e.ready
+		return e.tail, e.err
+	}
+
+	e := &entry{key: key, ready: make(chan struct{})}
+	c.entries[key] = c.lru.PushFront(e)
+	c.evict()
+	c.lock.Unlock()
+
+	e.tail, e.err = c.fetch(key, fetch)
+	close(e.ready)
+
+	if e.err != nil {
+		c.lock.Lock()
+		if el, ok := c.entries[key]; ok && el.Value == e {
+			c.lru.Remove(el)
+			delete(c.entries, key)
+		}
+		c.lock.Unlock()
+	}
+	return e.tail, e.err
+}
+
+func (c *Cache) fetch(key Key, fetch FetchFunc) (*Tail, error) {
+	offset := key.Size - c.size
+	if offset < 0 {
+		offset = 0
+	}
+	data, err := fetch(offset, key.Size-offset)
+	if err != nil {
+		return nil, err
+	}
+	return &Tail{Offset: offset, Data: data}, nil
+}
+
+// evict drops the least recently used entries beyond maxEntries. It must be
+// called with the lock held.
+func (c *Cache) evict() {
+	for c.lru.Len() > c.maxEntries {
+		el := c.lru.Back()
+		c.lru.Remove(el)
+		delete(c.entries, el.Value.(*entry).key)
+	}
+}
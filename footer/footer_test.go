@@ -0,0 +1,149 @@
+package footer
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func fetchFrom(data []byte, calls *int32) FetchFunc {
+	return func(offset, length int64) ([]byte, error) {
+		atomic.AddInt32(calls, 1)
+		return append([]byte(nil), data[offset:offset+length]...), nil
+	}
+}
+
+func TestTailReadAt(t *testing.T) {
+	tail := &Tail{Offset: 10, Data: []byte("0123456789")}
+
+	cases := []struct {
+		off  int64
+		size int
+		want string
+		ok   bool
+	}{
+		{off: 9, size: 4, ok: false},
+		{off: 10, size: 4, want: "0123", ok: true},
+		{off: 16, size: 10, want: "6789", ok: true},
+		{off: 20, size: 4, want: "", ok: true},
+		{off: 21, size: 4, ok: false},
+	}
+
+	for _, c := range cases {
+		p := make([]byte, c.size)
+		n, ok := tail.ReadAt(p, c.off)
+		if ok != c.ok {
+			t.Errorf("ReadAt(%d): expected ok to be %v but got %v", c.off, c.ok, ok)
+			continue
+		}
+		if got := string(p[:n]); ok && got != c.want {
+			t.Errorf("ReadAt(%d): expected %q but got %q", c.off, c.want, got)
+		}
+	}
+
+	var nilTail *Tail
+	if _, ok := nilTail.ReadAt(make([]byte, 4), 0); ok {
+		t.Error("expected nil tail to miss")
+	}
+}
+
+func TestCacheGet(t *testing.T) {
+	data := []byte("abcdefghijklmnopqrstuvwxyz")
+	c := NewCache(8, 0)
+	key := Key{Backend: "test", Name: "a", Version: "v1", Size: int64(len(data))}
+
+	var calls int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tail, err := c.Get(key, fetchFrom(data, &calls))
+			if err != nil {
+				t.Errorf("expected error to be nil but got %q", err.Error())
+				return
+			}
+			if tail.Offset != 18 || string(tail.Data) != "stuvwxyz" {
+				t.Errorf("unexpected tail %d %q", tail.Offset, tail.Data)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("expected 1 fetch but got %d", calls)
+	}
+
+	// a new version is fetched again
+	key.Version = "v2"
+	if _, err := c.Get(key, fetchFrom(data, &calls)); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 fetches but got %d", calls)
+	}
+}
+
+func TestCacheSmallObject(t *testing.T) {
+	data := []byte("abc")
+	var calls int32
+	tail, err := NewCache(0, 0).Get(Key{Name: "a", Version: "v", Size: 3}, fetchFrom(data, &calls))
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if tail.Offset != 0 || string(tail.Data) != "abc" {
+		t.Errorf("unexpected tail %d %q", tail.Offset, tail.Data)
+	}
+}
+
+func TestCacheUnversioned(t *testing.T) {
+	data := []byte("abcdefghij")
+	c := NewCache(4, 0)
+	key := Key{Name: "a", Size: int64(len(data))}
+
+	var calls int32
+	for i := 0; i < 2; i++ {
+		if _, err := c.Get(key, fetchFrom(data, &calls)); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 fetches but got %d", calls)
+	}
+}
+
+func TestCacheError(t *testing.T) {
+	c := NewCache(4, 0)
+	key := Key{Name: "a", Version: "v", Size: 10}
+
+	failure := errors.New("failure")
+	if _, err := c.Get(key, func(_, _ int64) ([]byte, error) { return nil, failure }); err != failure {
+		t.Fatalf("expected %v but got %v", failure, err)
+	}
+
+	var calls int32
+	if _, err := c.Get(key, fetchFrom(make([]byte, 10), &calls)); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if calls != 1 {
+		t.Errorf("expected failed fetch to be retried but got %d fetches", calls)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	data := []byte("abcdefghij")
+	c := NewCache(4, 2)
+
+	var calls int32
+	for _, name := range []string{"a", "b", "a", "c", "a", "b"} {
+		if _, err := c.Get(Key{Name: name, Version: "v", Size: 10}, fetchFrom(data, &calls)); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+	}
+
+	// a, b, c fetched once each; b evicted by c and fetched again
+	if calls != 4 {
+		t.Errorf("expected 4 fetches but got %d", calls)
+	}
+}
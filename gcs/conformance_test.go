@@ -0,0 +1,70 @@
+package gcs
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/abort"
+	"github.com/xitongsys/parquet-go-source/gcsfake"
+	"github.com/xitongsys/parquet-go-source/sourcetest"
+	"github.com/xitongsys/parquet-go/source"
+	"google.golang.org/api/googleapi"
+)
+
+func TestConformance(t *testing.T) {
+	srv := gcsfake.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("bucket")
+	ctx := context.Background()
+	client := srv.Client(ctx)
+
+	sourcetest.RunConformance(t, sourcetest.Factory{
+		Open: func(name string) (source.ParquetFile, error) {
+			return NewGcsFileReaderWithClient(ctx, client, "project", "bucket", name)
+		},
+		Create: func(name string) (source.ParquetFile, error) {
+			return NewGcsFileWriterWithParams(ctx, "project", "bucket", name, GcsFileWriterParams{
+				Client:       client,
+				VerifyCRC32C: true,
+			})
+		},
+	})
+}
+
+func TestAbort(t *testing.T) {
+	srv := gcsfake.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("bucket")
+	ctx := context.Background()
+	client := srv.Client(ctx)
+
+	// nothing sent yet, and a resumable upload with chunks already sent
+	for _, size := range []int{10, 2*googleapi.MinUploadChunkSize + 10} {
+		w, err := NewGcsFileWriterWithParams(ctx, "project", "bucket", "key", GcsFileWriterParams{
+			Client:    client,
+			ChunkSize: googleapi.MinUploadChunkSize,
+		})
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		if _, err = w.Write(make([]byte, size)); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+
+		cause := errors.New("job failed")
+		if err = abort.Abort(w, cause); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		if _, err = w.Write([]byte("more")); !errors.Is(err, cause) {
+			t.Errorf("expected writes after Abort to fail with the cause but got %v", err)
+		}
+		if err = w.Close(); !errors.Is(err, cause) {
+			t.Errorf("expected Close after Abort to fail with the cause but got %v", err)
+		}
+
+		if _, ok := srv.GetObject("bucket", "key"); ok {
+			t.Errorf("size %d: expected nothing to be published", size)
+		}
+	}
+}
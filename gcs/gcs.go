@@ -2,16 +2,32 @@ package gcs
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strconv"
 
 	"cloud.google.com/go/storage"
 	"github.com/bobg/gcsobj"
+	"github.com/xitongsys/parquet-go-source/abort"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
 	"github.com/xitongsys/parquet-go/source"
+	"google.golang.org/api/googleapi"
 )
 
 // Compile time check that *File implement the source.ParquetFile interface.
 var _ source.ParquetFile = (*File)(nil)
 
+var (
+	errInvalidOffset = errors.New("Seek: invalid offset")
+	errNotReader     = errors.New("Read: file opened for writing")
+	errNotWriter     = errors.New("Write: file not opened for writing")
+	errChecksum      = errors.New("Close: CRC32C checksum mismatch")
+)
+
 // File represents a File that can be read from or written to.
 type File struct {
 	ProjectID  string
@@ -22,39 +38,88 @@ type File struct {
 	gcsReader      *gcsobj.Reader
 	gcsWriter      *storage.Writer
 	object         *storage.ObjectHandle
+	generation     int64
 	ctx            context.Context //nolint:containedctx // Needed to create new readers and writers
 	externalClient bool
+
+	// writing is set for writers until Close or Abort returns
+	writing      bool
+	writerParams GcsFileWriterParams
+	cancelWrite  context.CancelFunc
+	crc          hash.Hash32
+	// pending holds the data of a checksummed upload until it starts
+	pending  []byte
+	abortErr error
+}
+
+// GcsFileWriterParams contains fields used to configure a GCS file writer.
+type GcsFileWriterParams struct {
+	// Client is used for the upload. If nil, a client is created with the
+	// default credentials and closed by Close. Optional.
+	Client *storage.Client
+	// Conditions are the preconditions of the upload, e.g. DoesNotExist to
+	// never replace an existing object or GenerationMatch to replace a known
+	// version only. Close fails with an error matching
+	// sourceerrors.ErrPreconditionFailed if they do not hold. Optional.
+	Conditions storage.Conditions
+	// ChunkSize is the size of the chunks of the resumable upload, see
+	// storage.Writer. Zero keeps the default of the storage package. Optional.
+	ChunkSize int
+	// ContentType of the object. Optional.
+	ContentType string
+	// Metadata of the object. Optional.
+	Metadata map[string]string
+	// KMSKeyName is the Cloud KMS key used to encrypt the object. Optional.
+	KMSKeyName string
+	// VerifyCRC32C makes the writer check the CRC32C checksum of the data
+	// written against the one computed by GCS. Objects of up to ChunkSize bytes
+	// (16 MiB if ChunkSize is zero) are held in memory and uploaded by Close
+	// with their checksum, so GCS rejects a corrupted upload without
+	// publishing it. Larger objects are compared once Close has published
+	// them and deleted if they differ, so a corrupted object is briefly
+	// visible. The error of Close then also matches the error of the delete,
+	// if any. Optional.
+	VerifyCRC32C bool
 }
 
 // NewGcsFileWriter will create a new GCS file writer.
 func NewGcsFileWriter(ctx context.Context, projectID, bucketName, name string) (*File, error) {
-	client, err := storage.NewClient(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create storage client: %w", err)
-	}
-
-	r, err := NewGcsFileWriterWithClient(ctx, client, projectID, bucketName, name)
-	if err != nil {
-		return nil, err
-	}
-
-	// Set externalClient to false so we close it when calling `Close`.
-	r.externalClient = false
-
-	return r, nil
+	return NewGcsFileWriterWithParams(ctx, projectID, bucketName, name, GcsFileWriterParams{})
 }
 
 // NewGcsFileWriter will create a new GCS file writer with the passed client.
 func NewGcsFileWriterWithClient(ctx context.Context, client *storage.Client, projectID, bucketName, name string) (*File, error) {
-	obj := client.Bucket(bucketName).Object(name)
+	return NewGcsFileWriterWithParams(ctx, projectID, bucketName, name, GcsFileWriterParams{Client: client})
+}
 
-	// Close writer to flush changes and force the file to be created
-	writer := obj.NewWriter(ctx)
-	if err := writer.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close writer: %w", err)
+// NewGcsFileWriterWithParams will create a new GCS file writer with the given
+// params. Nothing is uploaded before the first Write, and the object is only
+// published by a successful Close.
+func NewGcsFileWriterWithParams(ctx context.Context, projectID, bucketName, name string, params GcsFileWriterParams) (*File, error) {
+	client := params.Client
+	if client == nil {
+		var err error
+		if client, err = storage.NewClient(ctx); err != nil {
+			return nil, fmt.Errorf("failed to create storage client: %w", err)
+		}
 	}
 
-	return NewGcsFileReaderWithClient(ctx, client, projectID, bucketName, name)
+	f := &File{
+		ProjectID:      projectID,
+		BucketName:     bucketName,
+		FilePath:       name,
+		gcsClient:      client,
+		object:         client.Bucket(bucketName).Object(name),
+		ctx:            ctx,
+		externalClient: params.Client != nil,
+		writing:        true,
+		writerParams:   params,
+	}
+	if params.VerifyCRC32C {
+		f.crc = crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	}
+
+	return f, nil
 }
 
 // NewGcsFileReader will create a new GCS file reader.
@@ -77,23 +142,70 @@ func NewGcsFileReader(ctx context.Context, projectID, bucketName, name string) (
 
 // NewGcsFileReader will create a new GCS file reader with the passed client.
 func NewGcsFileReaderWithClient(ctx context.Context, client *storage.Client, projectID, bucketName, name string) (*File, error) {
-	obj := client.Bucket(bucketName).Object(name)
-
-	reader, err := gcsobj.NewReader(ctx, obj)
+	attrs, err := client.Bucket(bucketName).Object(name).Attrs(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create new reader: %w", err)
+		return nil, fmt.Errorf("failed to create new reader: %w", classify(err))
 	}
 
-	return &File{
+	return newGcsFileReader(ctx, client, projectID, bucketName, name, attrs.Generation)
+}
+
+// newGcsFileReader creates a reader for the given generation of an object. All
+// reads fail with an ObjectChangedError once the object has been overwritten.
+func newGcsFileReader(ctx context.Context, client *storage.Client, projectID, bucketName, name string, generation int64) (*File, error) {
+	obj := client.Bucket(bucketName).Object(name)
+
+	f := &File{
 		ProjectID:      projectID,
 		BucketName:     bucketName,
 		FilePath:       name,
 		gcsClient:      client,
-		gcsReader:      reader,
 		object:         obj,
+		generation:     generation,
 		ctx:            ctx,
 		externalClient: true,
-	}, nil
+	}
+
+	reader, err := gcsobj.NewReader(ctx, obj.If(storage.Conditions{GenerationMatch: generation}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new reader: %w", f.wrapError(err))
+	}
+	f.gcsReader = reader
+
+	return f, nil
+}
+
+// wrapError returns an ObjectChangedError if err reports that the object no
+// longer matches the generation seen when it was opened, and otherwise
+// annotates err with its kind from sourceerrors.
+func (g *File) wrapError(err error) error {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+		return &sourceerrors.ObjectChangedError{
+			Name:    g.BucketName + "/" + g.FilePath,
+			Version: strconv.FormatInt(g.generation, 10),
+			Err:     err,
+		}
+	}
+	return classify(err)
+}
+
+// classify annotates errors of the GCS client with their kind from
+// sourceerrors.
+func classify(err error) error {
+	if errors.Is(err, storage.ErrObjectNotExist) || errors.Is(err, storage.ErrBucketNotExist) {
+		return sourceerrors.Wrap(sourceerrors.ErrNotFound, err)
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return sourceerrors.Wrap(sourceerrors.KindOfStatus(apiErr.Code), err)
+	}
+	return sourceerrors.Classify(err)
+}
+
+// Identity names the object and its generation, e.g. for use as a cache key.
+func (g *File) Identity() string {
+	return fmt.Sprintf("gs://%s/%s#%d", g.BucketName, g.FilePath, g.generation)
 }
 
 // Open will create a new GCS file reader/writer and open the object named as
@@ -108,60 +220,250 @@ func (g *File) Open(name string) (source.ParquetFile, error) {
 		return NewGcsFileReader(g.ctx, g.ProjectID, g.BucketName, name)
 	}
 
+	// clones read the generation opened by g
+	if name == g.FilePath && g.generation != 0 {
+		return newGcsFileReader(g.ctx, g.gcsClient, g.ProjectID, g.BucketName, name, g.generation)
+	}
+
 	return NewGcsFileReaderWithClient(g.ctx, g.gcsClient, g.ProjectID, g.BucketName, name)
 }
 
-// Create will create a new GCS file reader/writer and open the object named as
-// the passed named. If name is left empty the same object as currently opened
-// will be re-opened.
+// Create will create a new GCS file writer for the object named as the passed
+// name, with the params of g if it is a writer. If name is left empty the same
+// object as currently opened will be written.
 func (g *File) Create(name string) (source.ParquetFile, error) {
 	if name == "" {
 		name = g.FilePath
 	}
 
-	if g.gcsClient == nil {
-		return NewGcsFileWriter(g.ctx, g.ProjectID, g.BucketName, name)
-	}
-
-	return NewGcsFileWriterWithClient(g.ctx, g.gcsClient, g.ProjectID, g.BucketName, name)
+	params := g.writerParams
+	params.Client = g.gcsClient
+	return NewGcsFileWriterWithParams(g.ctx, g.ProjectID, g.BucketName, name, params)
 }
 
-// Seek implements io.Seeker.
+// Seek implements io.Seeker. Seeking before the start of the object is an
+// error, seeking past its end is allowed.
 func (g *File) Seek(offset int64, whence int) (int64, error) {
-	return g.gcsReader.Seek(offset, whence)
+	if g.gcsReader == nil {
+		return 0, errNotReader
+	}
+	cur, err := g.gcsReader.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+
+	pos, err := g.gcsReader.Seek(offset, whence)
+	if err != nil {
+		return 0, err
+	}
+	if pos < 0 {
+		if _, err = g.gcsReader.Seek(cur, io.SeekStart); err != nil {
+			return 0, err
+		}
+		return 0, errInvalidOffset
+	}
+
+	return pos, nil
 }
 
-// Read implements io.Reader.
-func (g *File) Read(b []byte) (int, error) {
-	return g.gcsReader.Read(b)
+// Read implements io.Reader. It fills b unless the end of the object is
+// reached.
+func (g *File) Read(b []byte) (cnt int, err error) {
+	if g.gcsReader == nil {
+		return 0, errNotReader
+	}
+	var n int
+	for cnt < len(b) {
+		n, err = g.gcsReader.Read(b[cnt:])
+		cnt += n
+		if err != nil {
+			break
+		}
+	}
+	// io.EOF is only reported once no data is left
+	if err == io.EOF && cnt > 0 {
+		err = nil
+	}
+	if err != nil && err != io.EOF {
+		err = g.wrapError(err)
+	}
+	return cnt, err
 }
 
-// Write implements io.Writer.
+// Write implements io.Writer. The upload starts with the first call.
 func (g *File) Write(b []byte) (int, error) {
+	if g.abortErr != nil {
+		return 0, g.abortErr
+	}
+	if !g.writing {
+		return 0, errNotWriter
+	}
 	if g.gcsWriter == nil {
-		g.gcsWriter = g.object.NewWriter(g.ctx)
+		if g.crc != nil && len(g.pending)+len(b) <= g.pendingLimit() {
+			// Close uploads small objects with their checksum
+			g.pending = append(g.pending, b...)
+			g.crc.Write(b)
+			return len(b), nil
+		}
+		g.openWrite()
+		if err := g.writePending(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := g.gcsWriter.Write(b)
+	if g.crc != nil {
+		g.crc.Write(b[:n])
+	}
+	return n, classify(err)
+}
+
+// pendingLimit returns the size of the largest object uploaded with its
+// checksum.
+func (g *File) pendingLimit() int {
+	if g.writerParams.ChunkSize > 0 {
+		return g.writerParams.ChunkSize
+	}
+	return googleapi.DefaultUploadChunkSize
+}
+
+// writePending starts the upload with the data held by Write.
+func (g *File) writePending() error {
+	if len(g.pending) == 0 {
+		return nil
+	}
+	_, err := g.gcsWriter.Write(g.pending)
+	g.pending = nil
+	return classify(err)
+}
+
+// openWrite opens the storage.Writer with a context that Abort cancels.
+func (g *File) openWrite() {
+	params := g.writerParams
+	obj := g.object
+	if params.Conditions != (storage.Conditions{}) {
+		obj = obj.If(params.Conditions)
+	}
+
+	ctx, cancel := context.WithCancel(g.ctx)
+	w := obj.NewWriter(ctx)
+	if params.ChunkSize > 0 {
+		w.ChunkSize = params.ChunkSize
 	}
+	w.ContentType = params.ContentType
+	w.Metadata = params.Metadata
+	w.KMSKeyName = params.KMSKeyName
 
-	return g.gcsWriter.Write(b)
+	g.gcsWriter = w
+	g.cancelWrite = cancel
 }
 
-// Close implements io.Closer.
+// Close implements io.Closer. Writers publish the object, which is empty if
+// nothing was written.
 func (g *File) Close() error {
-	if !g.externalClient && g.gcsClient != nil {
-		if err := g.gcsClient.Close(); err != nil {
-			return err
-		}
+	var err error
+	switch {
+	case g.writing:
+		g.writing = false
+		err = g.commit()
+	case g.abortErr != nil:
+		err = g.abortErr
+	}
+
+	if closeErr := g.closeClient(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
 
-		g.gcsClient = nil
+	if g.gcsReader == nil {
+		return nil
 	}
+	return classify(g.gcsReader.Close())
+}
 
-	if g.gcsWriter != nil {
-		if err := g.gcsWriter.Close(); err != nil {
-			return err
+// commit completes the upload and verifies its checksum.
+func (g *File) commit() error {
+	if g.gcsWriter == nil {
+		g.openWrite()
+		if g.crc != nil {
+			// all the data is known, so GCS verifies it before publishing it
+			g.gcsWriter.CRC32C = g.crc.Sum32()
+			g.gcsWriter.SendCRC32C = true
 		}
+	}
+	defer g.cancelWrite()
+
+	// the error of a failed write is returned by Close as well
+	_ = g.writePending()
+	w := g.gcsWriter
+	g.gcsWriter = nil
+	if err := w.Close(); err != nil {
+		return classify(err)
+	}
+
+	attrs := w.Attrs()
+	g.generation = attrs.Generation
+	if g.crc != nil && attrs.CRC32C != g.crc.Sum32() {
+		err := fmt.Errorf("%w: object %s/%s has %08x, expected %08x", errChecksum, g.BucketName, g.FilePath, attrs.CRC32C, g.crc.Sum32())
+		// the corrupted object must not be read
+		if deleteErr := g.object.If(storage.Conditions{GenerationMatch: attrs.Generation}).Delete(g.ctx); deleteErr != nil {
+			return &deleteError{err: err, deleteErr: classify(deleteErr)}
+		}
+		return err
+	}
+	return nil
+}
 
+// deleteError reports an object that failed verification and could not be
+// deleted. It matches both errChecksum and the error of the delete.
+type deleteError struct {
+	err       error
+	deleteErr error
+}
+
+func (e *deleteError) Error() string {
+	return fmt.Sprintf("%v, and deleting it failed: %v", e.err, e.deleteErr)
+}
+
+// Is makes errors.Is match the error of the delete.
+func (e *deleteError) Is(target error) bool {
+	return errors.Is(e.deleteErr, target)
+}
+
+// Unwrap returns the checksum mismatch.
+func (e *deleteError) Unwrap() error {
+	return e.err
+}
+
+// closeClient closes the client created by the writer, if any.
+func (g *File) closeClient() error {
+	if g.externalClient || g.gcsClient == nil {
+		return nil
+	}
+	err := g.gcsClient.Close()
+	g.gcsClient = nil
+	return classify(err)
+}
+
+// Abort discards the data written so far instead of publishing it. The upload
+// is cancelled, which leaves any existing object untouched, and the file is
+// closed. Close then returns err. Abort has no effect once Close has returned.
+func (g *File) Abort(err error) error {
+	if !g.writing {
+		return nil
+	}
+	g.writing = false
+	g.abortErr = abort.Cause(err)
+	g.pending = nil
+
+	if g.gcsWriter != nil {
+		// the writer fails with the cancelled context without publishing anything
+		g.cancelWrite()
+		_ = g.gcsWriter.Close()
 		g.gcsWriter = nil
 	}
 
-	return g.gcsReader.Close()
+	return g.closeClient()
 }
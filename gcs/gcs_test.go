@@ -0,0 +1,331 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"github.com/xitongsys/parquet-go-source/gcsfake"
+	"google.golang.org/api/googleapi"
+)
+
+func TestLazyWriter(t *testing.T) {
+	srv := gcsfake.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("bucket")
+	ctx := context.Background()
+	client := srv.Client(ctx)
+
+	w, err := NewGcsFileWriterWithClient(ctx, client, "project", "bucket", "key")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if w.gcsWriter != nil || srv.Requests() != 0 {
+		t.Errorf("expected nothing to be uploaded before the first Write but got %d requests", srv.Requests())
+	}
+
+	// nothing written publishes an empty object
+	if err = w.Close(); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	obj, ok := srv.GetObject("bucket", "key")
+	if !ok || len(obj.Data) != 0 {
+		t.Fatalf("expected an empty object but got %v", obj)
+	}
+	if w.generation != obj.Generation {
+		t.Errorf("expected generation %d but got %d", obj.Generation, w.generation)
+	}
+}
+
+func TestWriterParams(t *testing.T) {
+	srv := gcsfake.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("bucket")
+	ctx := context.Background()
+	client := srv.Client(ctx)
+
+	params := GcsFileWriterParams{
+		Client:      client,
+		ContentType: "application/vnd.apache.parquet",
+		Metadata:    map[string]string{"rows": "10"},
+		KMSKeyName:  "projects/p/locations/l/keyRings/r/cryptoKeys/k",
+	}
+	w, err := NewGcsFileWriterWithParams(ctx, "project", "bucket", "key", params)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if _, err = w.Write([]byte("data")); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	obj, _ := srv.GetObject("bucket", "key")
+	if obj.ContentType != params.ContentType || obj.Metadata["rows"] != "10" || obj.KMSKeyName != params.KMSKeyName {
+		t.Errorf("expected the object to be uploaded with the params but got %q, %v and %q", obj.ContentType, obj.Metadata, obj.KMSKeyName)
+	}
+
+	// clones made with Create share the params
+	clone, err := w.Create("other")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	clone.Write([]byte("data"))
+	if err = clone.Close(); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if obj, _ = srv.GetObject("bucket", "other"); obj.ContentType != params.ContentType {
+		t.Errorf("expected the clone to be uploaded with the params but got %q", obj.ContentType)
+	}
+}
+
+func TestWriterConditions(t *testing.T) {
+	srv := gcsfake.NewServer()
+	defer srv.Close()
+	existing := srv.PutObject("bucket", "key", []byte("existing"))
+	ctx := context.Background()
+	client := srv.Client(ctx)
+
+	tests := []struct {
+		conditions storage.Conditions
+		published  bool
+	}{
+		{storage.Conditions{DoesNotExist: true}, false},
+		{storage.Conditions{GenerationMatch: existing.Generation + 1}, false},
+		{storage.Conditions{GenerationMatch: existing.Generation}, true},
+	}
+	for _, test := range tests {
+		w, err := NewGcsFileWriterWithParams(ctx, "project", "bucket", "key", GcsFileWriterParams{
+			Client:     client,
+			Conditions: test.conditions,
+		})
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		w.Write([]byte("new"))
+		err = w.Close()
+
+		obj, _ := srv.GetObject("bucket", "key")
+		if test.published {
+			if err != nil || string(obj.Data) != "new" {
+				t.Errorf("%+v: expected the object to be replaced but got %v", test.conditions, err)
+			}
+		} else if !errors.Is(err, sourceerrors.ErrPreconditionFailed) || string(obj.Data) != "existing" {
+			t.Errorf("%+v: expected ErrPreconditionFailed but got %v", test.conditions, err)
+		}
+	}
+}
+
+func TestChunkSize(t *testing.T) {
+	srv := gcsfake.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("bucket")
+	ctx := context.Background()
+	client := srv.Client(ctx)
+	data := bytes.Repeat([]byte("x"), 2*googleapi.MinUploadChunkSize+10)
+
+	tests := []struct {
+		chunkSize int
+		requests  int
+	}{
+		// a single multipart request
+		{0, 1},
+		// a resumable upload of three chunks
+		{googleapi.MinUploadChunkSize, 4},
+	}
+	for _, test := range tests {
+		w, err := NewGcsFileWriterWithParams(ctx, "project", "bucket", "key", GcsFileWriterParams{
+			Client:    client,
+			ChunkSize: test.chunkSize,
+		})
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		before := srv.Requests()
+		if _, err = w.Write(data); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		if requests := srv.Requests() - before; requests != test.requests {
+			t.Errorf("chunk size %d: expected %d requests but got %d", test.chunkSize, test.requests, requests)
+		}
+		if obj, _ := srv.GetObject("bucket", "key"); !bytes.Equal(obj.Data, data) {
+			t.Errorf("chunk size %d: expected the data to be uploaded", test.chunkSize)
+		}
+	}
+}
+
+func TestCreateSharesClient(t *testing.T) {
+	srv := gcsfake.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("bucket")
+	ctx := context.Background()
+
+	// writers without a client create one with the default credentials
+	os.Setenv("STORAGE_EMULATOR_HOST", srv.URL)
+	defer os.Unsetenv("STORAGE_EMULATOR_HOST")
+	w, err := NewGcsFileWriter(ctx, "project", "bucket", "key")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if w.externalClient {
+		t.Fatalf("expected the writer to own its client")
+	}
+
+	pf, err := w.Create("other")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	clone := pf.(*File)
+	if !clone.externalClient || clone.gcsClient != w.gcsClient {
+		t.Fatalf("expected the clone to share the client without owning it")
+	}
+	clone.Write([]byte("clone"))
+	if err = clone.Close(); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	// the client is still usable after closing the clone
+	w.Write([]byte("writer"))
+	if err = w.Close(); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if w.gcsClient != nil {
+		t.Errorf("expected Close to close the client of the writer")
+	}
+	for name, data := range map[string]string{"key": "writer", "other": "clone"} {
+		if obj, ok := srv.GetObject("bucket", name); !ok || string(obj.Data) != data {
+			t.Errorf("expected %s to hold %q", name, data)
+		}
+	}
+}
+
+func TestVerifyCRC32C(t *testing.T) {
+	srv := gcsfake.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("bucket")
+	ctx := context.Background()
+	client := srv.Client(ctx)
+	params := GcsFileWriterParams{
+		Client:       client,
+		ChunkSize:    googleapi.MinUploadChunkSize,
+		VerifyCRC32C: true,
+	}
+	small := []byte("data")
+	large := bytes.Repeat([]byte("x"), googleapi.MinUploadChunkSize+10)
+
+	// objects of up to a chunk are rejected by GCS before they are published
+	var deletes int
+	srv.SetFault(func(r *http.Request) *gcsfake.Fault {
+		if r.Method == http.MethodDelete {
+			deletes++
+			return nil
+		}
+		return &gcsfake.Fault{Corrupt: true}
+	})
+	w, err := NewGcsFileWriterWithParams(ctx, "project", "bucket", "key", params)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	w.Write(small)
+	err = w.Close()
+	if statusOf(err) != http.StatusBadRequest {
+		t.Errorf("expected the upload to be rejected but got %v", err)
+	}
+	if _, exists := srv.GetObject("bucket", "key"); exists || deletes != 0 {
+		t.Errorf("expected the corrupted object never to be published but got %d deletes", deletes)
+	}
+
+	// larger ones are deleted once published
+	tests := []struct {
+		deleteStatus int
+		kind         error
+	}{
+		{0, nil},
+		{http.StatusForbidden, sourceerrors.ErrPermissionDenied},
+	}
+	for _, test := range tests {
+		deleteStatus := test.deleteStatus
+		srv.SetFault(func(r *http.Request) *gcsfake.Fault {
+			if r.Method == http.MethodDelete {
+				if deleteStatus == 0 {
+					return nil
+				}
+				return &gcsfake.Fault{Status: deleteStatus}
+			}
+			return &gcsfake.Fault{Corrupt: true}
+		})
+
+		w, err := NewGcsFileWriterWithParams(ctx, "project", "bucket", "key", params)
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		w.Write(large)
+		err = w.Close()
+		if !errors.Is(err, errChecksum) {
+			t.Fatalf("expected errChecksum but got %v", err)
+		}
+
+		_, exists := srv.GetObject("bucket", "key")
+		if test.kind == nil {
+			if exists {
+				t.Errorf("expected the corrupted object to be deleted")
+			}
+		} else if !errors.Is(err, test.kind) || !exists {
+			t.Errorf("expected the error of the delete to be returned but got %v", err)
+		}
+	}
+
+	// the checksum matches without faults
+	srv.SetFault(nil)
+	for _, data := range [][]byte{small, large} {
+		w, _ := NewGcsFileWriterWithParams(ctx, "project", "bucket", "key", params)
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		if obj, _ := srv.GetObject("bucket", "key"); !bytes.Equal(obj.Data, data) {
+			t.Errorf("expected %d bytes to be uploaded", len(data))
+		}
+	}
+}
+
+// statusOf returns the status of an error of the JSON API, or 0.
+func statusOf(err error) int {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return 0
+}
+
+func TestObjectChanged(t *testing.T) {
+	srv := gcsfake.NewServer()
+	defer srv.Close()
+	first := srv.PutObject("bucket", "key", []byte("first version"))
+	ctx := context.Background()
+
+	r, err := NewGcsFileReaderWithClient(ctx, srv.Client(ctx), "project", "bucket", "key")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	srv.PutObject("bucket", "key", []byte("second version"))
+
+	_, err = r.Read(make([]byte, 4))
+	var changed *sourceerrors.ObjectChangedError
+	if !errors.As(err, &changed) || changed.Version != strconv.FormatInt(first.Generation, 10) {
+		t.Errorf("expected ObjectChangedError for the opened generation but got %v", err)
+	}
+	if _, err = r.Open(""); !errors.Is(err, sourceerrors.ErrObjectChanged) {
+		t.Errorf("expected clones to fail with ErrObjectChanged but got %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package gcsfake
+
+import (
+	"context"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+// Endpoint returns the endpoint of the JSON API of the server, for
+// option.WithEndpoint.
+func (s *Server) Endpoint() string {
+	return s.URL + "/storage/v1/"
+}
+
+// Client returns an unauthenticated storage client using the server.
+func (s *Server) Client(ctx context.Context) *storage.Client {
+	client, err := storage.NewClient(ctx, option.WithEndpoint(s.Endpoint()), option.WithoutAuthentication())
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
@@ -0,0 +1,540 @@
+// Package gcsfake runs an in-memory server speaking enough of the Google Cloud
+// Storage JSON and XML APIs to test the gcs backend without network access or
+// credentials:
+//
+//	srv := gcsfake.NewServer()
+//	defer srv.Close()
+//	srv.CreateBucket("bucket")
+//	pf, err := gcs.NewGcsFileWriterWithClient(ctx, srv.Client(ctx), "project", "bucket", "name")
+//
+// The server supports object metadata, ranged reads, multipart and resumable
+// uploads, deletes, generations and the generation preconditions. Requests are
+// not authenticated. Faults such as failed requests and corrupted uploads can be
+// injected with SetFault.
+package gcsfake
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	raw "google.golang.org/api/storage/v1"
+)
+
+const (
+	jsonPrefix   = "/storage/v1/b/"
+	uploadPrefix = "/upload/storage/v1/b/"
+)
+
+// Object is a generation of an object stored by the server.
+type Object struct {
+	Data       []byte
+	Generation int64
+	// ContentType, Metadata and KMSKeyName are taken from the metadata sent
+	// with the upload.
+	ContentType string
+	Metadata    map[string]string
+	KMSKeyName  string
+}
+
+// CRC32C returns the CRC32C checksum of the data of obj, as computed by GCS.
+func (obj *Object) CRC32C() uint32 {
+	return crc32.Checksum(obj.Data, crc32.MakeTable(crc32.Castagnoli))
+}
+
+// Fault describes how the server misbehaves for a request.
+type Fault struct {
+	// Status makes the server reply with an error of this status instead of
+	// serving the request. Optional.
+	Status int
+	// Corrupt makes the server flip a bit of the data of an upload before
+	// storing it, so that its checksum differs from the one of the data sent.
+	// Uploads sending their CRC32C are rejected with 400 instead, as by GCS.
+	// Optional.
+	Corrupt bool
+}
+
+// FaultFunc returns the fault to inject for a request, or nil to serve it
+// normally. It is called concurrently.
+type FaultFunc func(r *http.Request) *Fault
+
+// upload is a resumable upload session.
+type upload struct {
+	bucket string
+	name   string
+	meta   raw.Object
+	query  url.Values
+	data   []byte
+}
+
+// Server is an in-memory GCS server listening on a local port.
+type Server struct {
+	// URL is the address of the server, e.g. http://127.0.0.1:1234. It can be
+	// used as STORAGE_EMULATOR_HOST.
+	URL string
+
+	srv *httptest.Server
+
+	lock       sync.Mutex
+	buckets    map[string]map[string]*Object
+	uploads    map[string]*upload
+	nextID     int
+	generation int64
+	fault      FaultFunc
+	requests   int
+}
+
+// NewServer starts a server without buckets.
+func NewServer() *Server {
+	s := &Server{
+		buckets:    map[string]map[string]*Object{},
+		uploads:    map[string]*upload{},
+		generation: time.Now().UnixNano() / 1000,
+	}
+	s.srv = httptest.NewServer(s)
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// CreateBucket creates an empty bucket, if it does not exist yet.
+func (s *Server) CreateBucket(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.buckets[name] == nil {
+		s.buckets[name] = map[string]*Object{}
+	}
+}
+
+// PutObject stores data as a new generation of name, bypassing the HTTP API.
+// The bucket is created if needed.
+func (s *Server) PutObject(bucketName, name string, data []byte) *Object {
+	s.CreateBucket(bucketName)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.store(bucketName, name, &Object{Data: data})
+}
+
+// GetObject returns the latest generation of name.
+func (s *Server) GetObject(bucketName, name string) (*Object, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	obj := s.buckets[bucketName][name]
+	return obj, obj != nil
+}
+
+// Uploads returns the number of resumable uploads not completed yet.
+func (s *Server) Uploads() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.uploads)
+}
+
+// Requests returns the number of requests received so far.
+func (s *Server) Requests() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests
+}
+
+// SetFault installs the function choosing the faults to inject. A nil function
+// removes it.
+func (s *Server) SetFault(f FaultFunc) {
+	s.lock.Lock()
+	s.fault = f
+	s.lock.Unlock()
+}
+
+// store stores obj as a new generation of name. The lock must be held.
+func (s *Server) store(bucketName, name string, obj *Object) *Object {
+	s.generation++
+	obj.Generation = s.generation
+	s.buckets[bucketName][name] = obj
+	return obj
+}
+
+// ServeHTTP implements the object operations of the JSON API, and reads of the
+// XML API.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	s.requests++
+	faultFunc := s.fault
+	s.lock.Unlock()
+
+	var fault *Fault
+	if faultFunc != nil {
+		fault = faultFunc(r)
+	}
+	if fault != nil && fault.Status != 0 {
+		// the body is drained so that clients see the response rather than a
+		// reset connection
+		io.Copy(ioutil.Discard, r.Body)
+		writeError(w, r, fault.Status, "injected fault")
+		return
+	}
+	corrupt := fault != nil && fault.Corrupt
+
+	switch path := r.URL.Path; {
+	case strings.HasPrefix(path, uploadPrefix):
+		s.serveUpload(w, r, strings.TrimSuffix(strings.TrimPrefix(path, uploadPrefix), "/o"), corrupt)
+	case strings.HasPrefix(path, jsonPrefix):
+		bucketName, name := splitJSONPath(strings.TrimPrefix(path, jsonPrefix))
+		switch {
+		case name == "":
+			writeError(w, r, http.StatusNotImplemented, "bucket operations are not supported")
+		case r.Method == http.MethodGet:
+			s.getAttrs(w, r, bucketName, name)
+		case r.Method == http.MethodDelete:
+			s.deleteObject(w, r, bucketName, name)
+		default:
+			writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		bucketName, name := splitPath(path)
+		s.readObject(w, r, bucketName, name)
+	default:
+		writeError(w, r, http.StatusNotImplemented, "operation is not supported")
+	}
+}
+
+// splitJSONPath splits bucket/o/name into its bucket and object name.
+func splitJSONPath(path string) (string, string) {
+	i := strings.Index(path, "/o/")
+	if i < 0 {
+		return path, ""
+	}
+	return path[:i], path[i+len("/o/"):]
+}
+
+// splitPath splits /bucket/name into its bucket and object name.
+func splitPath(path string) (string, string) {
+	path = strings.TrimPrefix(path, "/")
+	i := strings.IndexByte(path, '/')
+	if i < 0 {
+		return path, ""
+	}
+	return path[:i], path[i+1:]
+}
+
+// lookup returns the latest generation of name, or writes the matching error.
+// The lock must be held.
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request, bucketName, name string) *Object {
+	b := s.buckets[bucketName]
+	if b == nil {
+		writeError(w, r, http.StatusNotFound, "the bucket does not exist")
+		return nil
+	}
+	obj := b[name]
+	if obj == nil {
+		writeError(w, r, http.StatusNotFound, "No such object: "+bucketName+"/"+name)
+	}
+	return obj
+}
+
+// checkGeneration writes the response of a failed generation precondition.
+// obj is nil if the object does not exist.
+func checkGeneration(w http.ResponseWriter, r *http.Request, obj *Object, match, notMatch string) bool {
+	var current int64
+	if obj != nil {
+		current = obj.Generation
+	}
+	if match != "" && match != strconv.FormatInt(current, 10) ||
+		notMatch != "" && notMatch == strconv.FormatInt(current, 10) {
+		writeError(w, r, http.StatusPreconditionFailed, "At least one of the pre-conditions you specified did not hold.")
+		return false
+	}
+	return true
+}
+
+func (s *Server) readObject(w http.ResponseWriter, r *http.Request, bucketName, name string) {
+	s.lock.Lock()
+	obj := s.lookup(w, r, bucketName, name)
+	s.lock.Unlock()
+	if obj == nil {
+		return
+	}
+	if gen := r.URL.Query().Get("generation"); gen != "" && gen != strconv.FormatInt(obj.Generation, 10) {
+		writeError(w, r, http.StatusNotFound, "No such object: "+bucketName+"/"+name)
+		return
+	}
+	if !checkGeneration(w, r, obj, r.Header.Get("X-Goog-If-Generation-Match"), r.Header.Get("X-Goog-If-Generation-Not-Match")) {
+		return
+	}
+
+	contentType := obj.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Goog-Generation", strconv.FormatInt(obj.Generation, 10))
+	w.Header().Set("X-Goog-Metageneration", "1")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(obj.Data))
+}
+
+func (s *Server) getAttrs(w http.ResponseWriter, r *http.Request, bucketName, name string) {
+	s.lock.Lock()
+	obj := s.lookup(w, r, bucketName, name)
+	s.lock.Unlock()
+	query := r.URL.Query()
+	if obj == nil || !checkGeneration(w, r, obj, query.Get("ifGenerationMatch"), query.Get("ifGenerationNotMatch")) {
+		return
+	}
+	writeJSON(w, http.StatusOK, resource(bucketName, name, obj))
+}
+
+func (s *Server) deleteObject(w http.ResponseWriter, r *http.Request, bucketName, name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	obj := s.lookup(w, r, bucketName, name)
+	query := r.URL.Query()
+	if obj == nil || !checkGeneration(w, r, obj, query.Get("ifGenerationMatch"), query.Get("ifGenerationNotMatch")) {
+		return
+	}
+	delete(s.buckets[bucketName], name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveUpload handles multipart uploads, and the requests of resumable uploads.
+func (s *Server) serveUpload(w http.ResponseWriter, r *http.Request, bucketName string, corrupt bool) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+	if id := query.Get("upload_id"); id != "" {
+		s.uploadChunk(w, r, id, corrupt)
+		return
+	}
+
+	s.lock.Lock()
+	exists := s.buckets[bucketName] != nil
+	s.lock.Unlock()
+	if !exists {
+		writeError(w, r, http.StatusNotFound, "the bucket does not exist")
+		return
+	}
+
+	switch query.Get("uploadType") {
+	case "multipart":
+		meta, data, err := readMultipart(r)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.commit(w, r, &upload{bucket: bucketName, name: objectName(query, meta), meta: meta, query: query, data: data}, corrupt)
+	case "resumable":
+		var meta raw.Object
+		if err := json.NewDecoder(r.Body).Decode(&meta); err != nil && err != io.EOF {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.lock.Lock()
+		s.nextID++
+		id := strconv.Itoa(s.nextID)
+		s.uploads[id] = &upload{bucket: bucketName, name: objectName(query, meta), meta: meta, query: query}
+		s.lock.Unlock()
+
+		w.Header().Set("Location", s.URL+uploadPrefix+url.PathEscape(bucketName)+"/o?uploadType=resumable&upload_id="+id)
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, r, http.StatusBadRequest, "unsupported uploadType")
+	}
+}
+
+// objectName returns the name of the object uploaded, which is passed as a
+// parameter or in the metadata.
+func objectName(query url.Values, meta raw.Object) string {
+	if name := query.Get("name"); name != "" {
+		return name
+	}
+	return meta.Name
+}
+
+// readMultipart reads the metadata and the data of a multipart/related upload.
+func readMultipart(r *http.Request) (raw.Object, []byte, error) {
+	var meta raw.Object
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return meta, nil, err
+	}
+	mr := multipart.NewReader(r.Body, params["boundary"])
+
+	part, err := mr.NextPart()
+	if err != nil {
+		return meta, nil, err
+	}
+	if err = json.NewDecoder(part).Decode(&meta); err != nil {
+		return meta, nil, err
+	}
+	if part, err = mr.NextPart(); err != nil {
+		return meta, nil, err
+	}
+	data, err := ioutil.ReadAll(part)
+	return meta, data, err
+}
+
+// uploadChunk appends a chunk to a resumable upload, and commits it with the
+// last one.
+func (s *Server) uploadChunk(w http.ResponseWriter, r *http.Request, id string, corrupt bool) {
+	s.lock.Lock()
+	up := s.uploads[id]
+	s.lock.Unlock()
+	if up == nil {
+		writeError(w, r, http.StatusNotFound, "the upload does not exist")
+		return
+	}
+
+	// bytes first-last/total, bytes first-last/* or bytes */total
+	contentRange := strings.TrimPrefix(r.Header.Get("Content-Range"), "bytes ")
+	i := strings.IndexByte(contentRange, '/')
+	if i < 0 {
+		writeError(w, r, http.StatusBadRequest, "invalid Content-Range")
+		return
+	}
+	final := contentRange[i+1:] != "*"
+	if first := strings.SplitN(contentRange[:i], "-", 2)[0]; first != "*" && first != strconv.Itoa(len(up.data)) {
+		writeError(w, r, http.StatusBadRequest, "chunks must be sent in order")
+		return
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	up.data = append(up.data, data...)
+
+	if !final {
+		// the client asks for 200 rather than 308 Resume Incomplete
+		w.Header().Set("X-Http-Status-Code-Override", "308")
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(up.data)-1))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	s.lock.Lock()
+	delete(s.uploads, id)
+	s.lock.Unlock()
+	s.commit(w, r, up, corrupt)
+}
+
+// commit stores the data of a completed upload if its preconditions hold.
+func (s *Server) commit(w http.ResponseWriter, r *http.Request, up *upload, corrupt bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	b := s.buckets[up.bucket]
+	if b == nil {
+		writeError(w, r, http.StatusNotFound, "the bucket does not exist")
+		return
+	}
+	if !checkGeneration(w, r, b[up.name], up.query.Get("ifGenerationMatch"), up.query.Get("ifGenerationNotMatch")) {
+		return
+	}
+
+	data := up.data
+	if corrupt && len(data) > 0 {
+		data = append([]byte(nil), data...)
+		data[0] ^= 1
+	}
+	if up.meta.Crc32c != "" && up.meta.Crc32c != encodeCRC32C(data) {
+		writeError(w, r, http.StatusBadRequest, "Provided CRC32C "+up.meta.Crc32c+" doesn't match calculated CRC32C "+encodeCRC32C(data))
+		return
+	}
+	obj := s.store(up.bucket, up.name, &Object{
+		Data:        data,
+		ContentType: up.meta.ContentType,
+		Metadata:    up.meta.Metadata,
+		KMSKeyName:  up.query.Get("kmsKeyName"),
+	})
+	writeJSON(w, http.StatusOK, resource(up.bucket, up.name, obj))
+}
+
+// encodeCRC32C returns the CRC32C checksum of data as in the JSON API.
+func encodeCRC32C(data []byte) string {
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+	return base64.StdEncoding.EncodeToString(crc[:])
+}
+
+// resource returns the JSON representation of obj.
+func resource(bucketName, name string, obj *Object) *raw.Object {
+	return &raw.Object{
+		Kind:           "storage#object",
+		Bucket:         bucketName,
+		Name:           name,
+		Generation:     obj.Generation,
+		Metageneration: 1,
+		Size:           uint64(len(obj.Data)),
+		ContentType:    obj.ContentType,
+		Metadata:       obj.Metadata,
+		KmsKeyName:     obj.KMSKeyName,
+		Crc32c:         encodeCRC32C(obj.Data),
+	}
+}
+
+type errorItem struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Code    int         `json:"code"`
+		Message string      `json:"message"`
+		Errors  []errorItem `json:"errors"`
+	} `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	var resp errorResponse
+	resp.Error.Code = status
+	resp.Error.Message = message
+	resp.Error.Errors = []errorItem{{Reason: reasonOf(status), Message: message}}
+	writeJSON(w, status, resp)
+}
+
+// reasonOf returns the reason GCS reports with an error of the given status.
+func reasonOf(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "invalid"
+	case http.StatusNotFound:
+		return "notFound"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusPreconditionFailed:
+		return "conditionNotMet"
+	case http.StatusTooManyRequests:
+		return "rateLimitExceeded"
+	default:
+		return "backendError"
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,138 @@
+package gcsfake
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+func statusOf(err error) int {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return 0
+}
+
+func TestUploads(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.CreateBucket("bucket")
+	client := srv.Client(context.Background())
+	ctx := context.Background()
+
+	// a multipart upload, and a resumable upload of three chunks
+	for _, size := range []int{10, 2*googleapi.MinUploadChunkSize + 10} {
+		data := bytes.Repeat([]byte("x"), size)
+		w := client.Bucket("bucket").Object("key").NewWriter(ctx)
+		w.ChunkSize = googleapi.MinUploadChunkSize
+		w.ContentType = "text/plain"
+		w.Metadata = map[string]string{"a": "b"}
+		if _, err := w.Write(data); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+
+		obj, ok := srv.GetObject("bucket", "key")
+		if !ok || !bytes.Equal(obj.Data, data) || obj.ContentType != "text/plain" || obj.Metadata["a"] != "b" {
+			t.Fatalf("size %d: expected the object to be stored with its metadata", size)
+		}
+		if attrs := w.Attrs(); attrs.Generation != obj.Generation || attrs.CRC32C != obj.CRC32C() {
+			t.Errorf("size %d: expected generation %d and checksum %08x but got %d and %08x", size, obj.Generation, obj.CRC32C(), attrs.Generation, attrs.CRC32C)
+		}
+	}
+	if srv.Uploads() != 0 {
+		t.Errorf("expected all uploads to be completed but got %d", srv.Uploads())
+	}
+}
+
+func TestRangeAndConditions(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	obj := srv.PutObject("bucket", "key", []byte("0123456789"))
+	client := srv.Client(context.Background())
+	ctx := context.Background()
+
+	handle := client.Bucket("bucket").Object("key")
+	r, err := handle.If(storage.Conditions{GenerationMatch: obj.Generation}).NewRangeReader(ctx, 2, 3)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	data, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(data) != "234" || r.Attrs.Size != 10 || r.Attrs.Generation != obj.Generation {
+		t.Errorf("expected bytes 2-4 of generation %d but got %q of %d", obj.Generation, data, r.Attrs.Generation)
+	}
+
+	stale := handle.If(storage.Conditions{GenerationMatch: obj.Generation - 1})
+	if _, err = stale.NewRangeReader(ctx, 0, -1); statusOf(err) != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 but got %v", err)
+	}
+	if _, err = stale.Attrs(ctx); statusOf(err) != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 but got %v", err)
+	}
+
+	w := handle.If(storage.Conditions{DoesNotExist: true}).NewWriter(ctx)
+	w.Write([]byte("other"))
+	if err = w.Close(); statusOf(err) != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 but got %v", err)
+	}
+
+	if err = stale.Delete(ctx); statusOf(err) != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 but got %v", err)
+	}
+	if err = handle.Delete(ctx); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if _, err = handle.Attrs(ctx); !errors.Is(err, storage.ErrObjectNotExist) {
+		t.Errorf("expected ErrObjectNotExist but got %v", err)
+	}
+}
+
+func TestFault(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.CreateBucket("bucket")
+	client := srv.Client(context.Background())
+	ctx := context.Background()
+
+	srv.SetFault(func(r *http.Request) *Fault {
+		if r.Method == http.MethodDelete {
+			return &Fault{Status: http.StatusForbidden}
+		}
+		return &Fault{Corrupt: true}
+	})
+	w := client.Bucket("bucket").Object("key").NewWriter(ctx)
+	w.Write([]byte("data"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	obj, _ := srv.GetObject("bucket", "key")
+	if string(obj.Data) == "data" || w.Attrs().CRC32C != obj.CRC32C() {
+		t.Errorf("expected the stored data to be corrupted but got %q", obj.Data)
+	}
+	if err := client.Bucket("bucket").Object("key").Delete(ctx); statusOf(err) != http.StatusForbidden {
+		t.Errorf("expected 403 but got %v", err)
+	}
+
+	// uploads sending their checksum are rejected
+	w = client.Bucket("bucket").Object("other").NewWriter(ctx)
+	w.CRC32C = crc32.Checksum([]byte("data"), crc32.MakeTable(crc32.Castagnoli))
+	w.SendCRC32C = true
+	w.Write([]byte("data"))
+	if err := w.Close(); statusOf(err) != http.StatusBadRequest {
+		t.Errorf("expected 400 but got %v", err)
+	}
+	if _, ok := srv.GetObject("bucket", "other"); ok {
+		t.Errorf("expected the rejected upload not to be stored")
+	}
+}
@@ -9,8 +9,10 @@ require (
 	github.com/aws/aws-sdk-go v1.43.31
 	github.com/aws/aws-sdk-go-v2 v1.23.0
 	github.com/aws/aws-sdk-go-v2/config v1.25.3
+	github.com/aws/aws-sdk-go-v2/credentials v1.16.2
 	github.com/aws/aws-sdk-go-v2/feature/s3/manager v1.14.0
 	github.com/aws/aws-sdk-go-v2/service/s3 v1.43.0
+	github.com/aws/smithy-go v1.17.0
 	github.com/bobg/gcsobj v0.1.2
 	github.com/colinmarc/hdfs/v2 v2.1.1
 	github.com/golang/mock v1.6.0
@@ -21,4 +23,5 @@ require (
 	github.com/stretchr/testify v1.7.1
 	github.com/xitongsys/parquet-go v1.5.1
 	gocloud.dev v0.26.0
+	google.golang.org/api v0.74.0
 )
@@ -0,0 +1,38 @@
+package gocloud
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/footer"
+	"github.com/xitongsys/parquet-go-source/sourcetest"
+	"github.com/xitongsys/parquet-go/source"
+	"gocloud.dev/blob/memblob"
+)
+
+func TestConformance(t *testing.T) {
+	b := memblob.OpenBucket(nil)
+	defer b.Close()
+
+	ctx := context.Background()
+	for _, minRequestSize := range []int{0, 1000} {
+		for _, footerCache := range []*footer.Cache{nil, footer.NewCache(1000, 0)} {
+			name := fmt.Sprintf("MinRequestSize=%d/FooterCache=%t", minRequestSize, footerCache != nil)
+			minRequestSize, footerCache := minRequestSize, footerCache
+			t.Run(name, func(t *testing.T) {
+				sourcetest.RunConformance(t, sourcetest.Factory{
+					Open: func(name string) (source.ParquetFile, error) {
+						return NewBlobReaderWithParams(ctx, b, name, BlobReaderParams{
+							FooterCache:    footerCache,
+							MinRequestSize: minRequestSize,
+						})
+					},
+					Create: func(name string) (source.ParquetFile, error) {
+						return NewBlobWriter(ctx, b, name)
+					},
+				})
+			})
+		}
+	}
+}
@@ -2,41 +2,105 @@ package gocloud
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"time"
 
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3v2 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/pkg/errors"
+	"github.com/xitongsys/parquet-go-source/abort"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"github.com/xitongsys/parquet-go-source/footer"
+	"github.com/xitongsys/parquet-go-source/stream"
 	"github.com/xitongsys/parquet-go/source"
 	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
 )
 
 type blobFile struct {
 	ctx    context.Context
 	bucket *blob.Bucket
 	writer *blob.Writer
+	cancel context.CancelFunc
+	// abortErr is returned by writes and Close after Abort
+	abortErr error
+	// closed is set for writers once Close or Abort is called
+	closed bool
 
 	key    string
 	size   int64
 	offset int64
+	// stream keeps a range reader open across sequential reads
+	stream        stream.Reader
+	readerOptions *blob.ReaderOptions
+	writerOptions *blob.WriterOptions
+
+	etag        string
+	modTime     time.Time
+	generation  int64
+	footerCache *footer.Cache
+	footer      *footer.Tail
+}
+
+// BlobReaderParams contains fields used to configure a blob reader.
+type BlobReaderParams struct {
+	// FooterCache, if set, makes the reader fetch the end of the blob in a single
+	// request when it is opened and serve the parquet footer from memory, sharing it
+	// with all readers created through Open. Optional.
+	FooterCache *footer.Cache
+	// MinRequestSize is the minimum amount of data requested from the blob at a
+	// time, see package stream. Defaults to the rest of the blob. Optional.
+	MinRequestSize int
+	// ReaderOptions are passed to the range readers of the blob. Their
+	// BeforeRead hook is called after the one setting the preconditions that
+	// detect a changed blob. Optional.
+	ReaderOptions *blob.ReaderOptions
+}
+
+// BlobWriterParams contains fields used to configure a blob writer.
+type BlobWriterParams struct {
+	// WriterOptions are passed to the writer of the blob, e.g. to set its
+	// content type, metadata or a BeforeWrite hook. Writers created with
+	// Create share them. Optional.
+	WriterOptions *blob.WriterOptions
 }
 
 func NewBlobWriter(ctx context.Context, b *blob.Bucket, name string) (source.ParquetFile, error) {
+	return NewBlobWriterWithParams(ctx, b, name, BlobWriterParams{})
+}
+
+func NewBlobWriterWithParams(ctx context.Context, b *blob.Bucket, name string, params BlobWriterParams) (source.ParquetFile, error) {
 	bf := &blobFile{
-		ctx:    ctx,
-		bucket: b,
+		ctx:           ctx,
+		bucket:        b,
+		writerOptions: params.WriterOptions,
 	}
 
 	return bf.Create(name)
 }
 
 func NewBlobReader(ctx context.Context, b *blob.Bucket, name string) (source.ParquetFile, error) {
+	return NewBlobReaderWithParams(ctx, b, name, BlobReaderParams{})
+}
+
+func NewBlobReaderWithParams(ctx context.Context, b *blob.Bucket, name string, params BlobReaderParams) (source.ParquetFile, error) {
 	bf := &blobFile{
-		ctx:    ctx,
-		bucket: b,
+		ctx:           ctx,
+		bucket:        b,
+		footerCache:   params.FooterCache,
+		stream:        stream.Reader{MinRequestSize: int64(params.MinRequestSize)},
+		readerOptions: params.ReaderOptions,
 	}
 
 	return bf.Open(name)
 }
 
+// Seek tracks the offset for the next Read. The range reader is kept unless the
+// offset changes.
 func (b *blobFile) Seek(offset int64, whence int) (int64, error) {
 	switch whence {
 	case io.SeekStart:
@@ -52,93 +116,291 @@ func (b *blobFile) Seek(offset int64, whence int) (int64, error) {
 		return 0, errors.Errorf("Invalid offset. offset=%d", offset)
 	}
 
+	if offset != b.offset {
+		b.stream.Close()
+	}
 	b.offset = offset
 
 	return b.offset, nil
 }
 
+// Read fills p unless the end of the blob is reached. Sequential reads share a
+// range reader of at least MinRequestSize bytes.
 func (b *blobFile) Read(p []byte) (n int, err error) {
-	r, err := b.bucket.NewRangeReader(b.ctx, b.key, b.offset, int64(len(p)), nil)
-	if err != nil {
-		return 0, errors.Wrapf(err, "Failed to open reader. key=%s, offset=%d, len=%d", b.key, b.offset, len(p))
+	if b.offset >= b.size {
+		return 0, io.EOF
 	}
-	defer r.Close()
 
-	n, err = r.Read(p)
+	if n, ok := b.footer.ReadAt(p, b.offset); ok {
+		b.stream.Close()
+		b.offset += int64(n)
+		return n, nil
+	}
+
+	n, err = b.stream.Read(p, b.offset, b.size, b.openRange)
 	b.offset += int64(n)
+	return n, b.wrapError(err)
+}
 
-	return n, err
+// openRange opens a range reader for the stream.
+func (b *blobFile) openRange(offset, length int64) (io.ReadCloser, error) {
+	r, err := b.newRangeReader(offset, length)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open reader. key=%s, offset=%d", b.key, offset)
+	}
+	return r, nil
 }
 
 // Note that for blob storage, calling write on an existing blob overwrites that blob as opposed to appending to it.
 // Additionally Write is not guaranteed to have succeeded unless Close() also succeeds
 func (b *blobFile) Write(p []byte) (n int, err error) {
+	if b.abortErr != nil {
+		return 0, b.abortErr
+	}
 	if b.writer == nil {
 		if b.key == "" {
 			return 0, errors.New("Invalid call to write, you must create or open a ParquetFile for writing")
 		}
 
-		if w, err := b.bucket.NewWriter(b.ctx, b.key, nil); err != nil {
+		if err := b.newWriter(); err != nil {
 			return 0, errors.Wrapf(err, "Could not create blob writer. key=%s", b.key)
-		} else {
-			b.writer = w
 		}
 	}
 
 	n, err = b.writer.Write(p)
 	b.size += int64(n)
 
-	return n, err
+	return n, b.wrapError(err)
 }
 
 func (b *blobFile) Close() error {
-	if b.writer != nil {
-		return b.writer.Close()
+	b.stream.Close()
+	if b.abortErr != nil {
+		// Abort already closed the writer
+		return b.abortErr
+	}
+	if b.writer != nil && !b.closed {
+		b.closed = true
+		defer b.cancel()
+		return b.wrapError(b.writer.Close())
 	}
 
 	return nil
 }
 
+// Abort discards the data written so far instead of publishing it. The
+// context of the writer is cancelled before it is closed, which makes the
+// drivers drop the upload and leave the blob as it was. Close then returns
+// err. Abort has no effect once Close has returned.
+func (b *blobFile) Abort(err error) error {
+	if b.writer == nil || b.closed {
+		return nil
+	}
+	b.closed = true
+	b.abortErr = abort.Cause(err)
+
+	b.cancel()
+	// Close fails with the cancelled context
+	_ = b.writer.Close()
+	return nil
+}
+
+// newWriter opens a writer for the blob with a context that Abort cancels.
+func (b *blobFile) newWriter() error {
+	ctx, cancel := context.WithCancel(b.ctx)
+	w, err := b.bucket.NewWriter(ctx, b.key, b.writerOptions)
+	if err != nil {
+		cancel()
+		return b.wrapError(err)
+	}
+
+	b.writer = w
+	b.cancel = cancel
+	return nil
+}
+
 func (b *blobFile) Create(name string) (source.ParquetFile, error) {
 	if name == "" {
 		return nil, errors.New("Parquet File name cannot be empty")
 	}
 
 	bf := &blobFile{
-		ctx:    b.ctx,
-		bucket: b.bucket,
+		ctx:           b.ctx,
+		bucket:        b.bucket,
+		writerOptions: b.writerOptions,
 	}
 
-	w, err := bf.bucket.NewWriter(bf.ctx, name, nil)
-	if err != nil {
+	bf.key = name
+	if err := bf.newWriter(); err != nil {
 		return nil, errors.Wrapf(err, "Could not create blob writer. blob=%s", name)
 	}
 
-	bf.key = name
-	bf.writer = w
-
 	return bf, nil
 }
 
+// Identity names the blob and the version being read, e.g. for use as a cache
+// key. Buckets carry no name, so blobs are only identified within the process
+// that opened the bucket.
+func (b *blobFile) Identity() string {
+	if b.etag == "" {
+		return ""
+	}
+	return fmt.Sprintf("gocloud://%p/%s#%s", b.bucket, b.key, b.etag)
+}
+
 func (b *blobFile) Open(name string) (source.ParquetFile, error) {
 	bf := &blobFile{
-		ctx:    b.ctx,
-		bucket: b.bucket,
+		ctx:           b.ctx,
+		bucket:        b.bucket,
+		footerCache:   b.footerCache,
+		stream:        stream.Reader{MinRequestSize: b.stream.MinRequestSize},
+		readerOptions: b.readerOptions,
 	}
 
 	if name == "" {
 		name = b.key
 	}
-	if e, err := bf.bucket.Exists(bf.ctx, name); !e || err != nil {
-		return nil, errors.Errorf("Requested blob does not exist. blob=%s", name)
+
+	// clones read the version and share the footer of an opened blob
+	if name == b.key && (b.etag != "" || !b.modTime.IsZero()) {
+		bf.key = b.key
+		bf.size = b.size
+		bf.etag = b.etag
+		bf.modTime = b.modTime
+		bf.generation = b.generation
+		bf.footer = b.footer
+		return bf, nil
+	}
+	e, err := bf.bucket.Exists(bf.ctx, name)
+	if err != nil {
+		return nil, errors.Wrapf(bf.wrapError(err), "Requested blob does not exist. blob=%s", name)
+	}
+	if !e {
+		return nil, sourceerrors.Wrap(sourceerrors.ErrNotFound, errors.Errorf("Requested blob does not exist. blob=%s", name))
 	}
 
 	bf.key = name
 	attrs, err := bf.bucket.Attributes(bf.ctx, bf.key)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Could not get attributes for blob. blob=%s", name)
+		return nil, errors.Wrapf(bf.wrapError(err), "Could not get attributes for blob. blob=%s", name)
 	}
 
 	bf.size = attrs.Size
+	bf.etag = attrs.ETag
+	bf.modTime = attrs.ModTime
+	var gcsAttrs storage.ObjectAttrs
+	if attrs.As(&gcsAttrs) {
+		bf.generation = gcsAttrs.Generation
+	}
+	if err := bf.loadFooter(); err != nil {
+		return nil, err
+	}
 	return bf, nil
 }
+
+// loadFooter fetches the end of the blob through the footer cache, if one is
+// configured.
+func (b *blobFile) loadFooter() error {
+	if b.footerCache == nil || b.size < 1 {
+		return nil
+	}
+
+	tail, err := b.footerCache.Get(footer.Key{
+		Backend: "gocloud",
+		Name:    fmt.Sprintf("%p/%s", b.bucket, b.key),
+		Version: b.etag,
+		Size:    b.size,
+	}, b.fetchRange)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read footer. key=%s", b.key)
+	}
+	b.footer = tail
+	return nil
+}
+
+func (b *blobFile) fetchRange(offset, length int64) ([]byte, error) {
+	r, err := b.newRangeReader(offset, length)
+	if err != nil {
+		return nil, b.wrapError(err)
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+// newRangeReader opens a range of the version of the blob that was opened.
+// Drivers supporting preconditions are asked to match the ETag or generation;
+// for the others the modification time of the range is compared with the one
+// seen on open.
+func (b *blobFile) newRangeReader(offset, length int64) (*blob.Reader, error) {
+	opts := &blob.ReaderOptions{
+		BeforeRead: func(as func(interface{}) bool) error {
+			var s3Input *s3.GetObjectInput
+			if b.etag != "" && as(&s3Input) {
+				s3Input.IfMatch = aws.String(b.etag)
+			}
+			var s3v2Input *s3v2.GetObjectInput
+			if b.etag != "" && as(&s3v2Input) {
+				s3v2Input.IfMatch = aws.String(b.etag)
+			}
+			var object **storage.ObjectHandle
+			if b.generation != 0 && as(&object) {
+				*object = (*object).If(storage.Conditions{GenerationMatch: b.generation})
+			}
+			if b.readerOptions != nil && b.readerOptions.BeforeRead != nil {
+				return b.readerOptions.BeforeRead(as)
+			}
+			return nil
+		},
+	}
+
+	r, err := b.bucket.NewRangeReader(b.ctx, b.key, offset, length, opts)
+	if err != nil {
+		return nil, err
+	}
+	if !b.modTime.IsZero() && !r.ModTime().IsZero() && !r.ModTime().Equal(b.modTime) {
+		r.Close()
+		return nil, b.objectChanged(nil)
+	}
+	return r, nil
+}
+
+// objectChanged returns an ObjectChangedError for a blob overwritten since it
+// was opened. err is the error of the driver, if it reported the change.
+func (b *blobFile) objectChanged(err error) error {
+	version := b.etag
+	if version == "" {
+		version = b.modTime.String()
+	}
+	return &sourceerrors.ObjectChangedError{
+		Name:    b.key,
+		Version: version,
+		Err:     err,
+	}
+}
+
+// gcerrorKinds maps the error codes of the drivers to kinds.
+var gcerrorKinds = map[gcerrors.ErrorCode]error{
+	gcerrors.NotFound:           sourceerrors.ErrNotFound,
+	gcerrors.PermissionDenied:   sourceerrors.ErrPermissionDenied,
+	gcerrors.FailedPrecondition: sourceerrors.ErrPreconditionFailed,
+	gcerrors.ResourceExhausted:  sourceerrors.ErrThrottled,
+	gcerrors.Unimplemented:      sourceerrors.ErrNotSupported,
+}
+
+// wrapError annotates errors of the drivers with their kind from sourceerrors.
+// Failed preconditions on reads are reported as an ObjectChangedError.
+func (b *blobFile) wrapError(err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	code := gcerrors.Code(err)
+	opened := b.etag != "" || !b.modTime.IsZero()
+	if code == gcerrors.FailedPrecondition && opened && b.writer == nil {
+		return b.objectChanged(err)
+	}
+	if kind, ok := gcerrorKinds[code]; ok {
+		return sourceerrors.Wrap(kind, err)
+	}
+	return sourceerrors.Classify(err)
+}
@@ -2,10 +2,14 @@ package gocloud
 
 import (
 	"context"
+	"errors"
 	"io"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go-source/abort"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"gocloud.dev/blob"
 	"gocloud.dev/blob/memblob"
 )
 
@@ -105,6 +109,29 @@ func TestRead(t *testing.T) {
 	assert.Equal(t, n, 0)
 }
 
+func TestReadObjectChanged(t *testing.T) {
+	b := memblob.OpenBucket(nil)
+	defer b.Close()
+
+	ctx := context.Background()
+	key := "test"
+	err := b.WriteAll(ctx, key, []byte("test data"), nil)
+	assert.NoError(t, err)
+
+	bf, err := NewBlobReader(ctx, b, key)
+	assert.NoError(t, err)
+	clone, err := bf.Open("")
+	assert.NoError(t, err)
+
+	err = b.WriteAll(ctx, key, []byte("new data!"), nil)
+	assert.NoError(t, err)
+
+	_, err = bf.Read(make([]byte, 4))
+	assert.True(t, errors.Is(err, sourceerrors.ErrObjectChanged), "unexpected error %v", err)
+	_, err = clone.Read(make([]byte, 4))
+	assert.True(t, errors.Is(err, sourceerrors.ErrObjectChanged), "unexpected error %v", err)
+}
+
 func TestWrite(t *testing.T) {
 	b := memblob.OpenBucket(nil)
 	defer b.Close()
@@ -150,3 +177,155 @@ func TestWrite(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, 0, n)
 }
+
+func TestAbort(t *testing.T) {
+	b := memblob.OpenBucket(nil)
+	defer b.Close()
+
+	ctx := context.Background()
+	key := "test"
+	err := b.WriteAll(ctx, key, []byte("previous"), nil)
+	assert.NoError(t, err)
+
+	bf, err := NewBlobWriter(ctx, b, key)
+	assert.NoError(t, err)
+	_, err = bf.Write([]byte("partial"))
+	assert.NoError(t, err)
+
+	cause := errors.New("job failed")
+	err = bf.(abort.Aborter).Abort(cause)
+	assert.NoError(t, err)
+	_, err = bf.Write([]byte("more"))
+	assert.Equal(t, cause, err)
+	assert.Equal(t, cause, bf.Close())
+
+	// the previous version is left untouched
+	data, err := b.ReadAll(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("previous"), data)
+}
+
+func TestAbortAfterClose(t *testing.T) {
+	b := memblob.OpenBucket(nil)
+	defer b.Close()
+
+	ctx := context.Background()
+	key := "test"
+	cause := errors.New("job failed")
+
+	bf, err := NewBlobWriter(ctx, b, key)
+	assert.NoError(t, err)
+	_, err = bf.Write([]byte("data"))
+	assert.NoError(t, err)
+	assert.NoError(t, bf.Close())
+
+	// Abort has no effect once Close has returned
+	assert.NoError(t, bf.(abort.Aborter).Abort(cause))
+	assert.NoError(t, bf.Close())
+	data, err := b.ReadAll(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("data"), data)
+
+	// nor on readers
+	r, err := NewBlobReader(ctx, b, key)
+	assert.NoError(t, err)
+	assert.NoError(t, r.(abort.Aborter).Abort(cause))
+	assert.NoError(t, r.Close())
+}
+
+func TestReadRequests(t *testing.T) {
+	b := memblob.OpenBucket(nil)
+	defer b.Close()
+
+	ctx := context.Background()
+	key := "test"
+	testData := []byte("0123456789abcdefghij")
+	err := b.WriteAll(ctx, key, testData, nil)
+	assert.NoError(t, err)
+
+	requests := 0
+	bf, err := NewBlobReaderWithParams(ctx, b, key, BlobReaderParams{
+		MinRequestSize: 8,
+		ReaderOptions: &blob.ReaderOptions{
+			BeforeRead: func(func(interface{}) bool) error {
+				requests++
+				return nil
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	// sequential reads share a range reader of MinRequestSize bytes
+	buf := make([]byte, 2)
+	for i := 0; i < 3; i++ {
+		_, err = bf.Read(buf)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, testData[4:6], buf)
+	assert.Equal(t, 1, requests)
+
+	// seeking to the current offset keeps the range reader
+	_, err = bf.Seek(6, io.SeekStart)
+	assert.NoError(t, err)
+	_, err = bf.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, testData[6:8], buf)
+	assert.Equal(t, 1, requests)
+
+	// the next range is requested once the first one is consumed
+	_, err = bf.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, testData[8:10], buf)
+	assert.Equal(t, 2, requests)
+
+	_, err = bf.Seek(2, io.SeekStart)
+	assert.NoError(t, err)
+	_, err = bf.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, testData[2:4], buf)
+	assert.Equal(t, 3, requests)
+
+	// clones share the options
+	clone, err := bf.Open("")
+	assert.NoError(t, err)
+	_, err = clone.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, requests)
+}
+
+func TestWriterOptions(t *testing.T) {
+	b := memblob.OpenBucket(nil)
+	defer b.Close()
+
+	ctx := context.Background()
+	hooks := 0
+	bf, err := NewBlobWriterWithParams(ctx, b, "first", BlobWriterParams{
+		WriterOptions: &blob.WriterOptions{
+			ContentType: "application/vnd.apache.parquet",
+			Metadata:    map[string]string{"origin": "test"},
+			BeforeWrite: func(func(interface{}) bool) error {
+				hooks++
+				return nil
+			},
+		},
+	})
+	assert.NoError(t, err)
+	_, err = bf.Write([]byte("data"))
+	assert.NoError(t, err)
+	assert.NoError(t, bf.Close())
+
+	// writers created with Create share the options
+	second, err := bf.Create("second")
+	assert.NoError(t, err)
+	_, err = second.Write([]byte("data"))
+	assert.NoError(t, err)
+	assert.NoError(t, second.Close())
+
+	for _, key := range []string{"first", "second"} {
+		attrs, err := b.Attributes(ctx, key)
+		assert.NoError(t, err)
+		assert.Equal(t, "application/vnd.apache.parquet", attrs.ContentType)
+		assert.Equal(t, map[string]string{"origin": "test"}, attrs.Metadata)
+	}
+	assert.Equal(t, 2, hooks)
+}
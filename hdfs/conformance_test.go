@@ -0,0 +1,55 @@
+package hdfs
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/colinmarc/hdfs/v2"
+	"github.com/xitongsys/parquet-go-source/sourcetest"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// TestConformance runs against the namenode at HDFS_NAMENODE, e.g.
+// localhost:9000, as HDFS_USER.
+//
+// Without it this package has no coverage: the Read loop, Seek, Abort and the
+// classification of errors are only exercised against a real cluster. The
+// client speaks Hadoop RPC to the namenode and the data transfer protocol to
+// the datanodes, so there is no in-process fake like s3fake or gcsfake, and
+// HdfsFile exposes the concrete reader and writer of the client, so they
+// cannot be stubbed either. Run a single node cluster, e.g. the apache/hadoop
+// image, to test changes to this package.
+func TestConformance(t *testing.T) {
+	namenode := os.Getenv("HDFS_NAMENODE")
+	if namenode == "" {
+		t.Skip("HDFS_NAMENODE is not set, the hdfs package is not tested without a cluster")
+	}
+	hosts := []string{namenode}
+	user := os.Getenv("HDFS_USER")
+
+	client, err := hdfs.NewClient(hdfs.ClientOptions{Addresses: hosts, User: user})
+	if err != nil {
+		t.Fatalf("failed to connect to %s: %v", namenode, err)
+	}
+	defer client.Close()
+	dir := fmt.Sprintf("/tmp/parquet-go-source-%d", time.Now().UnixNano())
+	if err = client.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("failed to create %s: %v", dir, err)
+	}
+	defer client.RemoveAll(dir)
+
+	sourcetest.RunConformance(t, sourcetest.Factory{
+		Open: func(name string) (source.ParquetFile, error) {
+			return NewHdfsFileReader(hosts, user, name)
+		},
+		Create: func(name string) (source.ParquetFile, error) {
+			return NewHdfsFileWriter(hosts, user, name)
+		},
+		Path: func(name string) string {
+			return path.Join(dir, name)
+		},
+	})
+}
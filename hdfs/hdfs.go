@@ -1,7 +1,10 @@
 package hdfs
 
 import (
+	"io"
+
 	"github.com/colinmarc/hdfs/v2"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
 	"github.com/xitongsys/parquet-go/source"
 )
 
@@ -13,6 +16,8 @@ type HdfsFile struct {
 	FilePath   string
 	FileReader *hdfs.FileReader
 	FileWriter *hdfs.FileWriter
+
+	closed bool
 }
 
 func NewHdfsFileWriter(hosts []string, user string, name string) (source.ParquetFile, error) {
@@ -47,7 +52,7 @@ func (self *HdfsFile) Create(name string) (source.ParquetFile, error) {
 		return hf, err
 	}
 	hf.FileWriter, err = hf.Client.Create(name)
-	return hf, err
+	return hf, sourceerrors.Classify(err)
 
 }
 func (self *HdfsFile) Open(name string) (source.ParquetFile, error) {
@@ -70,7 +75,7 @@ func (self *HdfsFile) Open(name string) (source.ParquetFile, error) {
 		return hf, err
 	}
 	hf.FileReader, err = hf.Client.Open(name)
-	return hf, err
+	return hf, sourceerrors.Classify(err)
 }
 func (self *HdfsFile) Seek(offset int64, pos int) (int64, error) {
 	return self.FileReader.Seek(offset, pos)
@@ -86,14 +91,36 @@ func (self *HdfsFile) Read(b []byte) (cnt int, err error) {
 			break
 		}
 	}
-	return cnt, err
+	// io.EOF is only reported once no data is left
+	if err == io.EOF && cnt > 0 {
+		err = nil
+	}
+	return cnt, sourceerrors.Classify(err)
 }
 
 func (self *HdfsFile) Write(b []byte) (n int, err error) {
-	return self.FileWriter.Write(b)
+	n, err = self.FileWriter.Write(b)
+	return n, sourceerrors.Classify(err)
+}
+
+// Abort closes and removes the file being written. HDFS has no way to discard
+// the blocks of an open file, so they are briefly visible until the file is
+// removed. Abort has no effect on files opened for reading or once Close has
+// returned.
+func (self *HdfsFile) Abort(err error) error {
+	if self.FileWriter == nil || self.closed {
+		return nil
+	}
+
+	self.FileWriter.Close()
+	self.FileWriter = nil
+	removeErr := self.Client.Remove(self.FilePath)
+	self.Close()
+	return sourceerrors.Classify(removeErr)
 }
 
 func (self *HdfsFile) Close() error {
+	self.closed = true
 	if self.FileReader != nil {
 		self.FileReader.Close()
 	}
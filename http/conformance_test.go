@@ -0,0 +1,135 @@
+package http
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"github.com/xitongsys/parquet-go-source/footer"
+	"github.com/xitongsys/parquet-go-source/sourcetest"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+func TestConformance(t *testing.T) {
+	var (
+		lock  sync.RWMutex
+		files = map[string][]byte{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.RLock()
+		data, ok := files[req.URL.Path]
+		lock.RUnlock()
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("ETag", fmt.Sprintf("\"%x\"", md5.Sum(data)))
+		http.ServeContent(w, req, req.URL.Path, time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	for _, minRequestSize := range []int{0, 1000} {
+		for _, footerCache := range []*footer.Cache{nil, footer.NewCache(1000, 0)} {
+			name := fmt.Sprintf("MinRequestSize=%d/FooterCache=%t", minRequestSize, footerCache != nil)
+			minRequestSize, footerCache := minRequestSize, footerCache
+			t.Run(name, func(t *testing.T) {
+				sourcetest.RunConformance(t, sourcetest.Factory{
+					Open: func(name string) (source.ParquetFile, error) {
+						return NewHttpReaderWithParams(srv.URL+"/"+name, HttpReaderParams{
+							FooterCache:    footerCache,
+							MinRequestSize: minRequestSize,
+						})
+					},
+					Put: func(name string, data []byte) error {
+						lock.Lock()
+						files["/"+name] = data
+						lock.Unlock()
+						return nil
+					},
+					SingleObject: true,
+				})
+			})
+		}
+	}
+
+	// a server ignoring ranges is read from a download
+	noRange := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.Header.Del("Range")
+		srv.Config.Handler.ServeHTTP(w, req)
+	}))
+	defer noRange.Close()
+
+	for _, threshold := range []int64{0, 1} {
+		name := fmt.Sprintf("DownloadFallback/SpoolThreshold=%d", threshold)
+		threshold := threshold
+		t.Run(name, func(t *testing.T) {
+			sourcetest.RunConformance(t, sourcetest.Factory{
+				Open: func(name string) (source.ParquetFile, error) {
+					return NewHttpReaderWithParams(noRange.URL+"/"+name, HttpReaderParams{
+						DownloadFallback: true,
+						SpoolThreshold:   threshold,
+						SpoolDir:         t.TempDir(),
+					})
+				},
+				Put: func(name string, data []byte) error {
+					lock.Lock()
+					files["/"+name] = data
+					lock.Unlock()
+					return nil
+				},
+				SingleObject: true,
+			})
+		})
+	}
+}
+
+func TestObjectChanged(t *testing.T) {
+	var (
+		lock        sync.Mutex
+		data        = []byte("old content")
+		ignoreMatch bool
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if ignoreMatch {
+			req.Header.Del("If-Match")
+		}
+		w.Header().Set("ETag", fmt.Sprintf("\"%x\"", md5.Sum(data)))
+		http.ServeContent(w, req, req.URL.Path, time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	for _, ignore := range []bool{false, true} {
+		lock.Lock()
+		data = []byte("old content")
+		ignoreMatch = ignore
+		lock.Unlock()
+
+		r, err := NewHttpReaderWithParams(srv.URL+"/file", HttpReaderParams{})
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		clone, err := r.Open("")
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+
+		lock.Lock()
+		data = []byte("new content")
+		lock.Unlock()
+
+		for _, f := range []source.ParquetFile{r, clone} {
+			if _, err := f.Read(make([]byte, 3)); !errors.Is(err, sourceerrors.ErrObjectChanged) {
+				t.Errorf("ignoreMatch=%t: expected ErrObjectChanged but got %v", ignore, err)
+			}
+		}
+	}
+}
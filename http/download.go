@@ -0,0 +1,145 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+)
+
+// defaultSpoolThreshold is the size of the largest download kept in memory.
+const defaultSpoolThreshold int64 = 32 << 20
+
+// Mode is the way an HttpReader reads the file.
+type Mode int
+
+const (
+	// ModeRange reads the file from the server with range requests.
+	ModeRange Mode = iota
+	// ModeMemory reads the file from a copy downloaded into memory.
+	ModeMemory
+	// ModeTempFile reads the file from a copy downloaded into a temporary file.
+	ModeTempFile
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModeRange:
+		return "range"
+	case ModeMemory:
+		return "memory"
+	case ModeTempFile:
+		return "temp file"
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// download is a copy of the file shared by a reader and its clones. The
+// temporary file, if any, is removed when the last of them is closed.
+type download struct {
+	data io.ReaderAt
+	file *os.File
+	mode Mode
+
+	lock sync.Mutex
+	refs int
+}
+
+func (d *download) acquire() *download {
+	d.lock.Lock()
+	d.refs++
+	d.lock.Unlock()
+	return d
+}
+
+func (d *download) release() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.refs--
+	if d.refs == 0 && d.file != nil {
+		d.file.Close()
+		os.Remove(d.file.Name())
+	}
+}
+
+// acceptsRanges asks the server with a HEAD request whether it supports
+// ranges. It only returns false if the server says it does not; servers which
+// do not answer HEAD requests or advertise nothing are probed with a range.
+func (r *HttpReader) acceptsRanges() (bool, error) {
+	req, err := r.newRequest(http.MethodHead)
+	if err != nil {
+		return false, err
+	}
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true, nil
+	}
+	if kind := sourceerrors.KindOfStatus(resp.StatusCode); kind != nil {
+		return false, sourceerrors.Wrap(kind, fmt.Errorf("unexpected status reading [%s]: %s", r.url, resp.Status))
+	}
+	return !strings.EqualFold(strings.TrimSpace(resp.Header.Get("Accept-Ranges")), "none"), nil
+}
+
+// downloadFile copies the body of resp, or of a new request if resp is nil,
+// into memory or a temporary file, depending on its size.
+func (r *HttpReader) downloadFile(resp *http.Response, threshold int64, dir string) error {
+	if resp == nil {
+		req, err := r.newRequest(http.MethodGet)
+		if err != nil {
+			return err
+		}
+		if resp, err = r.httpClient.Do(req); err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return sourceerrors.Wrap(sourceerrors.KindOfStatus(resp.StatusCode), fmt.Errorf("unexpected status reading [%s]: %s", r.url, resp.Status))
+		}
+	}
+	if threshold == 0 {
+		threshold = defaultSpoolThreshold
+	}
+
+	// files of unknown size are buffered until they exceed the threshold
+	var buf bytes.Buffer
+	if resp.ContentLength <= threshold {
+		n, err := io.CopyN(&buf, resp.Body, threshold+1)
+		if err == io.EOF {
+			r.size = n
+			r.etag = resp.Header.Get("ETag")
+			r.download = (&download{data: bytes.NewReader(buf.Bytes()), mode: ModeMemory}).acquire()
+			return nil
+		}
+		if err != nil {
+			return sourceerrors.Classify(err)
+		}
+	}
+
+	f, err := ioutil.TempFile(dir, "parquet-http-*.download")
+	if err != nil {
+		return sourceerrors.Classify(err)
+	}
+	size, err := io.Copy(f, io.MultiReader(&buf, resp.Body))
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return sourceerrors.Classify(err)
+	}
+	r.size = size
+	r.etag = resp.Header.Get("ETag")
+	r.download = (&download{data: f, file: f, mode: ModeTempFile}).acquire()
+	return nil
+}
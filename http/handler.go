@@ -0,0 +1,111 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"time"
+
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// ParquetContentType is the media type of parquet files.
+const ParquetContentType = "application/vnd.apache.parquet"
+
+// ParquetFileHandler serves the files returned by a function resolving the
+// path of the request, e.g. to expose files of any backend to browser based
+// readers issuing range requests.
+type ParquetFileHandler struct {
+	open func(path string) (source.ParquetFile, error)
+}
+
+// NewParquetFileHandler creates a handler serving the file returned by open
+// for the path of each request. Files are closed once served. The path is
+// cleaned first, so it is rooted and has no ".." elements.
+//
+// The handler answers HEAD and GET requests, with 206 responses to single and
+// multiple ranges (as multipart/byteranges), and honours If-None-Match and
+// If-Range against an ETag derived from the Identity of the file, if it has
+// one. Files of the local package are sent with sendfile where available.
+// Errors of open matching sourceerrors.ErrNotFound and
+// sourceerrors.ErrPermissionDenied are reported as 404 and 403.
+func NewParquetFileHandler(open func(path string) (source.ParquetFile, error)) *ParquetFileHandler {
+	return &ParquetFileHandler{open: open}
+}
+
+func (h *ParquetFileHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := path.Clean("/" + req.URL.Path)
+	f, err := h.open(name)
+	if err != nil {
+		status := statusOfError(err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	defer f.Close()
+
+	header := w.Header()
+	if header.Get("Content-Type") == "" {
+		// prevents ServeContent from reading the file to sniff its type
+		header.Set("Content-Type", ParquetContentType)
+	}
+	if etag := etagOf(f); etag != "" && header.Get("ETag") == "" {
+		header.Set("ETag", etag)
+	}
+
+	var content io.ReadSeeker = f
+	var modTime time.Time
+	if lf, ok := f.(*local.LocalFile); ok && lf.File != nil {
+		// io.Copy of an *os.File to the connection uses sendfile
+		content = lf.File
+		if info, err := lf.File.Stat(); err == nil {
+			modTime = info.ModTime()
+		}
+	}
+	http.ServeContent(w, req, path.Base(name), modTime, content)
+}
+
+// identifier is implemented by files that can name the object version they
+// read, see cache.Identifier.
+type identifier interface {
+	Identity() string
+}
+
+// etagOf returns a strong ETag naming the version of f, or "" if f does not
+// know it.
+func etagOf(f source.ParquetFile) string {
+	identifier, ok := f.(identifier)
+	if !ok {
+		return ""
+	}
+	identity := identifier.Identity()
+	if identity == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(identity))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// statusOfError maps the kind of an error opening a file to a status.
+func statusOfError(err error) int {
+	switch {
+	case errors.Is(err, sourceerrors.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, sourceerrors.ErrPermissionDenied):
+		return http.StatusForbidden
+	case errors.Is(err, sourceerrors.ErrThrottled):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,194 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go-source/s3fake"
+	"github.com/xitongsys/parquet-go-source/s3v2"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// newFileServer serves data as a local file, a buffer and an S3 object.
+func newFileServer(t *testing.T, data []byte) *httptest.Server {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "file.parquet"), data, 0644); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	s3 := s3fake.NewServer()
+	t.Cleanup(s3.Close)
+	s3.PutObject("bucket", "s3.parquet", data)
+	client := s3.ClientV2()
+
+	return httptest.NewServer(NewParquetFileHandler(func(path string) (source.ParquetFile, error) {
+		switch path {
+		case "/buffer.parquet":
+			return buffer.NewBufferFileFromBytes(data), nil
+		case "/s3.parquet":
+			return s3v2.NewS3FileReaderWithClient(context.Background(), client, "bucket", "s3.parquet")
+		}
+		return local.NewLocalFileReader(filepath.Join(dir, filepath.FromSlash(path)))
+	}))
+}
+
+func doRequest(t *testing.T, method, url string, header map[string]string) (*http.Response, []byte) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	return resp, body
+}
+
+func TestHandlerRanges(t *testing.T) {
+	data := []byte("PAR1 0123456789 PAR1")
+	srv := newFileServer(t, data)
+	defer srv.Close()
+
+	for _, name := range []string{"/file.parquet", "/buffer.parquet", "/s3.parquet"} {
+		resp, body := doRequest(t, http.MethodGet, srv.URL+name, nil)
+		if resp.StatusCode != http.StatusOK || string(body) != string(data) {
+			t.Errorf("%s: expected the file but got %d %q", name, resp.StatusCode, body)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != ParquetContentType {
+			t.Errorf("%s: expected Content-Type %s but got %s", name, ParquetContentType, ct)
+		}
+
+		resp, body = doRequest(t, http.MethodHead, srv.URL+name, nil)
+		if resp.StatusCode != http.StatusOK || resp.ContentLength != int64(len(data)) || len(body) != 0 {
+			t.Errorf("%s: expected the length without a body but got %d %d %q", name, resp.StatusCode, resp.ContentLength, body)
+		}
+
+		resp, body = doRequest(t, http.MethodGet, srv.URL+name, map[string]string{"Range": "bytes=-4"})
+		if resp.StatusCode != http.StatusPartialContent || string(body) != "PAR1" || resp.Header.Get("Content-Range") != "bytes 16-19/20" {
+			t.Errorf("%s: expected the footer but got %d %q (%s)", name, resp.StatusCode, body, resp.Header.Get("Content-Range"))
+		}
+
+		resp, body = doRequest(t, http.MethodGet, srv.URL+name, map[string]string{"Range": "bytes=0-3,5-6"})
+		mediaType, params, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if resp.StatusCode != http.StatusPartialContent || mediaType != "multipart/byteranges" {
+			t.Fatalf("%s: expected multipart/byteranges but got %d %s", name, resp.StatusCode, mediaType)
+		}
+		var parts []string
+		mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("expected error to be nil but got %q", err.Error())
+			}
+			b, _ := ioutil.ReadAll(part)
+			parts = append(parts, string(b))
+		}
+		if len(parts) != 2 || parts[0] != "PAR1" || parts[1] != "01" {
+			t.Errorf("%s: expected two ranges but got %q", name, parts)
+		}
+	}
+}
+
+func TestHandlerConditions(t *testing.T) {
+	data := []byte("PAR1 0123456789 PAR1")
+	srv := newFileServer(t, data)
+	defer srv.Close()
+
+	for _, name := range []string{"/file.parquet", "/s3.parquet"} {
+		resp, _ := doRequest(t, http.MethodHead, srv.URL+name, nil)
+		etag := resp.Header.Get("ETag")
+		if etag == "" {
+			t.Fatalf("%s: expected an ETag", name)
+		}
+
+		resp, body := doRequest(t, http.MethodGet, srv.URL+name, map[string]string{"If-None-Match": etag})
+		if resp.StatusCode != http.StatusNotModified || len(body) != 0 {
+			t.Errorf("%s: expected 304 but got %d %q", name, resp.StatusCode, body)
+		}
+
+		resp, body = doRequest(t, http.MethodGet, srv.URL+name, map[string]string{"Range": "bytes=0-3", "If-Range": etag})
+		if resp.StatusCode != http.StatusPartialContent || string(body) != "PAR1" {
+			t.Errorf("%s: expected the range for a matching If-Range but got %d %q", name, resp.StatusCode, body)
+		}
+
+		// a changed file is sent whole
+		resp, body = doRequest(t, http.MethodGet, srv.URL+name, map[string]string{"Range": "bytes=0-3", "If-Range": `"other"`})
+		if resp.StatusCode != http.StatusOK || string(body) != string(data) {
+			t.Errorf("%s: expected the file for a stale If-Range but got %d %q", name, resp.StatusCode, body)
+		}
+	}
+
+	// files without an Identity have no ETag
+	resp, _ := doRequest(t, http.MethodHead, srv.URL+"/buffer.parquet", nil)
+	if resp.Header.Get("ETag") != "" {
+		t.Errorf("expected no ETag for a buffer but got %s", resp.Header.Get("ETag"))
+	}
+}
+
+func TestHandlerCleansPath(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(NewParquetFileHandler(func(path string) (source.ParquetFile, error) {
+		paths = append(paths, path)
+		return buffer.NewBufferFileFromBytes([]byte("PAR1")), nil
+	}))
+	defer srv.Close()
+
+	for _, p := range []string{"/dir/../file.parquet", "/../../file.parquet", "/dir/./file.parquet"} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		// sent as is, without the cleaning of the client
+		req.URL.Opaque = p
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		resp.Body.Close()
+	}
+
+	want := []string{"/file.parquet", "/file.parquet", "/dir/file.parquet"}
+	if len(paths) != len(want) {
+		t.Fatalf("expected %q but got %q", want, paths)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Errorf("expected %q but got %q", want[i], paths[i])
+		}
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	srv := newFileServer(t, []byte("PAR1"))
+	defer srv.Close()
+
+	resp, _ := doRequest(t, http.MethodGet, srv.URL+"/missing.parquet", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 but got %d", resp.StatusCode)
+	}
+
+	resp, _ = doRequest(t, http.MethodPut, srv.URL+"/file.parquet", nil)
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != "GET, HEAD" {
+		t.Errorf("expected 405 but got %d", resp.StatusCode)
+	}
+}
@@ -2,8 +2,10 @@ package http
 
 import (
 	"errors"
-	"github.com/xitongsys/parquet-go/source"
 	"mime/multipart"
+
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"github.com/xitongsys/parquet-go/source"
 )
 
 type MultipartFileWrapper struct {
@@ -16,7 +18,7 @@ func NewMultipartFileWrapper(fh *multipart.FileHeader, f multipart.File) source.
 }
 
 func (mfw *MultipartFileWrapper) Create(_ string) (source.ParquetFile, error) {
-	return nil, errors.New("cannot create a new multipart file")
+	return nil, sourceerrors.Wrap(sourceerrors.ErrNotSupported, errors.New("cannot create a new multipart file"))
 }
 
 // this method is called multiple times on one file to open parallel readers
@@ -37,7 +39,7 @@ func (mfw *MultipartFileWrapper) Read(p []byte) (int, error) {
 }
 
 func (mfw *MultipartFileWrapper) Write(_ []byte) (int, error) {
-	return 0, errors.New("cannot write to request file")
+	return 0, sourceerrors.Wrap(sourceerrors.ErrNotSupported, errors.New("cannot write to request file"))
 }
 
 func (mfw *MultipartFileWrapper) Close() error {
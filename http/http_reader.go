@@ -2,6 +2,7 @@ package http
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
@@ -9,18 +10,79 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"github.com/xitongsys/parquet-go-source/footer"
+	"github.com/xitongsys/parquet-go-source/stream"
 	"github.com/xitongsys/parquet-go/source"
 )
 
 type HttpReader struct {
-	url          string
-	size         int64
-	offset       int64
+	url    string
+	size   int64
+	offset int64
+	// stream keeps a response open across sequential reads
+	stream       stream.Reader
 	httpClient   *http.Client
 	extraHeaders map[string]string
+	authorize    func(req *http.Request) error
+	etag         string
+	footerCache  *footer.Cache
+	footer       *footer.Tail
+	// download is the copy read from if the server does not support ranges
+	download *download
+}
 
-	dedicatedTransport bool
+// HttpReaderParams contains fields used to initialize and configure an HttpReader
+type HttpReaderParams struct {
+	// Client sends the requests of the reader instead of a client built from
+	// the other params. Optional.
+	Client *http.Client
+	// Transport sends the requests of the reader if Client is not set, e.g. to
+	// trace or sign them. Optional.
+	Transport http.RoundTripper
+	// DedicatedTransport makes the reader use its own http.Transport instead of
+	// http.DefaultTransport. Ignored if a default client, Client or Transport is
+	// set. Optional.
+	DedicatedTransport bool
+	// IgnoreTLSError disables verification of the server certificate. Ignored if
+	// a default client, Client or Transport is set. Optional.
+	IgnoreTLSError bool
+	// Certificates are presented to servers requiring a client certificate.
+	// Ignored if Client or Transport is set. Optional.
+	Certificates []tls.Certificate
+	// RootCAs verify the server certificate instead of the roots of the system.
+	// Ignored if Client or Transport is set. Optional.
+	RootCAs *x509.CertPool
+	// ExtraHeaders are added to every request. Optional.
+	ExtraHeaders map[string]string
+	// Username and Password are sent with basic authentication if Username is
+	// set. Optional.
+	Username string
+	Password string
+	// Authorize is called before every request, including those of readers
+	// created through Open, e.g. to set a bearer token refreshed before it
+	// expires, or to re-sign a presigned URL by replacing req.URL. Optional.
+	Authorize func(req *http.Request) error
+	// FooterCache, if set, makes the reader fetch the end of the file in a single
+	// request when it is opened and serve the parquet footer from memory, sharing it
+	// with all readers created through Open. Optional.
+	FooterCache *footer.Cache
+	// MinRequestSize is the minimum amount of data requested from the server at
+	// a time, see package stream. Defaults to the rest of the file. Optional.
+	MinRequestSize int
+	// DownloadFallback makes the reader download the whole file once and read
+	// from the copy if the server does not support ranges, instead of failing.
+	// A HEAD request first checks whether the server says so with
+	// Accept-Ranges. Mode tells which way the file is read. Optional.
+	DownloadFallback bool
+	// SpoolThreshold is the size of the largest download kept in memory. Larger
+	// ones are written to a temporary file. Defaults to 32 MiB. Optional.
+	SpoolThreshold int64
+	// SpoolDir is the directory of the temporary file. Defaults to
+	// os.TempDir(). Optional.
+	SpoolDir string
 }
 
 const (
@@ -31,133 +93,444 @@ const (
 
 var (
 	defaultClient *http.Client
+
+	// insecureTransport is shared by the clients ignoring TLS errors without a
+	// dedicated transport.
+	insecureTransport     http.RoundTripper
+	insecureTransportOnce sync.Once
+
+	errIgnoredRange = errors.New("server ignored the Range header")
 )
 
 func SetDefaultClient(client *http.Client) {
 	defaultClient = client
 }
 
-func NewHttpReader(uri string, dedicatedTransport, ignoreTLSError bool, extraHeaders map[string]string) (source.ParquetFile, error) {
-	var client *http.Client
+// newClient returns the default client if one is set, and otherwise a client
+// using http.DefaultTransport or a dedicated transport.
+func newClient(dedicatedTransport, ignoreTLSError bool) *http.Client {
 	if defaultClient != nil {
-		client = defaultClient
-	} else {
-		// make sure remote support range
-		transport := http.DefaultTransport
-		if dedicatedTransport {
-			transport = &http.Transport{}
+		return defaultClient
+	}
+
+	switch {
+	case dedicatedTransport:
+		return &http.Client{Transport: newTransport(&tls.Config{InsecureSkipVerify: ignoreTLSError})}
+	case ignoreTLSError:
+		insecureTransportOnce.Do(func() {
+			insecureTransport = newTransport(&tls.Config{InsecureSkipVerify: true})
+		})
+		return &http.Client{Transport: insecureTransport}
+	}
+	return &http.Client{Transport: http.DefaultTransport}
+}
+
+// newTransport returns a copy of http.DefaultTransport, keeping its proxy and
+// timeouts, with the given TLS config. http.DefaultTransport is left untouched,
+// and may be any RoundTripper.
+func newTransport(config *tls.Config) *http.Transport {
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		transport = &http.Transport{Proxy: http.ProxyFromEnvironment}
+	}
+	transport = transport.Clone()
+	transport.TLSClientConfig = config
+	return transport
+}
+
+// clientParams are the params configuring the client and the authentication
+// of readers and writers.
+type clientParams struct {
+	Client             *http.Client
+	Transport          http.RoundTripper
+	DedicatedTransport bool
+	IgnoreTLSError     bool
+	Certificates       []tls.Certificate
+	RootCAs            *x509.CertPool
+	Username           string
+	Password           string
+	Authorize          func(req *http.Request) error
+}
+
+// clientParams returns the params of the client of the reader.
+func (params HttpReaderParams) clientParams() clientParams {
+	return clientParams{
+		Client:             params.Client,
+		Transport:          params.Transport,
+		DedicatedTransport: params.DedicatedTransport,
+		IgnoreTLSError:     params.IgnoreTLSError,
+		Certificates:       params.Certificates,
+		RootCAs:            params.RootCAs,
+		Username:           params.Username,
+		Password:           params.Password,
+		Authorize:          params.Authorize,
+	}
+}
+
+// client returns the client configured by params.
+func (params clientParams) client() *http.Client {
+	switch {
+	case params.Client != nil:
+		return params.Client
+	case params.Transport != nil:
+		return &http.Client{Transport: params.Transport}
+	case len(params.Certificates) > 0 || params.RootCAs != nil:
+		return &http.Client{Transport: newTransport(&tls.Config{
+			Certificates:       params.Certificates,
+			RootCAs:            params.RootCAs,
+			InsecureSkipVerify: params.IgnoreTLSError,
+		})}
+	}
+	return newClient(params.DedicatedTransport, params.IgnoreTLSError)
+}
+
+// authorizer returns the function authenticating the requests, or nil.
+func (params clientParams) authorizer() func(req *http.Request) error {
+	if params.Username == "" {
+		return params.Authorize
+	}
+	return func(req *http.Request) error {
+		req.SetBasicAuth(params.Username, params.Password)
+		if params.Authorize != nil {
+			return params.Authorize(req)
+		}
+		return nil
+	}
+}
+
+func NewHttpReader(uri string, dedicatedTransport, ignoreTLSError bool, extraHeaders map[string]string) (source.ParquetFile, error) {
+	return NewHttpReaderWithParams(uri, HttpReaderParams{
+		DedicatedTransport: dedicatedTransport,
+		IgnoreTLSError:     ignoreTLSError,
+		ExtraHeaders:       extraHeaders,
+	})
+}
+
+// NewHttpReaderWithParams creates an HttpReader with the given params
+func NewHttpReaderWithParams(uri string, params HttpReaderParams) (source.ParquetFile, error) {
+	r := &HttpReader{
+		url:          uri,
+		offset:       0,
+		stream:       stream.Reader{MinRequestSize: int64(params.MinRequestSize)},
+		httpClient:   params.clientParams().client(),
+		extraHeaders: params.ExtraHeaders,
+		authorize:    params.clientParams().authorizer(),
+		footerCache:  params.FooterCache,
+	}
+
+	if params.DownloadFallback {
+		ranges, err := r.acceptsRanges()
+		if err != nil {
+			return nil, err
+		}
+		if !ranges {
+			if err = r.downloadFile(nil, params.SpoolThreshold, params.SpoolDir); err != nil {
+				return nil, err
+			}
+			return r, nil
 		}
-		transport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: ignoreTLSError}
-		client = &http.Client{Transport: transport}
 	}
 
-	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	// make sure remote support range
+	req, err := r.newRequest(http.MethodGet)
 	if err != nil {
 		return nil, err
 	}
-	for k, v := range extraHeaders {
-		req.Header.Add(k, v)
-	}
 	req.Header.Add(rangeHeader, fmt.Sprintf(rangeFormat, 0, 0))
-	resp, err := client.Do(req)
+	resp, err := r.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if kind := sourceerrors.KindOfStatus(resp.StatusCode); kind != nil {
+		return nil, sourceerrors.Wrap(kind, fmt.Errorf("unexpected status reading [%s]: %s", uri, resp.Status))
+	}
+
 	// retrieve size
 	contentRange := resp.Header.Values(contentRangeHeader)
 	if len(contentRange) == 0 {
-		return nil, fmt.Errorf("remote [%s] does not support range", uri)
+		if params.DownloadFallback && resp.StatusCode == http.StatusOK {
+			// the response holds the whole file
+			if err = r.downloadFile(resp, params.SpoolThreshold, params.SpoolDir); err != nil {
+				return nil, err
+			}
+			return r, nil
+		}
+		return nil, sourceerrors.Wrap(sourceerrors.ErrNotSupported, fmt.Errorf("remote [%s] does not support range", uri))
+	}
+
+	_, _, size, err := parseContentRange(contentRange[0])
+	if err != nil {
+		return nil, err
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("unable to parse data size from %s: %s", contentRangeHeader, contentRange[0])
 	}
 
-	tmp := strings.Split(contentRange[0], "/")
-	if len(tmp) != 2 {
-		return nil, fmt.Errorf("%s format is unknown: %s", contentRangeHeader, contentRange[0])
+	r.size = size
+	r.etag = resp.Header.Get("ETag")
+	if err := r.loadFooter(); err != nil {
+		return nil, err
 	}
+	return r, nil
+}
 
-	size, err := strconv.ParseInt(tmp[1], 10, 64)
+// Mode tells whether the reader reads the file with range requests or from a
+// downloaded copy.
+func (r *HttpReader) Mode() Mode {
+	if r.download != nil {
+		return r.download.mode
+	}
+	return ModeRange
+}
+
+// newRequest creates an authorized request for the file with the extra
+// headers.
+func (r *HttpReader) newRequest(method string) (*http.Request, error) {
+	req, err := http.NewRequest(method, r.url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse data size from %s: %s", contentRangeHeader, contentRange[0])
+		return nil, err
+	}
+	for k, v := range r.extraHeaders {
+		req.Header.Add(k, v)
+	}
+	if r.authorize != nil {
+		if err = r.authorize(req); err != nil {
+			return nil, err
+		}
 	}
+	return req, nil
+}
 
-	return &HttpReader{
-		url:                uri,
-		size:               size,
-		offset:             0,
-		httpClient:         client,
-		extraHeaders:       extraHeaders,
-		dedicatedTransport: dedicatedTransport,
-	}, nil
+// loadFooter fetches the end of the file through the footer cache, if one is
+// configured.
+func (r *HttpReader) loadFooter() error {
+	if r.footerCache == nil || r.size < 1 {
+		return nil
+	}
+
+	tail, err := r.footerCache.Get(footer.Key{
+		Backend: "http",
+		Name:    r.url,
+		Version: r.version(),
+		Size:    r.size,
+	}, r.fetchRange)
+	if err != nil {
+		return err
+	}
+	r.footer = tail
+	return nil
+}
+
+// fetchRange reads length bytes at offset with a single range request.
+func (r *HttpReader) fetchRange(offset, length int64) ([]byte, error) {
+	resp, err := r.getRange(offset, offset+length-1)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// version returns the ETag of the file if it is strong. Weak ETags do not
+// identify the bytes, so they cannot be used to pin the content.
+func (r *HttpReader) version() string {
+	if strings.HasPrefix(r.etag, "W/") {
+		return ""
+	}
+	return r.etag
+}
+
+// parseContentRange parses a "bytes start-end/size" header. size is -1 if the
+// server does not know it.
+func parseContentRange(value string) (start, end, size int64, err error) {
+	spec := strings.TrimPrefix(value, "bytes ")
+	tmp := strings.Split(spec, "/")
+	bounds := strings.Split(tmp[0], "-")
+	if spec == value || len(tmp) != 2 || len(bounds) != 2 {
+		return 0, 0, 0, fmt.Errorf("%s format is unknown: %s", contentRangeHeader, value)
+	}
+
+	start, err = strconv.ParseInt(bounds[0], 10, 64)
+	if err == nil {
+		end, err = strconv.ParseInt(bounds[1], 10, 64)
+	}
+	size = -1
+	if err == nil && tmp[1] != "*" {
+		size, err = strconv.ParseInt(tmp[1], 10, 64)
+	}
+	if err != nil || end < start {
+		return 0, 0, 0, fmt.Errorf("%s format is unknown: %s", contentRangeHeader, value)
+	}
+	return start, end, size, nil
+}
+
+// getRange requests the bytes between start and end, inclusive. The request
+// is conditioned on the version seen when the reader was created, and an
+// ObjectChangedError is returned if the server has another one. The response
+// must be a 206 starting at start, as a server ignoring the range would
+// otherwise send the wrong bytes; it may end before end.
+func (r *HttpReader) getRange(start, end int64) (*http.Response, error) {
+	req, err := r.newRequest(http.MethodGet)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add(rangeHeader, fmt.Sprintf(rangeFormat, start, end))
+	version := r.version()
+	if version != "" {
+		req.Header.Set("If-Match", version)
+	}
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = r.checkRange(resp, start, end); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// checkRange verifies that resp holds the version of the file being read from
+// offset start, and at most up to end.
+func (r *HttpReader) checkRange(resp *http.Response, start, end int64) error {
+	version := r.version()
+	switch {
+	case resp.StatusCode == http.StatusPreconditionFailed:
+		return &sourceerrors.ObjectChangedError{Name: r.url, Version: version, Err: fmt.Errorf("unexpected status: %s", resp.Status)}
+	case resp.StatusCode == http.StatusOK:
+		return sourceerrors.Wrap(sourceerrors.ErrNotSupported, fmt.Errorf("reading [%s]: %w", r.url, errIgnoredRange))
+	case resp.StatusCode != http.StatusPartialContent:
+		return sourceerrors.Wrap(sourceerrors.KindOfStatus(resp.StatusCode), fmt.Errorf("unexpected status reading [%s]: %s", r.url, resp.Status))
+	case version != "" && resp.Header.Get("ETag") != "" && resp.Header.Get("ETag") != version:
+		// the server ignored If-Match
+		return &sourceerrors.ObjectChangedError{Name: r.url, Version: version}
+	}
+
+	first, last, size, err := parseContentRange(resp.Header.Get(contentRangeHeader))
+	if err != nil {
+		return err
+	}
+	if size >= 0 && size != r.size {
+		return &sourceerrors.ObjectChangedError{Name: r.url, Version: version, Err: fmt.Errorf("size changed from %d to %d", r.size, size)}
+	}
+	if first != start || last > end {
+		return fmt.Errorf("unexpected range reading [%s]: requested bytes %d-%d but got %s", r.url, start, end, resp.Header.Get(contentRangeHeader))
+	}
+	return nil
 }
 
 func (r *HttpReader) Create(_ string) (source.ParquetFile, error) {
-	return nil, fmt.Errorf("HttpReader does not support Create()")
+	return nil, sourceerrors.Wrap(sourceerrors.ErrNotSupported, errors.New("HttpReader does not support Create()"))
+}
+
+// Identity names the URL and the version being read, e.g. for use as a cache
+// key. It is empty unless the server sent a strong ETag.
+func (r *HttpReader) Identity() string {
+	if r.version() == "" {
+		return ""
+	}
+	return r.url + "#" + r.etag
 }
 
+// Open returns an independent reader for the same URL. The size is already
+// known, so the clone shares the client without probing the server again. A
+// downloaded copy is shared as well.
 func (r *HttpReader) Open(_ string) (source.ParquetFile, error) {
-	return NewHttpReader(
-		r.url,
-		r.dedicatedTransport,
-		r.httpClient.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify,
-		r.extraHeaders,
-	)
+	var d *download
+	if r.download != nil {
+		d = r.download.acquire()
+	}
+	return &HttpReader{
+		url:          r.url,
+		size:         r.size,
+		offset:       0,
+		stream:       stream.Reader{MinRequestSize: r.stream.MinRequestSize},
+		httpClient:   r.httpClient,
+		extraHeaders: r.extraHeaders,
+		authorize:    r.authorize,
+		etag:         r.etag,
+		footerCache:  r.footerCache,
+		footer:       r.footer,
+		download:     d,
+	}, nil
 }
 
+// Seek tracks the offset for the next Read. The response being read is kept
+// unless the offset changes.
 func (r *HttpReader) Seek(offset int64, pos int) (int64, error) {
 	switch pos {
 	case io.SeekStart:
-		r.offset = offset
 	case io.SeekCurrent:
-		r.offset += offset
+		offset += r.offset
 	case io.SeekEnd:
-		r.offset = r.size + offset
+		offset += r.size
 	default:
 		return 0, fmt.Errorf("unknown whence: %d", pos)
 	}
 
-	if r.offset < 0 {
-		r.offset = 0
-	} else if r.offset >= r.size {
-		r.offset = r.size
+	if offset < 0 {
+		return 0, fmt.Errorf("invalid offset: %d", offset)
 	}
+	if offset != r.offset {
+		r.stream.Close()
+	}
+	r.offset = offset
 
 	return r.offset, nil
 }
 
-func (r *HttpReader) Read(b []byte) (int, error) {
-	req, err := http.NewRequest(http.MethodGet, r.url, nil)
-	if err != nil {
-		return 0, err
+// Read fills b unless the end of the file is reached. Sequential reads share a
+// response of at least MinRequestSize bytes, which is read directly into b.
+func (r *HttpReader) Read(b []byte) (n int, err error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
 	}
-
-	for k, v := range r.extraHeaders {
-		req.Header.Add(k, v)
+	if len(b) == 0 {
+		return 0, nil
 	}
-	req.Header.Add(rangeHeader, fmt.Sprintf(rangeFormat, r.offset, r.offset+int64(len(b)-1)))
-	resp, err := r.httpClient.Do(req)
-	if err != nil {
-		return 0, err
+	if r.download != nil {
+		n, err = r.download.data.ReadAt(b, r.offset)
+		r.offset += int64(n)
+		if err == io.EOF && n > 0 {
+			err = nil
+		}
+		return n, err
 	}
-	defer resp.Body.Close()
-
-	buf, err := ioutil.ReadAll(resp.Body)
-	bytesRead := len(buf)
-	for i := 0; i < bytesRead; i++ {
-		b[i] = buf[i]
+	if n, ok := r.footer.ReadAt(b, r.offset); ok {
+		r.stream.Close()
+		r.offset += int64(n)
+		return n, nil
 	}
 
-	r.offset += int64(bytesRead)
-	if r.offset > r.size {
-		r.offset = r.size
+	n, err = r.stream.Read(b, r.offset, r.size, r.openRange)
+	r.offset += int64(n)
+	return n, sourceerrors.Classify(err)
+}
+
+// openRange requests a range of the file for the stream.
+func (r *HttpReader) openRange(offset, length int64) (io.ReadCloser, error) {
+	resp, err := r.getRange(offset, offset+length-1)
+	if err != nil {
+		return nil, err
 	}
-	return bytesRead, err
+	return resp.Body, nil
 }
 
 func (r *HttpReader) Write(_ []byte) (int, error) {
-	return 0, errors.New("HttpReader does not support Write()")
+	return 0, sourceerrors.Wrap(sourceerrors.ErrNotSupported, errors.New("HttpReader does not support Write()"))
 }
 
+// Close releases the response being read. The downloaded copy, if any, is
+// removed once the clones sharing it are closed too.
 func (r *HttpReader) Close() error {
+	r.stream.Close()
+	if r.download != nil {
+		r.download.release()
+		r.download = nil
+	}
 	return nil
 }
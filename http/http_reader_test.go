@@ -1,9 +1,21 @@
 package http
 
 import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
 )
 
 func Test_http_reader_no_range_support(t *testing.T) {
@@ -31,3 +43,341 @@ func Test_http_reader_no_range_support(t *testing.T) {
 		}
 	}
 }
+
+// rangeServer serves data, counting the requests and letting tests tamper with
+// the responses to range requests after the first one.
+type rangeServer struct {
+	*httptest.Server
+	lock     sync.Mutex
+	requests int
+	tamper   func(w http.ResponseWriter, req *http.Request) bool
+}
+
+func newRangeServer(data []byte) *rangeServer {
+	s := &rangeServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s.lock.Lock()
+		s.requests++
+		tamper := s.tamper
+		s.lock.Unlock()
+		if tamper != nil && tamper(w, req) {
+			return
+		}
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	return s
+}
+
+func (s *rangeServer) Requests() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests
+}
+
+func (s *rangeServer) SetTamper(tamper func(w http.ResponseWriter, req *http.Request) bool) {
+	s.lock.Lock()
+	s.tamper = tamper
+	s.lock.Unlock()
+}
+
+func TestReadRequests(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	srv := newRangeServer(data)
+	defer srv.Close()
+
+	r, err := NewHttpReaderWithParams(srv.URL, HttpReaderParams{MinRequestSize: 8})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	defer r.Close()
+	probes := srv.Requests()
+
+	// sequential reads share a response of MinRequestSize bytes
+	buf := make([]byte, 2)
+	for i := 0; i < 4; i++ {
+		if _, err = r.Read(buf); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+	}
+	if string(buf) != "67" || srv.Requests()-probes != 1 {
+		t.Errorf("expected 1 request for the first 8 bytes but got %d", srv.Requests()-probes)
+	}
+
+	if _, err = r.Seek(2, io.SeekStart); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	var rest []byte
+	for {
+		n, err := r.Read(buf)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		rest = append(rest, buf[:n]...)
+	}
+	if !bytes.Equal(rest, data[2:]) || srv.Requests()-probes != 4 {
+		t.Errorf("expected 3 more requests for the rest but got %q in %d", rest, srv.Requests()-probes-1)
+	}
+}
+
+func TestIgnoredRange(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	srv := newRangeServer(data)
+	defer srv.Close()
+
+	r, err := NewHttpReaderWithParams(srv.URL, HttpReaderParams{MinRequestSize: 4})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if _, err = r.Seek(10, io.SeekStart); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	// the whole file, as sent by a server dropping support for ranges
+	srv.SetTamper(func(w http.ResponseWriter, req *http.Request) bool {
+		w.Write(data)
+		return true
+	})
+	if _, err = r.Read(make([]byte, 4)); !errors.Is(err, sourceerrors.ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported but got %v", err)
+	}
+
+	// a range starting elsewhere
+	srv.SetTamper(func(w http.ResponseWriter, req *http.Request) bool {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-3/%d", len(data)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[:4])
+		return true
+	})
+	if n, err := r.Read(make([]byte, 4)); err == nil || n != 0 {
+		t.Errorf("expected the range to be rejected but got %d bytes and %v", n, err)
+	}
+
+	// a different size means the file was replaced
+	srv.SetTamper(func(w http.ResponseWriter, req *http.Request) bool {
+		w.Header().Set("Content-Range", "bytes 10-13/30")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[10:14])
+		return true
+	})
+	if _, err = r.Read(make([]byte, 4)); !errors.Is(err, sourceerrors.ErrObjectChanged) {
+		t.Errorf("expected ErrObjectChanged but got %v", err)
+	}
+}
+
+func TestDownloadFallback(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	srv := newRangeServer(data)
+	defer srv.Close()
+
+	// a server rejecting ranges, as it says in its answer to HEAD
+	srv.SetTamper(func(w http.ResponseWriter, req *http.Request) bool {
+		w.Header().Set("Accept-Ranges", "none")
+		if req.Header.Get("Range") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return true
+		}
+		w.Write(data)
+		return true
+	})
+	if _, err := NewHttpReaderWithParams(srv.URL, HttpReaderParams{}); !errors.Is(err, sourceerrors.ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported without DownloadFallback but got %v", err)
+	}
+
+	// the file is downloaded without sending a range
+	r, err := NewHttpReaderWithParams(srv.URL, HttpReaderParams{DownloadFallback: true})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if mode := r.(*HttpReader).Mode(); mode != ModeMemory {
+		t.Errorf("expected a download into memory but got %s", mode)
+	}
+	requests := srv.Requests()
+	if _, err = r.Seek(-4, io.SeekEnd); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	buf := make([]byte, 8)
+	if n, err := r.Read(buf); err != nil || string(buf[:n]) != "ghij" || srv.Requests() != requests {
+		t.Errorf("expected to read the copy but got %q, %v after %d requests", buf[:n], err, srv.Requests()-requests)
+	}
+	r.Close()
+
+	// a server ignoring ranges, with a file larger than the threshold
+	srv.SetTamper(func(w http.ResponseWriter, req *http.Request) bool {
+		req.Header.Del("Range")
+		return false
+	})
+	dir := t.TempDir()
+	r, err = NewHttpReaderWithParams(srv.URL, HttpReaderParams{DownloadFallback: true, SpoolThreshold: 8, SpoolDir: dir})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if mode := r.(*HttpReader).Mode(); mode != ModeTempFile {
+		t.Errorf("expected a download into a temporary file but got %s", mode)
+	}
+	clone, err := r.Open("")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	r.Close()
+	got, err := ioutil.ReadAll(clone)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("expected the clone to read the copy but got %q, %v", got, err)
+	}
+	clone.Close()
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("expected the temporary file to be removed but got %d files", len(files))
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	srv := newRangeServer(data)
+	defer srv.Close()
+
+	// each request must carry a new token and signature
+	var (
+		lock   sync.Mutex
+		tokens = map[string]bool{}
+	)
+	srv.SetTamper(func(w http.ResponseWriter, req *http.Request) bool {
+		user, password, _ := req.BasicAuth()
+		sig := req.URL.Query().Get("sig")
+		lock.Lock()
+		defer lock.Unlock()
+		if user != "user" || password != "secret" || sig == "" || tokens[sig] {
+			w.WriteHeader(http.StatusUnauthorized)
+			return true
+		}
+		tokens[sig] = true
+		return false
+	})
+
+	var signed int
+	r, err := NewHttpReaderWithParams(srv.URL+"/file", HttpReaderParams{
+		MinRequestSize: 4,
+		Username:       "user",
+		Password:       "secret",
+		Authorize: func(req *http.Request) error {
+			signed++
+			req.URL.RawQuery = fmt.Sprintf("sig=%d", signed)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	clone, err := r.Open("")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	for _, f := range []io.Reader{r, clone} {
+		got, err := ioutil.ReadAll(f)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("expected to read the file with fresh credentials but got %q, %v", got, err)
+		}
+	}
+
+	_, err = NewHttpReaderWithParams(srv.URL+"/file", HttpReaderParams{Username: "user", Password: "wrong"})
+	if !errors.Is(err, sourceerrors.ErrPermissionDenied) {
+		t.Errorf("expected ErrPermissionDenied but got %v", err)
+	}
+
+	cause := errors.New("token expired")
+	_, err = NewHttpReaderWithParams(srv.URL+"/file", HttpReaderParams{
+		Authorize: func(req *http.Request) error { return cause },
+	})
+	if !errors.Is(err, cause) {
+		t.Errorf("expected the error of Authorize but got %v", err)
+	}
+}
+
+// countingTransport counts the requests it sends with next.
+type countingTransport struct {
+	next     http.RoundTripper
+	lock     sync.Mutex
+	requests int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.lock.Lock()
+	c.requests++
+	c.lock.Unlock()
+	return c.next.RoundTrip(req)
+}
+
+func (c *countingTransport) Requests() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.requests
+}
+
+func TestClientParams(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if len(req.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	defaultTransport := http.DefaultTransport.(*http.Transport)
+	// the first Clone sets up HTTP/2, which fills in TLSClientConfig
+	defaultTransport.Clone()
+	tlsConfig := defaultTransport.TLSClientConfig
+	_, err := NewHttpReaderWithParams(srv.URL, HttpReaderParams{IgnoreTLSError: true})
+	if !errors.Is(err, sourceerrors.ErrPermissionDenied) {
+		t.Errorf("expected ErrPermissionDenied without a client certificate but got %v", err)
+	}
+	if defaultTransport.TLSClientConfig != tlsConfig {
+		t.Error("expected http.DefaultTransport to be left untouched")
+	}
+
+	// a client certificate, with the server verified against RootCAs
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	r, err := NewHttpReaderWithParams(srv.URL, HttpReaderParams{Certificates: srv.TLS.Certificates, RootCAs: roots})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	// clones share the transport and do not probe the server again
+	transport := &countingTransport{next: r.(*HttpReader).httpClient.Transport}
+	r, err = NewHttpReaderWithParams(srv.URL, HttpReaderParams{Transport: transport})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	probes := transport.Requests()
+	clone, err := r.Open("")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	got, err := ioutil.ReadAll(clone)
+	if err != nil || !bytes.Equal(got, data) || transport.Requests() != probes+1 {
+		t.Errorf("expected the clone to read the file with a single request but got %q, %v in %d", got, err, transport.Requests()-probes)
+	}
+
+	// a default client with any RoundTripper
+	SetDefaultClient(&http.Client{Transport: transport})
+	defer SetDefaultClient(nil)
+	if _, err = NewHttpReaderWithParams(srv.URL, HttpReaderParams{IgnoreTLSError: true}); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if transport.Requests() != probes+2 {
+		t.Errorf("expected the default client to be used")
+	}
+	SetDefaultClient(nil)
+
+	// a DefaultTransport which is not an *http.Transport
+	http.DefaultTransport = transport
+	defer func() { http.DefaultTransport = defaultTransport }()
+	_, err = NewHttpReaderWithParams(srv.URL, HttpReaderParams{DedicatedTransport: true, IgnoreTLSError: true})
+	if !errors.Is(err, sourceerrors.ErrPermissionDenied) {
+		t.Errorf("expected ErrPermissionDenied without a client certificate but got %v", err)
+	}
+}
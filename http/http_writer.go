@@ -0,0 +1,397 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/xitongsys/parquet-go-source/abort"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// maxErrorBody is the size of the response body kept in a StatusError.
+const maxErrorBody = 64 << 10
+
+var (
+	errWriterClosed = errors.New("HttpWriter is closed")
+	errMethod       = errors.New("HttpWriter: method must be PUT or POST")
+)
+
+// HttpWriter uploads a file to a URL with a single PUT or POST request. The
+// body is streamed with chunked transfer encoding as it is written, or spooled
+// to a temporary file and sent with a Content-Length on Close.
+type HttpWriter struct {
+	url        string
+	httpClient *http.Client
+	authorize  func(req *http.Request) error
+	params     HttpWriterParams
+
+	// streaming uploads
+	pipeWriter *io.PipeWriter
+	writeDone  chan struct{}
+	uploadErr  error
+	cancel     context.CancelFunc
+
+	// spooled uploads
+	spool *os.File
+
+	lock sync.RWMutex
+	// err fails the writes after an upload error or Abort
+	err error
+	// abortErr is the cause given to Abort, returned by Close
+	abortErr error
+	closed   bool
+}
+
+// HttpWriterParams contains fields used to initialize and configure an HttpWriter
+type HttpWriterParams struct {
+	// Method is PUT or POST. Defaults to PUT. Optional.
+	Method string
+	// Spool makes the writer buffer the file in a temporary file and send it
+	// with a Content-Length on Close, for servers that do not accept chunked
+	// uploads. Optional.
+	Spool bool
+	// SpoolDir is the directory of the temporary file. Defaults to
+	// os.TempDir(). Optional.
+	SpoolDir string
+	// Client sends the requests of the writer instead of a client built from
+	// the other params. Optional.
+	Client *http.Client
+	// Transport sends the requests of the writer if Client is not set, e.g. to
+	// trace or sign them. Optional.
+	Transport http.RoundTripper
+	// DedicatedTransport makes the writer use its own http.Transport instead of
+	// http.DefaultTransport. Ignored if a default client, Client or Transport is
+	// set. Optional.
+	DedicatedTransport bool
+	// IgnoreTLSError disables verification of the server certificate. Ignored if
+	// a default client, Client or Transport is set. Optional.
+	IgnoreTLSError bool
+	// Certificates are presented to servers requiring a client certificate.
+	// Ignored if Client or Transport is set. Optional.
+	Certificates []tls.Certificate
+	// RootCAs verify the server certificate instead of the roots of the system.
+	// Ignored if Client or Transport is set. Optional.
+	RootCAs *x509.CertPool
+	// ExtraHeaders are added to every request. Optional.
+	ExtraHeaders map[string]string
+	// Username and Password are sent with basic authentication if Username is
+	// set. Optional.
+	Username string
+	Password string
+	// Authorize is called before every request, including those of writers
+	// created through Create, e.g. to set a bearer token or to sign the
+	// request. Optional.
+	Authorize func(req *http.Request) error
+}
+
+// clientParams returns the params of the client of the writer.
+func (params HttpWriterParams) clientParams() clientParams {
+	return clientParams{
+		Client:             params.Client,
+		Transport:          params.Transport,
+		DedicatedTransport: params.DedicatedTransport,
+		IgnoreTLSError:     params.IgnoreTLSError,
+		Certificates:       params.Certificates,
+		RootCAs:            params.RootCAs,
+		Username:           params.Username,
+		Password:           params.Password,
+		Authorize:          params.Authorize,
+	}
+}
+
+// StatusError is returned when the server answers an upload with a status
+// other than 2xx. It matches the kind of sourceerrors for its status, e.g.
+// sourceerrors.ErrPermissionDenied for 403.
+type StatusError struct {
+	Method string
+	URL    string
+	// StatusCode and Status are those of the response.
+	StatusCode int
+	Status     string
+	// Body holds the start of the response body.
+	Body []byte
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("unexpected status writing [%s] with %s: %s", e.URL, e.Method, e.Status)
+	if len(e.Body) > 0 {
+		msg += ": " + string(e.Body)
+	}
+	return msg
+}
+
+// Is makes errors.Is match the kind of sourceerrors for the status.
+func (e *StatusError) Is(target error) bool {
+	kind := sourceerrors.KindOfStatus(e.StatusCode)
+	return kind != nil && target == kind
+}
+
+func NewHttpWriter(uri string, dedicatedTransport, ignoreTLSError bool, extraHeaders map[string]string) (source.ParquetFile, error) {
+	return NewHttpWriterWithParams(uri, HttpWriterParams{
+		DedicatedTransport: dedicatedTransport,
+		IgnoreTLSError:     ignoreTLSError,
+		ExtraHeaders:       extraHeaders,
+	})
+}
+
+// NewHttpWriterWithParams creates an HttpWriter with the given params. No
+// request is sent before the first Write or Close.
+func NewHttpWriterWithParams(uri string, params HttpWriterParams) (source.ParquetFile, error) {
+	switch params.Method {
+	case "":
+		params.Method = http.MethodPut
+	case http.MethodPut, http.MethodPost:
+	default:
+		return nil, sourceerrors.Wrap(sourceerrors.ErrNotSupported, errMethod)
+	}
+	if _, err := url.Parse(uri); err != nil {
+		return nil, err
+	}
+
+	return &HttpWriter{
+		url:        uri,
+		httpClient: params.clientParams().client(),
+		authorize:  params.clientParams().authorizer(),
+		params:     params,
+	}, nil
+}
+
+// Create returns a writer for name, resolved against the URL of w, with the
+// same params. An empty name addresses the URL of w.
+func (w *HttpWriter) Create(name string) (source.ParquetFile, error) {
+	base, err := url.Parse(w.url)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := url.Parse(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HttpWriter{
+		url:        base.ResolveReference(ref).String(),
+		httpClient: w.httpClient,
+		authorize:  w.authorize,
+		params:     w.params,
+	}, nil
+}
+
+func (w *HttpWriter) Open(_ string) (source.ParquetFile, error) {
+	return nil, sourceerrors.Wrap(sourceerrors.ErrNotSupported, errors.New("HttpWriter does not support Open()"))
+}
+
+func (w *HttpWriter) Seek(_ int64, _ int) (int64, error) {
+	return 0, sourceerrors.Wrap(sourceerrors.ErrNotSupported, errors.New("HttpWriter does not support Seek()"))
+}
+
+func (w *HttpWriter) Read(_ []byte) (int, error) {
+	return 0, sourceerrors.Wrap(sourceerrors.ErrNotSupported, errors.New("HttpWriter does not support Read()"))
+}
+
+// Write sends p to the server, or appends it to the spool file. It fails with
+// the error of the upload if the server has already answered.
+func (w *HttpWriter) Write(p []byte) (int, error) {
+	if err := w.writeError(); err != nil {
+		return 0, err
+	}
+
+	if w.params.Spool {
+		if w.spool == nil {
+			if err := w.openSpool(); err != nil {
+				return 0, err
+			}
+		}
+		n, err := w.spool.Write(p)
+		return n, sourceerrors.Classify(err)
+	}
+
+	if w.pipeWriter == nil {
+		w.openStream()
+	}
+	n, err := w.pipeWriter.Write(p)
+	if err != nil {
+		// the upload ended, its error explains why
+		<-w.writeDone
+		w.setError(err)
+		return n, w.writeError()
+	}
+	return n, nil
+}
+
+// Close completes the upload and waits for the response of the server. A
+// status other than 2xx is returned as a *StatusError.
+func (w *HttpWriter) Close() error {
+	if w.closed {
+		return w.abortErr
+	}
+	err := w.writeError()
+	w.closed = true
+
+	if w.params.Spool {
+		if err != nil {
+			w.removeSpool()
+			return err
+		}
+		return w.sendSpool()
+	}
+
+	if w.pipeWriter == nil {
+		w.openStream()
+	}
+	w.pipeWriter.Close()
+	<-w.writeDone
+	w.cancel()
+	return w.uploadErr
+}
+
+// Abort discards the data written so far. A streaming upload is cancelled
+// before it completes, so the server sees a truncated request; a spooled one
+// is never sent. Close then returns err. Abort has no effect once Close has
+// returned.
+func (w *HttpWriter) Abort(err error) error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	err = abort.Cause(err)
+	w.abortErr = err
+	w.setError(err)
+
+	if w.spool != nil {
+		w.removeSpool()
+	}
+	if w.pipeWriter != nil {
+		w.cancel()
+		w.pipeWriter.CloseWithError(err)
+		<-w.writeDone
+	}
+	return nil
+}
+
+func (w *HttpWriter) writeError() error {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	if w.err == nil && w.closed {
+		return errWriterClosed
+	}
+	return w.err
+}
+
+// setError records the first error of the upload.
+func (w *HttpWriter) setError(err error) {
+	w.lock.Lock()
+	if w.err == nil {
+		w.err = err
+	}
+	w.lock.Unlock()
+}
+
+// openStream starts a chunked request whose body is read from a pipe.
+func (w *HttpWriter) openStream() {
+	pr, pw := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	w.pipeWriter = pw
+	w.cancel = cancel
+	w.writeDone = make(chan struct{})
+
+	go func() {
+		defer close(w.writeDone)
+
+		// the client closes the body once the server answers, possibly
+		// before the error is known, so writes wait for writeDone
+		err := w.send(ctx, pr, -1, nil)
+		if err != nil {
+			w.setError(err)
+			// unblock pending writes
+			pr.CloseWithError(err)
+		} else {
+			pr.CloseWithError(errWriterClosed)
+		}
+		w.uploadErr = err
+	}()
+}
+
+func (w *HttpWriter) openSpool() error {
+	f, err := ioutil.TempFile(w.params.SpoolDir, "parquet-http-*.spool")
+	if err != nil {
+		return sourceerrors.Classify(err)
+	}
+	w.spool = f
+	return nil
+}
+
+func (w *HttpWriter) removeSpool() {
+	if w.spool != nil {
+		w.spool.Close()
+		os.Remove(w.spool.Name())
+		w.spool = nil
+	}
+}
+
+// sendSpool sends the spool file with its length, or an empty body if nothing
+// was written.
+func (w *HttpWriter) sendSpool() error {
+	if w.spool == nil {
+		return w.send(context.Background(), http.NoBody, 0, nil)
+	}
+	defer w.removeSpool()
+
+	size, err := w.spool.Seek(0, io.SeekEnd)
+	if err != nil {
+		return sourceerrors.Classify(err)
+	}
+	spool := w.spool
+	body := func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(io.NewSectionReader(spool, 0, size)), nil
+	}
+	first, _ := body()
+	return w.send(context.Background(), first, size, body)
+}
+
+// send uploads body. A length of -1 means it is unknown and the body is sent
+// chunked. getBody, if set, lets the client send the body again on redirects.
+func (w *HttpWriter) send(ctx context.Context, body io.Reader, length int64, getBody func() (io.ReadCloser, error)) error {
+	req, err := http.NewRequestWithContext(ctx, w.params.Method, w.url, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = length
+	req.GetBody = getBody
+	for k, v := range w.params.ExtraHeaders {
+		req.Header.Add(k, v)
+	}
+	if w.authorize != nil {
+		if err = w.authorize(req); err != nil {
+			return err
+		}
+	}
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return sourceerrors.Classify(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	return &StatusError{
+		Method:     w.params.Method,
+		URL:        w.url,
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       data,
+	}
+}
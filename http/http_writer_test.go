@@ -0,0 +1,322 @@
+package http
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/abort"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+)
+
+// upload is a request received by an uploadServer.
+type upload struct {
+	method           string
+	path             string
+	contentLength    int64
+	transferEncoding []string
+	header           http.Header
+	body             []byte
+	err              error
+}
+
+// uploadServer records the uploads it receives and answers them with status.
+type uploadServer struct {
+	*httptest.Server
+	lock    sync.Mutex
+	uploads []upload
+}
+
+func newUploadServer(status int, reply string) *uploadServer {
+	s := &uploadServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if status >= 300 {
+			// reject the upload without reading it
+			w.WriteHeader(status)
+			w.Write([]byte(reply))
+			return
+		}
+		body, err := ioutil.ReadAll(req.Body)
+		s.lock.Lock()
+		s.uploads = append(s.uploads, upload{
+			method:           req.Method,
+			path:             req.URL.Path,
+			contentLength:    req.ContentLength,
+			transferEncoding: req.TransferEncoding,
+			header:           req.Header,
+			body:             body,
+			err:              err,
+		})
+		s.lock.Unlock()
+		w.WriteHeader(status)
+	}))
+	return s
+}
+
+func (s *uploadServer) Uploads() []upload {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]upload(nil), s.uploads...)
+}
+
+func writeChunks(t *testing.T, w interface{ Write([]byte) (int, error) }, data []byte) {
+	for offset, size := 0, 1; offset < len(data); offset, size = offset+size, size*3 {
+		end := offset + size
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := w.Write(data[offset:end]); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	data := bytes.Repeat([]byte("parquet "), 10000)
+
+	for _, params := range []HttpWriterParams{
+		{},
+		{Method: http.MethodPost, Spool: true, SpoolDir: t.TempDir()},
+	} {
+		srv := newUploadServer(http.StatusCreated, "")
+		params.ExtraHeaders = map[string]string{"X-Token": "secret"}
+
+		w, err := NewHttpWriterWithParams(srv.URL+"/dir/file.parquet", params)
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		writeChunks(t, w, data)
+		if err = w.Close(); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+
+		// Create resolves names against the URL of the writer
+		other, err := w.Create("other.parquet")
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		if err = other.Close(); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		srv.Close()
+
+		uploads := srv.Uploads()
+		if len(uploads) != 2 {
+			t.Fatalf("expected 2 uploads but got %d", len(uploads))
+		}
+		u := uploads[0]
+		if u.err != nil || !bytes.Equal(u.body, data) || u.header.Get("X-Token") != "secret" {
+			t.Errorf("expected the data and headers to be uploaded but got %d bytes, %v", len(u.body), u.err)
+		}
+		if params.Spool {
+			if u.method != http.MethodPost || u.contentLength != int64(len(data)) {
+				t.Errorf("expected a POST with a Content-Length but got %s with %d", u.method, u.contentLength)
+			}
+			if files, _ := ioutil.ReadDir(params.SpoolDir); len(files) != 0 {
+				t.Errorf("expected the spool file to be removed but got %d files", len(files))
+			}
+		} else if u.method != http.MethodPut || len(u.transferEncoding) != 1 || u.transferEncoding[0] != "chunked" {
+			t.Errorf("expected a chunked PUT but got %s with %v", u.method, u.transferEncoding)
+		}
+		if uploads[1].path != "/dir/other.parquet" || len(uploads[1].body) != 0 {
+			t.Errorf("expected an empty upload to /dir/other.parquet but got %d bytes to %s", len(uploads[1].body), uploads[1].path)
+		}
+	}
+}
+
+func TestWriteStatusError(t *testing.T) {
+	srv := newUploadServer(http.StatusForbidden, "quota exceeded")
+	defer srv.Close()
+
+	for _, spool := range []bool{false, true} {
+		w, err := NewHttpWriterWithParams(srv.URL+"/file.parquet", HttpWriterParams{Spool: spool, SpoolDir: t.TempDir()})
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+
+		// writes fail once the server has answered, which it may do before
+		// reading the body
+		chunk := make([]byte, 1<<20)
+		for i := 0; i < 64; i++ {
+			if _, err = w.Write(chunk); err != nil {
+				break
+			}
+		}
+		closeErr := w.Close()
+
+		for _, err := range []error{err, closeErr} {
+			if err == nil {
+				continue
+			}
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden || string(statusErr.Body) != "quota exceeded" {
+				t.Errorf("spool=%t: expected a StatusError with the response but got %v", spool, err)
+			}
+			if !errors.Is(err, sourceerrors.ErrPermissionDenied) {
+				t.Errorf("spool=%t: expected ErrPermissionDenied but got %v", spool, err)
+			}
+		}
+		if closeErr == nil {
+			t.Errorf("spool=%t: expected Close to fail", spool)
+		}
+	}
+}
+
+func TestWriteAbort(t *testing.T) {
+	srv := newUploadServer(http.StatusOK, "")
+	defer srv.Close()
+
+	for _, spool := range []bool{false, true} {
+		w, err := NewHttpWriterWithParams(srv.URL+"/file.parquet", HttpWriterParams{Spool: spool, SpoolDir: t.TempDir()})
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		writeChunks(t, w, make([]byte, 100000))
+
+		cause := errors.New("job failed")
+		if err = w.(abort.Aborter).Abort(cause); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		if _, err = w.Write([]byte("more")); !errors.Is(err, cause) {
+			t.Errorf("spool=%t: expected writes after Abort to fail with the cause but got %v", spool, err)
+		}
+		if err = w.Close(); !errors.Is(err, cause) {
+			t.Errorf("spool=%t: expected Close after Abort to fail with the cause but got %v", spool, err)
+		}
+	}
+
+	// the streamed upload is cut short, the spooled one never sent
+	srv.Close()
+	for _, u := range srv.Uploads() {
+		if u.err == nil {
+			t.Errorf("expected no complete upload but got %d bytes", len(u.body))
+		}
+	}
+}
+
+func TestWriteAuthorize(t *testing.T) {
+	srv := newUploadServer(http.StatusCreated, "")
+	defer srv.Close()
+
+	var signed int
+	params := HttpWriterParams{
+		Username: "user",
+		Password: "secret",
+		Authorize: func(req *http.Request) error {
+			signed++
+			req.Header.Set("X-Signature", fmt.Sprintf("sig=%d", signed))
+			return nil
+		},
+	}
+	w, err := NewHttpWriterWithParams(srv.URL+"/file.parquet", params)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	other, err := w.Create("other.parquet")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	for _, f := range []interface{ Close() error }{w, other} {
+		if err = f.Close(); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+	}
+
+	uploads := srv.Uploads()
+	if len(uploads) != 2 {
+		t.Fatalf("expected 2 uploads but got %d", len(uploads))
+	}
+	for i, u := range uploads {
+		user, password, ok := (&http.Request{Header: u.header}).BasicAuth()
+		if !ok || user != "user" || password != "secret" || u.header.Get("X-Signature") != fmt.Sprintf("sig=%d", i+1) {
+			t.Errorf("%s: expected the upload to be authorized but got %v", u.path, u.header)
+		}
+	}
+
+	cause := errors.New("token expired")
+	for _, spool := range []bool{false, true} {
+		w, err = NewHttpWriterWithParams(srv.URL+"/file.parquet", HttpWriterParams{
+			Spool:     spool,
+			SpoolDir:  t.TempDir(),
+			Authorize: func(req *http.Request) error { return cause },
+		})
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		w.Write([]byte("data"))
+		if err = w.Close(); !errors.Is(err, cause) {
+			t.Errorf("spool=%t: expected the error of Authorize but got %v", spool, err)
+		}
+	}
+}
+
+func TestWriteClientParams(t *testing.T) {
+	var received int
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if len(req.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		ioutil.ReadAll(req.Body)
+		received++
+		w.WriteHeader(http.StatusCreated)
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	w, err := NewHttpWriterWithParams(srv.URL, HttpWriterParams{IgnoreTLSError: true})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if err = w.Close(); !errors.Is(err, sourceerrors.ErrPermissionDenied) {
+		t.Errorf("expected ErrPermissionDenied without a client certificate but got %v", err)
+	}
+
+	// a client certificate, with the server verified against RootCAs
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	w, err = NewHttpWriterWithParams(srv.URL, HttpWriterParams{Certificates: srv.TLS.Certificates, RootCAs: roots})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	w.Write([]byte("data"))
+	if err = w.Close(); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	// writers created with Create share the transport
+	transport := &countingTransport{next: w.(*HttpWriter).httpClient.Transport}
+	w, err = NewHttpWriterWithParams(srv.URL, HttpWriterParams{Transport: transport})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	other, err := w.Create("other")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	for _, f := range []interface{ Close() error }{w, other} {
+		if err = f.Close(); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+	}
+	if transport.Requests() != 2 {
+		t.Errorf("expected 2 requests through the transport but got %d", transport.Requests())
+	}
+
+	// Client takes precedence over the other params
+	w, err = NewHttpWriterWithParams(srv.URL, HttpWriterParams{Client: &http.Client{Transport: transport}, IgnoreTLSError: true})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if err = w.Close(); err != nil || transport.Requests() != 3 || received != 4 {
+		t.Errorf("expected the upload to be sent with the client but got %v after %d requests", err, transport.Requests())
+	}
+}
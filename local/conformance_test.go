@@ -0,0 +1,59 @@
+package local
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/abort"
+	"github.com/xitongsys/parquet-go-source/sourcetest"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+func TestConformance(t *testing.T) {
+	for _, atomic := range []bool{false, true} {
+		atomic := atomic
+		t.Run(fmt.Sprintf("Atomic=%t", atomic), func(t *testing.T) {
+			dir := t.TempDir()
+			sourcetest.RunConformance(t, sourcetest.Factory{
+				Open: NewLocalFileReader,
+				Create: func(name string) (source.ParquetFile, error) {
+					return NewLocalFileWriterWithParams(name, LocalFileWriterParams{Atomic: atomic})
+				},
+				Path: func(name string) string {
+					return filepath.Join(dir, name)
+				},
+			})
+		})
+	}
+}
+
+func TestAbort(t *testing.T) {
+	for _, atomic := range []bool{false, true} {
+		name := filepath.Join(t.TempDir(), "file.parquet")
+		w, err := NewLocalFileWriterWithParams(name, LocalFileWriterParams{Atomic: atomic})
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		if _, err = w.Write([]byte("PAR1")); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+
+		cause := errors.New("job failed")
+		if err = abort.Abort(w, cause); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		if _, err = w.Write([]byte("more")); !errors.Is(err, cause) {
+			t.Errorf("atomic=%t: expected writes after Abort to fail with the cause but got %v", atomic, err)
+		}
+		if err = w.Close(); !errors.Is(err, cause) {
+			t.Errorf("atomic=%t: expected Close after Abort to fail with the cause but got %v", atomic, err)
+		}
+
+		if entries, _ := os.ReadDir(filepath.Dir(name)); len(entries) != 0 {
+			t.Errorf("atomic=%t: expected nothing to be left but got %d files", atomic, len(entries))
+		}
+	}
+}
@@ -1,30 +1,110 @@
 package local
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"runtime"
 
+	"github.com/xitongsys/parquet-go-source/abort"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
 	"github.com/xitongsys/parquet-go/source"
 )
 
+var errWhence = errors.New("Seek: invalid whence")
+
 type LocalFile struct {
 	FilePath string
 	File     *os.File
+
+	params LocalFileWriterParams
+	// created is set while the file written by Create is open
+	created bool
+	// tempPath is the file written in atomic mode until Close renames it
+	tempPath string
+	// abortErr is returned by writes and Close after Abort
+	abortErr error
+}
+
+// LocalFileWriterParams contains fields used to configure a LocalFile writer
+type LocalFileWriterParams struct {
+	// Atomic makes the writer write to a hidden temporary file in the same
+	// directory. Close syncs it, renames it to the final name and syncs the
+	// directory, so readers never see a partial file and a crash leaves the
+	// final name untouched. Optional.
+	Atomic bool
+	// Exclusive makes Create fail with an error matching fs.ErrExist if the file
+	// already exists. In atomic mode Close fails the same way if the file was
+	// created in the meantime. Optional.
+	Exclusive bool
 }
 
 func NewLocalFileWriter(name string) (source.ParquetFile, error) {
 	return (&LocalFile{}).Create(name)
 }
 
+// NewLocalFileWriterWithParams creates a LocalFile writer with the given
+// params. Writers created with Create share them.
+func NewLocalFileWriterWithParams(name string, params LocalFileWriterParams) (source.ParquetFile, error) {
+	return (&LocalFile{params: params}).Create(name)
+}
+
 func NewLocalFileReader(name string) (source.ParquetFile, error) {
 	return (&LocalFile{}).Open(name)
 }
 
 func (self *LocalFile) Create(name string) (source.ParquetFile, error) {
-	file, err := os.Create(name)
+	var err error
 	myFile := new(LocalFile)
 	myFile.FilePath = name
-	myFile.File = file
-	return myFile, err
+	myFile.params = self.params
+
+	switch {
+	case self.params.Atomic:
+		if self.params.Exclusive {
+			if _, err = os.Lstat(name); err == nil {
+				err = &fs.PathError{Op: "create", Path: name, Err: fs.ErrExist}
+			} else if errors.Is(err, fs.ErrNotExist) {
+				err = nil
+			}
+		}
+		if err == nil {
+			myFile.File, err = createTemp(name)
+		}
+		if err == nil {
+			myFile.tempPath = myFile.File.Name()
+		}
+	case self.params.Exclusive:
+		myFile.File, err = os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	default:
+		myFile.File, err = os.Create(name)
+	}
+
+	myFile.created = err == nil
+	return myFile, sourceerrors.Classify(err)
+}
+
+// createTemp creates a hidden file next to name with the permissions of a
+// file created by os.Create.
+func createTemp(name string) (file *os.File, err error) {
+	dir, base := filepath.Split(name)
+	suffix := make([]byte, 8)
+	for i := 0; i < 100; i++ {
+		if _, err = rand.Read(suffix); err != nil {
+			return nil, err
+		}
+		temp := filepath.Join(dir, "."+base+"."+hex.EncodeToString(suffix)+".tmp")
+		file, err = os.OpenFile(temp, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if !errors.Is(err, fs.ErrExist) {
+			break
+		}
+	}
+	return file, err
 }
 
 func (self *LocalFile) Open(name string) (source.ParquetFile, error) {
@@ -38,9 +118,28 @@ func (self *LocalFile) Open(name string) (source.ParquetFile, error) {
 	myFile := new(LocalFile)
 	myFile.FilePath = name
 	myFile.File, err = os.Open(name)
-	return myFile, err
+	return myFile, sourceerrors.Classify(err)
 }
+
+// Identity names the file and its version by size and modification time,
+// e.g. for use as a cache key.
+func (self *LocalFile) Identity() string {
+	info, err := self.File.Stat()
+	if err != nil {
+		return ""
+	}
+	path, err := filepath.Abs(self.FilePath)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("file://%s#%d-%d", path, info.Size(), info.ModTime().UnixNano())
+}
+
 func (self *LocalFile) Seek(offset int64, pos int) (int64, error) {
+	// os.File accepts platform specific values such as SEEK_DATA
+	if pos < io.SeekStart || pos > io.SeekEnd {
+		return 0, errWhence
+	}
 	return self.File.Seek(offset, pos)
 }
 
@@ -54,13 +153,94 @@ func (self *LocalFile) Read(b []byte) (cnt int, err error) {
 			break
 		}
 	}
-	return cnt, err
+	// io.EOF is only reported once no data is left
+	if err == io.EOF && cnt > 0 {
+		err = nil
+	}
+	return cnt, sourceerrors.Classify(err)
 }
 
 func (self *LocalFile) Write(b []byte) (n int, err error) {
-	return self.File.Write(b)
+	if self.abortErr != nil {
+		return 0, self.abortErr
+	}
+	n, err = self.File.Write(b)
+	return n, sourceerrors.Classify(err)
 }
 
+// Close closes the file. In atomic mode the file is moved into place, or
+// removed if that fails.
 func (self *LocalFile) Close() error {
-	return self.File.Close()
+	if self.abortErr != nil {
+		return self.abortErr
+	}
+	self.created = false
+	if self.tempPath == "" {
+		return sourceerrors.Classify(self.File.Close())
+	}
+
+	err := self.commit()
+	if err != nil {
+		self.File.Close()
+		os.Remove(self.tempPath)
+	}
+	self.tempPath = ""
+	return sourceerrors.Classify(err)
+}
+
+// commit syncs the temporary file of an atomic writer, renames it to the final
+// name and syncs the directory so that the rename survives a crash.
+func (self *LocalFile) commit() error {
+	if err := self.File.Sync(); err != nil {
+		return err
+	}
+	if err := self.File.Close(); err != nil {
+		return err
+	}
+
+	if self.params.Exclusive {
+		// unlike a rename, a link fails if the file has been created since
+		if err := os.Link(self.tempPath, self.FilePath); err != nil {
+			return err
+		}
+		os.Remove(self.tempPath)
+	} else if err := os.Rename(self.tempPath, self.FilePath); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(self.FilePath))
+}
+
+// syncDir flushes the entries of dir to disk.
+func syncDir(dir string) error {
+	// directories cannot be opened for syncing on Windows
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Abort closes and removes the file being written, or its temporary file in
+// atomic mode. Close then returns err. It has no effect on files opened for
+// reading or once Close has returned.
+func (self *LocalFile) Abort(err error) error {
+	if !self.created {
+		return nil
+	}
+	self.created = false
+	self.abortErr = abort.Cause(err)
+
+	self.File.Close()
+	path := self.FilePath
+	if self.tempPath != "" {
+		path = self.tempPath
+		self.tempPath = ""
+	}
+	return sourceerrors.Classify(os.Remove(path))
 }
@@ -0,0 +1,121 @@
+package local
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// dirEntries returns the names of the files in dir.
+func dirEntries(t *testing.T, dir string) []string {
+	t.Helper()
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names
+}
+
+func TestAtomicWrite(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "file.parquet")
+	if err := ioutil.WriteFile(name, []byte("previous"), 0666); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	w, err := NewLocalFileWriterWithParams(name, LocalFileWriterParams{Atomic: true})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if _, err = w.Write([]byte("new content")); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	if data, _ := ioutil.ReadFile(name); string(data) != "previous" {
+		t.Errorf("expected the previous content until Close but got %q", data)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if data, _ := ioutil.ReadFile(name); string(data) != "new content" {
+		t.Errorf("expected the new content after Close but got %q", data)
+	}
+	if entries := dirEntries(t, dir); len(entries) != 1 {
+		t.Errorf("expected the temporary file to be gone but got %v", entries)
+	}
+}
+
+func TestAtomicAbort(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "file.parquet")
+
+	w, err := NewLocalFileWriterWithParams(name, LocalFileWriterParams{Atomic: true})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if _, err = w.Write([]byte("partial")); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if err = w.(*LocalFile).Abort(nil); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if entries := dirEntries(t, dir); len(entries) != 0 {
+		t.Errorf("expected nothing to be left but got %v", entries)
+	}
+}
+
+func TestExclusive(t *testing.T) {
+	for _, atomic := range []bool{false, true} {
+		dir := t.TempDir()
+		name := filepath.Join(dir, "file.parquet")
+		params := LocalFileWriterParams{Atomic: atomic, Exclusive: true}
+
+		w, err := NewLocalFileWriterWithParams(name, params)
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+
+		if _, err = NewLocalFileWriterWithParams(name, params); !errors.Is(err, fs.ErrExist) {
+			t.Errorf("atomic=%t: expected ErrExist but got %v", atomic, err)
+		}
+	}
+}
+
+func TestExclusiveRace(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "file.parquet")
+
+	w, err := NewLocalFileWriterWithParams(name, LocalFileWriterParams{Atomic: true, Exclusive: true})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if _, err = w.Write([]byte("mine")); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	// another writer publishes the file first
+	if err = ioutil.WriteFile(name, []byte("theirs"), 0666); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	if err = w.Close(); !errors.Is(err, os.ErrExist) {
+		t.Errorf("expected ErrExist but got %v", err)
+	}
+	if data, _ := ioutil.ReadFile(name); string(data) != "theirs" {
+		t.Errorf("expected the other file to be kept but got %q", data)
+	}
+	if entries := dirEntries(t, dir); len(entries) != 1 {
+		t.Errorf("expected the temporary file to be removed but got %v", entries)
+	}
+}
@@ -0,0 +1,58 @@
+package mem
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/xitongsys/parquet-go-source/abort"
+	"github.com/xitongsys/parquet-go-source/sourcetest"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+func TestConformance(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	SetInMemFileFs(&fs)
+
+	sourcetest.RunConformance(t, sourcetest.Factory{
+		Open: func(name string) (source.ParquetFile, error) {
+			return (&MemFile{}).Open(name)
+		},
+		Create: func(name string) (source.ParquetFile, error) {
+			return NewMemFileWriter(name, nil)
+		},
+	})
+}
+
+func TestAbort(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	SetInMemFileFs(&fs)
+
+	var closed bool
+	w, err := NewMemFileWriter("file.parquet", func(string, io.Reader) error {
+		closed = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if _, err = w.Write([]byte("PAR1")); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	cause := errors.New("job failed")
+	if err = abort.Abort(w, cause); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if _, err = w.Write([]byte("more")); !errors.Is(err, cause) {
+		t.Errorf("expected writes after Abort to fail with the cause but got %v", err)
+	}
+	if err = w.Close(); !errors.Is(err, cause) {
+		t.Errorf("expected Close after Abort to fail with the cause but got %v", err)
+	}
+
+	if _, err = fs.Stat("file.parquet"); err == nil || closed {
+		t.Errorf("expected the file to be removed without calling OnClose")
+	}
+}
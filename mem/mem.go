@@ -1,16 +1,24 @@
 package mem
 
 import (
+	"errors"
 	"io"
 	"path/filepath"
 
 	"github.com/spf13/afero"
+	"github.com/xitongsys/parquet-go-source/abort"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
 	"github.com/xitongsys/parquet-go/source"
 )
 
 // desclare unexported in-memory file-system
 var memFs afero.Fs
 
+var (
+	errWhence        = errors.New("Seek: invalid whence")
+	errInvalidOffset = errors.New("Seek: invalid offset")
+)
+
 // SetInMemFileFs - overrides local in-memory fileSystem
 // NOTE: this is set by NewMemFileWriter is created
 // and memFs is still nil
@@ -34,6 +42,11 @@ type MemFile struct {
 	FilePath string
 	File     afero.File
 	OnClose  OnCloseFunc
+
+	// created is set while the file written by Create is open
+	created bool
+	// abortErr is returned by writes and Close after Abort
+	abortErr error
 }
 
 // NewMemFileWriter - intiates and creates an instance of MemFiles
@@ -55,15 +68,19 @@ func NewMemFileWriter(name string, f OnCloseFunc) (source.ParquetFile, error) {
 func (fs *MemFile) Create(name string) (source.ParquetFile, error) {
 	file, err := memFs.Create(name)
 	if err != nil {
-		return fs, err
+		return nil, sourceerrors.Classify(err)
 	}
 
-	fs.File = file
-	fs.FilePath = name
-	return fs, nil
+	myFile := new(MemFile)
+	myFile.FilePath = name
+	myFile.File = file
+	myFile.OnClose = fs.OnClose
+	myFile.created = true
+	return myFile, nil
 }
 
-// Open - open file in-memory
+// Open - open file in-memory, returning a new MemFile so that
+// concurrent readers do not share their offset
 func (fs *MemFile) Open(name string) (source.ParquetFile, error) {
 	var (
 		err error
@@ -72,14 +89,37 @@ func (fs *MemFile) Open(name string) (source.ParquetFile, error) {
 		name = fs.FilePath
 	}
 
-	fs.FilePath = name
-	fs.File, err = memFs.Open(name)
-	return fs, err
+	myFile := new(MemFile)
+	myFile.FilePath = name
+	myFile.File, err = memFs.Open(name)
+	return myFile, sourceerrors.Classify(err)
 }
 
 // Seek - seek function
 func (fs *MemFile) Seek(offset int64, pos int) (int64, error) {
-	return fs.File.Seek(offset, pos)
+	// afero's in-memory files accept negative offsets, validate them here
+	switch pos {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		cur, err := fs.File.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+		offset += cur
+	case io.SeekEnd:
+		info, err := fs.File.Stat()
+		if err != nil {
+			return 0, err
+		}
+		offset += info.Size()
+	default:
+		return 0, errWhence
+	}
+
+	if offset < 0 {
+		return 0, errInvalidOffset
+	}
+	return fs.File.Seek(offset, io.SeekStart)
 }
 
 // Read - read file
@@ -93,18 +133,48 @@ func (fs *MemFile) Read(b []byte) (cnt int, err error) {
 			break
 		}
 	}
-	return cnt, err
+	// afero reports reads past the end as io.ErrUnexpectedEOF
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	// io.EOF is only reported once no data is left
+	if err == io.EOF && cnt > 0 {
+		err = nil
+	}
+	return cnt, sourceerrors.Classify(err)
 }
 
 // Write - write file in-memory
 func (fs *MemFile) Write(b []byte) (n int, err error) {
-	return fs.File.Write(b)
+	if fs.abortErr != nil {
+		return 0, fs.abortErr
+	}
+	n, err = fs.File.Write(b)
+	return n, sourceerrors.Classify(err)
+}
+
+// Abort - close and remove the file being written without executing
+// OnCloseFunc. Close then returns err. Has no effect on files opened for
+// reading or once Close has returned
+func (fs *MemFile) Abort(err error) error {
+	if !fs.created {
+		return nil
+	}
+	fs.created = false
+	fs.abortErr = abort.Cause(err)
+
+	fs.File.Close()
+	return sourceerrors.Classify(memFs.Remove(fs.FilePath))
 }
 
 // Close - close file and execute OnCloseFunc
 func (fs *MemFile) Close() error {
+	if fs.abortErr != nil {
+		return fs.abortErr
+	}
+	fs.created = false
 	if err := fs.File.Close(); err != nil {
-		return err
+		return sourceerrors.Classify(err)
 	}
 	if fs.OnClose != nil {
 		f, _ := fs.Open(fs.FilePath)
@@ -0,0 +1,27 @@
+package minio
+
+import (
+	"context"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/s3fake"
+	"github.com/xitongsys/parquet-go-source/sourcetest"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+func TestConformance(t *testing.T) {
+	srv := s3fake.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("bucket")
+	client := srv.MinioClient()
+	ctx := context.Background()
+
+	sourcetest.RunConformance(t, sourcetest.Factory{
+		Open: func(name string) (source.ParquetFile, error) {
+			return NewS3FileReaderWithClient(ctx, client, "bucket", name)
+		},
+		Create: func(name string) (source.ParquetFile, error) {
+			return NewS3FileWriterWithClient(ctx, client, "bucket", name)
+		},
+	})
+}
@@ -4,8 +4,12 @@ import (
 	"context"
 	"errors"
 	"io"
+	"net/http"
+	"sync"
 
 	"github.com/minio/minio-go/v7"
+	"github.com/xitongsys/parquet-go-source/abort"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
 	"github.com/xitongsys/parquet-go/source"
 )
 
@@ -17,18 +21,28 @@ type MinioFile struct {
 	whence int
 
 	// write-related fields
+	writeDone  chan error
 	pipeReader *io.PipeReader
 	pipeWriter *io.PipeWriter
+	putOptions minio.PutObjectOptions
 
 	// read-related fields
 	fileSize   int64
+	etag       string
 	downloader *minio.Object
 
+	lock       sync.RWMutex
 	err        error
 	BucketName string
 	Key        string
 }
 
+// DefaultPartSize is the size of the parts uploaded by writers whose
+// PutObjectOptions leave PartSize unset. The size of an object is unknown until
+// Close, so minio-go would otherwise buffer parts large enough for the maximum
+// object size. Objects are limited to 10000 parts.
+const DefaultPartSize = 16 << 20
+
 var (
 	errWhence        = errors.New("Seek: invalid whence")
 	errInvalidOffset = errors.New("Seek: invalid offset")
@@ -42,12 +56,27 @@ func NewS3FileWriterWithClient(
 	s3Client *minio.Client,
 	bucket string,
 	key string,
+) (source.ParquetFile, error) {
+	return NewS3FileWriterWithOptions(ctx, s3Client, bucket, key, minio.PutObjectOptions{})
+}
+
+// NewS3FileWriterWithOptions is the same as NewS3FileWriterWithClient but
+// allows setting the options of the upload, such as the content type, user
+// metadata, part size and server-side encryption. Writers created with Create
+// share them.
+func NewS3FileWriterWithOptions(
+	ctx context.Context,
+	s3Client *minio.Client,
+	bucket string,
+	key string,
+	opts minio.PutObjectOptions,
 ) (source.ParquetFile, error) {
 	file := &MinioFile{
 		ctx:        ctx,
 		client:     s3Client,
 		BucketName: bucket,
 		Key:        key,
+		putOptions: opts,
 	}
 
 	return file.Create(key)
@@ -66,7 +95,8 @@ func NewS3FileReaderWithClient(ctx context.Context, s3Client *minio.Client, buck
 	return file.Open(key)
 }
 
-// Seek tracks the offset for the next Read. Has no effect on Write.
+// Seek tracks the offset for the next Read. Has no effect on Write. Once the
+// file size is known offsets are absolute, and seeking past the end is allowed.
 func (s *MinioFile) Seek(offset int64, whence int) (int64, error) {
 	if whence < io.SeekStart || whence > io.SeekEnd {
 		return 0, errWhence
@@ -74,20 +104,15 @@ func (s *MinioFile) Seek(offset int64, whence int) (int64, error) {
 
 	if s.fileSize > 0 {
 		switch whence {
-		case io.SeekStart:
-			if offset < 0 || offset > s.fileSize {
-				return 0, errInvalidOffset
-			}
 		case io.SeekCurrent:
 			offset += s.offset
-			if offset < 0 || offset > s.fileSize {
-				return 0, errInvalidOffset
-			}
 		case io.SeekEnd:
-			if offset > -1 || -offset > s.fileSize {
-				return 0, errInvalidOffset
-			}
+			offset += s.fileSize
+		}
+		if offset < 0 {
+			return 0, errInvalidOffset
 		}
+		whence = io.SeekStart
 	}
 
 	s.offset = offset
@@ -102,8 +127,12 @@ func (s *MinioFile) Read(p []byte) (n int, err error) {
 	}
 
 	bytesDownloaded, err := s.downloader.ReadAt(p, s.offset)
+	// ReadAt returns io.EOF together with the last bytes of the object
+	if err == io.EOF && bytesDownloaded > 0 {
+		err = nil
+	}
 	if err != nil {
-		return 0, err
+		return 0, s.wrapError(err)
 	}
 
 	s.offset += int64(bytesDownloaded)
@@ -112,12 +141,25 @@ func (s *MinioFile) Read(p []byte) (n int, err error) {
 
 // Write len(p) bytes from p to the Minio data stream
 func (s *MinioFile) Write(p []byte) (n int, err error) {
+	s.lock.RLock()
+	writeError := s.err
+	s.lock.RUnlock()
+	if writeError != nil {
+		return 0, s.wrapError(writeError)
+	}
+
 	// prevent further writes upon error
 	bytesWritten, writeError := s.pipeWriter.Write(p)
 	if writeError != nil {
-		s.err = writeError
-		s.pipeWriter.CloseWithError(err)
-		return 0, writeError
+		s.lock.Lock()
+		if s.err == nil {
+			s.err = writeError
+		}
+		writeError = s.err
+		s.lock.Unlock()
+
+		s.pipeWriter.CloseWithError(writeError)
+		return 0, s.wrapError(writeError)
 	}
 
 	return bytesWritten, nil
@@ -126,19 +168,68 @@ func (s *MinioFile) Write(p []byte) (n int, err error) {
 // Close signals write completion and cleans up any
 // open streams. Will block until pending uploads are complete.
 func (s *MinioFile) Close() error {
+	if s.downloader != nil {
+		// stops the goroutine of the object and releases its response
+		err := s.downloader.Close()
+		s.downloader = nil
+		return s.wrapError(err)
+	}
+
 	var err error
 
 	if s.pipeWriter != nil {
 		if err = s.pipeWriter.Close(); err != nil {
-			return err
+			return s.wrapError(err)
 		}
 	}
 
-	return err
+	// wait for pending uploads
+	if s.writeDone != nil {
+		err = <-s.writeDone
+	}
+	if err == nil {
+		// Abort, or a failed Write, already waited for the upload
+		s.lock.RLock()
+		err = s.err
+		s.lock.RUnlock()
+	}
+
+	return s.wrapError(err)
+}
+
+// Abort discards the data written so far instead of publishing it. The upload
+// fails with err as the cause of its next read, upon which minio-go aborts the
+// multipart upload, and Abort waits for it to finish. Close then returns err.
+// Abort has no effect once Close has returned.
+func (s *MinioFile) Abort(err error) error {
+	if s.pipeWriter == nil {
+		return nil
+	}
+	err = abort.Cause(err)
+
+	// prevent further writes, and make Close report the cause
+	s.lock.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.lock.Unlock()
+
+	s.pipeWriter.CloseWithError(err)
+	if s.writeDone != nil {
+		<-s.writeDone
+	}
+	return nil
 }
 
-// Open creates a new Minio File instance to perform concurrent reads
+// Open creates a new Minio File instance to perform concurrent reads. Reads are
+// pinned to the ETag of the object seen when it is first opened, clones made
+// with an empty name share it.
 func (s *MinioFile) Open(name string) (source.ParquetFile, error) {
+	// ColumBuffer passes in an empty string for name
+	if len(name) == 0 {
+		name = s.Key
+	}
+
 	// new instance
 	pf := &MinioFile{
 		ctx:        s.ctx,
@@ -146,35 +237,109 @@ func (s *MinioFile) Open(name string) (source.ParquetFile, error) {
 		BucketName: s.BucketName,
 		Key:        name,
 		offset:     0,
+		fileSize:   s.fileSize,
+		etag:       s.etag,
 	}
+
 	// init object info
-	downloader, err := s.client.GetObject(s.ctx, s.BucketName, s.Key, minio.GetObjectOptions{})
-	if err != nil {
-		return pf, err
+	if name != s.Key || pf.etag == "" {
+		info, err := s.client.StatObject(s.ctx, s.BucketName, name, minio.StatObjectOptions{})
+		if err != nil {
+			return nil, pf.wrapError(err)
+		}
+		pf.fileSize = info.Size
+		pf.etag = info.ETag
+	}
+
+	opts := minio.GetObjectOptions{}
+	if pf.etag != "" {
+		if err := opts.SetMatchETag(pf.etag); err != nil {
+			return nil, err
+		}
 	}
-	info, err := downloader.Stat()
+	downloader, err := s.client.GetObject(s.ctx, s.BucketName, name, opts)
 	if err != nil {
-		return pf, err
+		return nil, pf.wrapError(err)
 	}
-	s.downloader = downloader
-	s.fileSize = info.Size
+	pf.downloader = downloader
+
 	return pf, nil
 }
 
-// Create creates a new Minio File instance to perform writes
+// Identity names the object and the version being read, e.g. for use as a
+// cache key. It is empty for writers.
+func (s *MinioFile) Identity() string {
+	if s.etag == "" {
+		return ""
+	}
+	return "s3://" + s.BucketName + "/" + s.Key + "#" + s.etag
+}
+
+// wrapError returns an ObjectChangedError if err reports that the object no
+// longer matches the ETag seen when it was opened, and otherwise annotates err
+// with its kind from sourceerrors.
+func (s *MinioFile) wrapError(err error) error {
+	var resp minio.ErrorResponse
+	if !errors.As(err, &resp) {
+		return sourceerrors.Classify(err)
+	}
+	if resp.StatusCode == http.StatusPreconditionFailed && s.etag != "" {
+		return &sourceerrors.ObjectChangedError{
+			Name:    s.BucketName + "/" + s.Key,
+			Version: s.etag,
+			Err:     err,
+		}
+	}
+	if kind := sourceerrors.KindOfCode(resp.Code); kind != nil {
+		return sourceerrors.Wrap(kind, err)
+	}
+	return sourceerrors.Wrap(sourceerrors.KindOfStatus(resp.StatusCode), err)
+}
+
+// Create creates a new Minio File instance to perform writes. The object is
+// uploaded in the background as it is written, and Close waits for the upload
+// to complete.
 func (s *MinioFile) Create(key string) (source.ParquetFile, error) {
 	pf := &MinioFile{
 		ctx:        s.ctx,
 		client:     s.client,
 		BucketName: s.BucketName,
 		Key:        key,
+		putOptions: s.putOptions,
+		writeDone:  make(chan error, 1),
 	}
+	pf.openWrite()
+	return pf, nil
+}
+
+// openWrite starts an upload of unknown size that consumes the Reader end of
+// an io.Pipe. Calling Close signals write completion.
+func (s *MinioFile) openWrite() {
 	pr, pw := io.Pipe()
-	_, err := s.client.PutObject(s.ctx, s.BucketName, s.Key, pr, -1, minio.PutObjectOptions{})
-	if err != nil {
-		return pf, err
+	s.pipeReader = pr
+	s.pipeWriter = pw
+
+	opts := s.putOptions
+	if opts.PartSize == 0 {
+		opts.PartSize = DefaultPartSize
 	}
-	pf.pipeReader = pr
-	pf.pipeWriter = pw
-	return pf, nil
+
+	go func() {
+		defer close(s.writeDone)
+
+		// upload data and signal done when complete
+		_, err := s.client.PutObject(s.ctx, s.BucketName, s.Key, pr, -1, opts)
+		if err != nil {
+			s.lock.Lock()
+			if s.err == nil {
+				s.err = err
+			}
+			s.lock.Unlock()
+
+			// unblock pending writes
+			pr.CloseWithError(err)
+		}
+
+		s.writeDone <- err
+	}()
 }
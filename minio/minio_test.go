@@ -0,0 +1,218 @@
+package minio
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	miniocredentials "github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/xitongsys/parquet-go-source/abort"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"github.com/xitongsys/parquet-go-source/s3fake"
+)
+
+func TestWriteOptions(t *testing.T) {
+	srv := s3fake.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("bucket")
+
+	w, err := NewS3FileWriterWithOptions(context.Background(), srv.MinioClient(), "bucket", "key", minio.PutObjectOptions{
+		ContentType:  "application/vnd.apache.parquet",
+		UserMetadata: map[string]string{"Job": "42"},
+	})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if _, err = w.Write([]byte("PAR1")); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	obj, ok := srv.GetObject("bucket", "key")
+	if !ok {
+		t.Fatal("expected the object to be uploaded")
+	}
+	if string(obj.Data) != "PAR1" || obj.ContentType != "application/vnd.apache.parquet" || obj.Metadata["job"] != "42" {
+		t.Errorf("expected the options to be applied but got %q, %q, %v", obj.Data, obj.ContentType, obj.Metadata)
+	}
+}
+
+func TestUploadError(t *testing.T) {
+	srv := s3fake.NewServer()
+	defer srv.Close()
+
+	w, err := NewS3FileWriterWithClient(context.Background(), srv.MinioClient(), "missing", "key")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	w.Write([]byte("PAR1"))
+	if err = w.Close(); !errors.Is(err, sourceerrors.ErrNotFound) {
+		t.Errorf("expected ErrNotFound from Close but got %v", err)
+	}
+	if _, err = w.Write([]byte("PAR1")); err == nil {
+		t.Error("expected writes to fail after a failed upload")
+	}
+}
+
+func TestAbort(t *testing.T) {
+	srv := s3fake.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("bucket")
+
+	w, err := NewS3FileWriterWithClient(context.Background(), srv.MinioClient(), "bucket", "key")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if _, err = w.Write([]byte("PAR1")); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if err = abort.Abort(w, nil); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	if _, ok := srv.GetObject("bucket", "key"); ok {
+		t.Error("expected no object to be published")
+	}
+	if srv.Uploads() != 0 {
+		t.Errorf("expected the multipart upload to be aborted but got %d", srv.Uploads())
+	}
+	if _, err = w.Write([]byte("PAR1")); !errors.Is(err, abort.ErrAborted) {
+		t.Errorf("expected ErrAborted but got %v", err)
+	}
+	if err = w.Close(); !errors.Is(err, abort.ErrAborted) {
+		t.Errorf("expected Close after Abort to fail with ErrAborted but got %v", err)
+	}
+}
+
+func TestOpenSeekEnd(t *testing.T) {
+	srv := s3fake.NewServer()
+	defer srv.Close()
+	srv.PutObject("bucket", "a", []byte("first object"))
+	srv.PutObject("bucket", "b", []byte("second"))
+
+	r, err := NewS3FileReaderWithClient(context.Background(), srv.MinioClient(), "bucket", "a")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	clone, err := r.Open("b")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if offset, err := clone.Seek(-3, io.SeekEnd); err != nil || offset != 3 {
+		t.Fatalf("expected offset 3 but got %d, %v", offset, err)
+	}
+	buf := make([]byte, 3)
+	if n, err := clone.Read(buf); err != nil || string(buf[:n]) != "ond" {
+		t.Errorf("expected %q but got %q, %v", "ond", buf[:n], err)
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	srv := s3fake.NewServer()
+	defer srv.Close()
+	srv.PutObject("bucket", "key", []byte("object"))
+
+	r, err := NewS3FileReaderWithClient(context.Background(), srv.MinioClient(), "bucket", "key")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	defer r.Close()
+	want := "s3://bucket/key#" + r.(*MinioFile).etag
+	if id := r.(*MinioFile).Identity(); r.(*MinioFile).etag == "" || id != want {
+		t.Errorf("expected identity %q but got %q", want, id)
+	}
+
+	// the object changes, so a reader opened now has another identity
+	srv.PutObject("bucket", "key", []byte("changed object"))
+	clone, err := r.Open("key")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	defer clone.Close()
+	if id := clone.(*MinioFile).Identity(); id != want {
+		t.Errorf("expected clones to keep identity %q but got %q", want, id)
+	}
+
+	w, err := NewS3FileWriterWithClient(context.Background(), srv.MinioClient(), "bucket", "out")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	defer w.Close()
+	if id := w.(*MinioFile).Identity(); id != "" {
+		t.Errorf("expected writers to have no identity but got %q", id)
+	}
+}
+
+func TestWrapPreconditionFailed(t *testing.T) {
+	failure := minio.ErrorResponse{StatusCode: http.StatusPreconditionFailed, Code: "PreconditionFailed"}
+
+	// without a pinned version, e.g. on writes, a 412 is only a failed condition
+	s := &MinioFile{BucketName: "bucket", Key: "key"}
+	err := s.wrapError(failure)
+	if !errors.Is(err, sourceerrors.ErrPreconditionFailed) || errors.Is(err, sourceerrors.ErrObjectChanged) {
+		t.Errorf("expected ErrPreconditionFailed but got %v", err)
+	}
+
+	s.etag = `"etag"`
+	var changed *sourceerrors.ObjectChangedError
+	if err = s.wrapError(failure); !errors.As(err, &changed) || changed.Version != s.etag {
+		t.Errorf("expected ObjectChangedError for the pinned version but got %v", err)
+	}
+}
+
+func TestCloseReleasesReaders(t *testing.T) {
+	srv := s3fake.NewServer()
+	defer srv.Close()
+	srv.PutObject("bucket", "key", []byte("PAR1 0123456789 PAR1"))
+	u, _ := url.Parse(srv.URL)
+	// connections are closed with their responses instead of being kept idle
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:        miniocredentials.NewStaticV4(s3fake.AccessKey, s3fake.SecretKey, ""),
+		Region:       s3fake.Region,
+		BucketLookup: minio.BucketLookupPath,
+		Transport:    &http.Transport{DisableKeepAlives: true},
+	})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	before := runtime.NumGoroutine()
+
+	r, err := NewS3FileReaderWithClient(context.Background(), client, "bucket", "key")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	files := []io.ReadCloser{r}
+	for i := 0; i < 3; i++ {
+		clone, err := r.Open("")
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		files = append(files, clone)
+	}
+	for _, f := range files {
+		if _, err = f.Read(make([]byte, 4)); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+	}
+	for _, f := range files {
+		if err = f.Close(); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("expected %d goroutines after closing the readers but got %d", before, after)
+	}
+}
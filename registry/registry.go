@@ -0,0 +1,115 @@
+// Package registry opens a source.ParquetFile from a single URL, dispatching on
+// the URL scheme to one of the backends of this module:
+//
+//	pf, err := registry.OpenReader(ctx, "s3://bucket/path/file.parquet?versionId=abc")
+//
+// Additional schemes can be plugged in with Register.
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// OpenFunc opens a ParquetFile for the object addressed by u.
+type OpenFunc func(ctx context.Context, u *url.URL) (source.ParquetFile, error)
+
+// Factory builds readers and writers for the URLs of one scheme. Reader or
+// Writer may be nil if the backend does not support that direction.
+type Factory struct {
+	Reader OpenFunc
+	Writer OpenFunc
+}
+
+var (
+	errEmptyScheme = errors.New("registry: scheme cannot be empty")
+
+	factories     = map[string]Factory{}
+	factoriesLock sync.RWMutex
+)
+
+// Register makes factory available for URLs with the given scheme, replacing
+// any factory previously registered for it. Schemes are case-insensitive.
+func Register(scheme string, factory Factory) {
+	if scheme == "" {
+		panic(errEmptyScheme)
+	}
+
+	factoriesLock.Lock()
+	factories[strings.ToLower(scheme)] = factory
+	factoriesLock.Unlock()
+}
+
+// Schemes returns the schemes that currently have a registered factory.
+func Schemes() []string {
+	factoriesLock.RLock()
+	defer factoriesLock.RUnlock()
+
+	schemes := make([]string, 0, len(factories))
+	for scheme := range factories {
+		schemes = append(schemes, scheme)
+	}
+	return schemes
+}
+
+// OpenReader opens rawURL for reading, to be used with NewParquetReader.
+func OpenReader(ctx context.Context, rawURL string) (source.ParquetFile, error) {
+	u, factory, err := lookup(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if factory.Reader == nil {
+		return nil, sourceerrors.Wrap(sourceerrors.ErrNotSupported, fmt.Errorf("registry: scheme %q does not support reading", u.Scheme))
+	}
+
+	return factory.Reader(ctx, u)
+}
+
+// OpenWriter opens rawURL for writing, to be used with NewParquetWriter.
+func OpenWriter(ctx context.Context, rawURL string) (source.ParquetFile, error) {
+	u, factory, err := lookup(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if factory.Writer == nil {
+		return nil, sourceerrors.Wrap(sourceerrors.ErrNotSupported, fmt.Errorf("registry: scheme %q does not support writing", u.Scheme))
+	}
+
+	return factory.Writer(ctx, u)
+}
+
+// lookup parses rawURL and returns the factory responsible for it. URLs
+// without a scheme are treated as local paths, and http(s) URLs pointing at
+// Azure Blob Storage are routed to the "az" factory.
+func lookup(rawURL string) (*url.URL, Factory, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, Factory{}, err
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	switch {
+	case scheme == "":
+		// keep characters such as '?' and '#' as part of the file name
+		u = &url.URL{Path: rawURL}
+		scheme = "file"
+	case (scheme == "http" || scheme == "https") && isAzureBlobHost(u.Hostname()):
+		scheme = "az"
+	}
+
+	factoriesLock.RLock()
+	factory, ok := factories[scheme]
+	factoriesLock.RUnlock()
+	if !ok {
+		return nil, Factory{}, sourceerrors.Wrap(sourceerrors.ErrNotSupported, fmt.Errorf("registry: no backend registered for scheme %q", scheme))
+	}
+
+	return u, factory, nil
+}
@@ -0,0 +1,155 @@
+package registry
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go-source/mem"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+func TestOpenLocal(t *testing.T) {
+	ctx := context.Background()
+	data := []byte("some data")
+	name := filepath.Join(t.TempDir(), "test.parquet")
+
+	for _, rawURL := range []string{name, "file://" + name} {
+		w, err := OpenWriter(ctx, rawURL)
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		if _, err = w.Write(data); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+
+		r, err := OpenReader(ctx, rawURL)
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		if string(got) != string(data) {
+			t.Errorf("expected data to be %q but got %q", data, got)
+		}
+		r.Close()
+	}
+}
+
+func TestOpenMem(t *testing.T) {
+	ctx := context.Background()
+	fs := afero.NewMemMapFs()
+	mem.SetInMemFileFs(&fs)
+
+	w, err := OpenWriter(ctx, "mem://dir/test.parquet")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if _, err = w.Write([]byte("some data")); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	if _, err = fs.Stat("dir/test.parquet"); err != nil {
+		t.Errorf("expected file to exist but got %q", err.Error())
+	}
+}
+
+func TestRegister(t *testing.T) {
+	var opened *url.URL
+	Register("TEST", Factory{
+		Reader: func(_ context.Context, u *url.URL) (source.ParquetFile, error) {
+			opened = u
+			return buffer.NewBufferFile(), nil
+		},
+	})
+
+	if _, err := OpenReader(context.Background(), "test://host/path?k=v"); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if opened == nil || opened.Host != "host" || opened.Path != "/path" || opened.Query().Get("k") != "v" {
+		t.Errorf("expected factory to receive test://host/path?k=v but got %v", opened)
+	}
+
+	if _, err := OpenWriter(context.Background(), "test://host/path"); err == nil {
+		t.Error("expected error for scheme without writer but got nil")
+	}
+}
+
+func TestUnknownScheme(t *testing.T) {
+	if _, err := OpenReader(context.Background(), "unknown://bucket/key"); err == nil {
+		t.Error("expected error for unknown scheme but got nil")
+	}
+}
+
+func TestLookupAzureHost(t *testing.T) {
+	u, _, err := lookup("https://account.blob.core.windows.net/container/blob.parquet?sv=1")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if got := azBlobURL(u); got != "https://account.blob.core.windows.net/container/blob.parquet?sv=1" {
+		t.Errorf("unexpected blob URL %q", got)
+	}
+
+	u, _ = url.Parse("az://account/container/blob.parquet?sv=1")
+	if got := azBlobURL(u); got != "https://account.blob.core.windows.net/container/blob.parquet?sv=1" {
+		t.Errorf("unexpected blob URL %q", got)
+	}
+}
+
+func TestS3ReaderParams(t *testing.T) {
+	u, _ := url.Parse("s3://bucket/path/to/key.parquet?versionId=v1&minRequestSize=1024&region=eu-west-1")
+	params, err := s3ReaderParams(u)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if params.Bucket != "bucket" || params.Key != "path/to/key.parquet" {
+		t.Errorf("unexpected bucket %q and key %q", params.Bucket, params.Key)
+	}
+	if params.Version == nil || *params.Version != "v1" {
+		t.Errorf("expected version v1 but got %v", params.Version)
+	}
+	if params.MinRequestSize != 1024 {
+		t.Errorf("expected min request size 1024 but got %d", params.MinRequestSize)
+	}
+	if len(params.Configs) != 1 || *params.Configs[0].Region != "eu-west-1" {
+		t.Errorf("expected region eu-west-1 in configs")
+	}
+
+	u, _ = url.Parse("s3://bucket/key?minRequestSize=big")
+	if _, err = s3ReaderParams(u); err == nil {
+		t.Error("expected error for invalid minRequestSize but got nil")
+	}
+}
+
+func TestSplitHeaderParams(t *testing.T) {
+	u, _ := url.Parse("https://host/file.parquet?sig=abc&header.Authorization=Bearer+token")
+	stripped, headers := splitHeaderParams(u)
+	if stripped.String() != "https://host/file.parquet?sig=abc" {
+		t.Errorf("unexpected URL %q", stripped.String())
+	}
+	if headers["Authorization"] != "Bearer token" {
+		t.Errorf("unexpected headers %v", headers)
+	}
+
+	// the order and encoding of the other parameters are covered by signatures
+	u, _ = url.Parse("https://host/file.parquet?sv=2020&sig=a%2Fb%3D&header.X-Token=t&se=2021-01-01T00%3A00%3A00Z")
+	stripped, headers = splitHeaderParams(u)
+	if stripped.RawQuery != "sv=2020&sig=a%2Fb%3D&se=2021-01-01T00%3A00%3A00Z" {
+		t.Errorf("expected the query to be kept unchanged but got %q", stripped.RawQuery)
+	}
+	if headers["X-Token"] != "t" {
+		t.Errorf("unexpected headers %v", headers)
+	}
+}
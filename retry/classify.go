@@ -0,0 +1,158 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/minio/minio-go/v7"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"gocloud.dev/gcerrors"
+	"google.golang.org/api/googleapi"
+)
+
+// retryableCodes are the error codes of the storage services that signal
+// throttling or a transient server-side failure.
+var retryableCodes = map[string]bool{
+	// S3
+	"RequestTimeout":       true,
+	"SlowDown":             true,
+	"Throttling":           true,
+	"ThrottlingException":  true,
+	"RequestLimitExceeded": true,
+	"InternalError":        true,
+	"ServiceUnavailable":   true,
+	// Azure
+	"ServerBusy":        true,
+	"OperationTimedOut": true,
+}
+
+// awsError is implemented by errors of aws-sdk-go. They do not implement
+// Unwrap, the cause is returned by OrigErr.
+type awsError interface {
+	error
+	Code() string
+	OrigErr() error
+}
+
+// statusCoder is implemented by request failures of aws-sdk-go.
+type statusCoder interface {
+	StatusCode() int
+}
+
+// httpStatusCoder is implemented by response errors of aws-sdk-go-v2.
+type httpStatusCoder interface {
+	HTTPStatusCode() int
+}
+
+// apiError is implemented by service errors of aws-sdk-go-v2.
+type apiError interface {
+	ErrorCode() string
+}
+
+// IsRetryable reports whether err is a transient failure worth retrying:
+// throttling, server errors, timeouts and dropped connections. Missing
+// objects, denied permissions, failed preconditions, cancelled contexts and
+// io.EOF are not retryable.
+func IsRetryable(err error) bool {
+	if err == nil || err == io.EOF {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	// the backends of this module tell the kind of their errors
+	switch {
+	case errors.Is(err, sourceerrors.ErrThrottled):
+		return true
+	case errors.Is(err, sourceerrors.ErrNotFound),
+		errors.Is(err, sourceerrors.ErrPermissionDenied),
+		errors.Is(err, sourceerrors.ErrPreconditionFailed),
+		errors.Is(err, sourceerrors.ErrNotSupported):
+		return false
+	}
+
+	// a response was received, its status decides
+	if status, ok := StatusCode(err); ok {
+		return RetryableStatus(status)
+	}
+
+	var awsErr awsError
+	if errors.As(err, &awsErr) {
+		if retryableCodes[awsErr.Code()] {
+			return true
+		}
+		if cause := awsErr.OrigErr(); cause != nil {
+			return IsRetryable(cause)
+		}
+		return false
+	}
+	var apiErr apiError
+	if errors.As(err, &apiErr) {
+		if retryableCodes[apiErr.ErrorCode()] {
+			return true
+		}
+	}
+
+	switch gcerrors.Code(err) {
+	case gcerrors.ResourceExhausted, gcerrors.Internal:
+		return true
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	// other network errors, such as unknown hosts and refused connections, are
+	// mistakes in the configuration
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// StatusCode returns the HTTP status of the response err was built from, if
+// the error carries one.
+func StatusCode(err error) (int, bool) {
+	var azErr *azcore.ResponseError
+	if errors.As(err, &azErr) {
+		return azErr.StatusCode, true
+	}
+	var gErr *googleapi.Error
+	if errors.As(err, &gErr) {
+		return gErr.Code, true
+	}
+	var minioErr minio.ErrorResponse
+	if errors.As(err, &minioErr) && minioErr.StatusCode != 0 {
+		return minioErr.StatusCode, true
+	}
+	var httpErr httpStatusCoder
+	if errors.As(err, &httpErr) && httpErr.HTTPStatusCode() != 0 {
+		return httpErr.HTTPStatusCode(), true
+	}
+	var failure statusCoder
+	if errors.As(err, &failure) && failure.StatusCode() != 0 {
+		return failure.StatusCode(), true
+	}
+	return 0, false
+}
+
+// RetryableStatus reports whether an HTTP response with the given status is
+// worth retrying.
+func RetryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
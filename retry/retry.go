@@ -0,0 +1,255 @@
+// Package retry wraps a ParquetFile so that transient failures of the
+// underlying storage are retried with exponential backoff.
+//
+// Reads are retried from the offset the failed read started at, or from the
+// first byte not yet returned if the failure happened part way through.
+// Writes are only retried if the policy says the backend can resume them.
+// When the retries are exhausted, or an error is not retryable, the error of
+// the last attempt is returned unchanged so that errors.Is and errors.As keep
+// working.
+package retry
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/xitongsys/parquet-go-source/abort"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+const (
+	// DefaultMaxAttempts is the number of attempts made when none is set.
+	DefaultMaxAttempts = 5
+	// DefaultInitialBackoff is the delay before the first retry when none is set.
+	DefaultInitialBackoff = 100 * time.Millisecond
+	// DefaultMaxBackoff is the longest delay between attempts when none is set.
+	DefaultMaxBackoff = 10 * time.Second
+	// DefaultMultiplier is the factor applied to the delay after every retry
+	// when none is set.
+	DefaultMultiplier = 2
+	// DefaultJitter is the fraction of every delay that is randomized when none
+	// is set.
+	DefaultJitter = 0.5
+)
+
+// Policy configures how failed operations are retried. The zero value
+// retries reads and opens with the defaults above.
+type Policy struct {
+	// MaxAttempts is the number of attempts per operation, including the
+	// first. Defaults to DefaultMaxAttempts. Optional.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry. Defaults to
+	// DefaultInitialBackoff. Optional.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts. Defaults to
+	// DefaultMaxBackoff. Optional.
+	MaxBackoff time.Duration
+	// Multiplier is applied to the delay after every retry. Defaults to
+	// DefaultMultiplier. Optional.
+	Multiplier float64
+	// Jitter is the fraction of every delay that is randomized, between 0 and
+	// 1, so that clients failing together do not retry together. Defaults to
+	// DefaultJitter; a negative value disables it. Optional.
+	Jitter float64
+	// Retryable decides which errors are retried. Defaults to IsRetryable.
+	// Optional.
+	Retryable func(error) bool
+	// RetryWrites enables retrying writes that failed before any byte was
+	// accepted. Only set it for backends whose Write can be repeated after a
+	// failure, e.g. local files; writers streaming an upload, such as S3 and
+	// Azure, cannot recover from a failed Write. Optional.
+	RetryWrites bool
+}
+
+func (p Policy) withDefaults() Policy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultMaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultMaxBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = DefaultMultiplier
+	}
+	if p.Jitter == 0 {
+		p.Jitter = DefaultJitter
+	} else if p.Jitter < 0 {
+		p.Jitter = 0
+	} else if p.Jitter > 1 {
+		p.Jitter = 1
+	}
+	if p.Retryable == nil {
+		p.Retryable = IsRetryable
+	}
+	return p
+}
+
+// backoff returns the delay before the given retry, starting at 1.
+func (p Policy) backoff(retry int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 1; i < retry && d < float64(p.MaxBackoff); i++ {
+		d *= p.Multiplier
+	}
+	if d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	d -= d * p.Jitter * rand.Float64()
+	return time.Duration(d)
+}
+
+// RetryFile is a ParquetFile retrying the operations of the file it wraps
+type RetryFile struct {
+	ctx    context.Context
+	file   source.ParquetFile
+	policy Policy
+	offset int64
+}
+
+// NewRetryFile wraps file so that its operations are retried according to
+// policy. Retries stop once ctx is done or its deadline would pass before the
+// next attempt.
+func NewRetryFile(ctx context.Context, file source.ParquetFile, policy Policy) source.ParquetFile {
+	return &RetryFile{
+		ctx:    ctx,
+		file:   file,
+		policy: policy.withDefaults(),
+	}
+}
+
+// wait sleeps before the given retry. It returns false if the context is done
+// or its deadline would pass first.
+func (r *RetryFile) wait(retry int) bool {
+	d := r.policy.backoff(retry)
+	if deadline, ok := r.ctx.Deadline(); ok && time.Until(deadline) < d {
+		return false
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-r.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// do runs op until it succeeds, fails with an error that is not retryable or
+// runs out of attempts.
+func (r *RetryFile) do(op func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= r.policy.MaxAttempts || !r.policy.Retryable(err) || !r.wait(attempt) {
+			return err
+		}
+	}
+}
+
+// Seek sets the offset for the next Read or Write
+func (r *RetryFile) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	err := r.do(func() (err error) {
+		pos, err = r.file.Seek(offset, whence)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	r.offset = pos
+	return pos, nil
+}
+
+// Read fills p from the wrapped file. After a retryable failure the wrapped
+// file is seeked back to the first byte not yet read and the read resumes
+// from there. Attempts are counted from the last read making progress.
+func (r *RetryFile) Read(p []byte) (n int, err error) {
+	failures := 0
+	for {
+		var m int
+		m, err = r.file.Read(p[n:])
+		n += m
+		r.offset += int64(m)
+		switch {
+		case n == len(p):
+			return n, nil
+		case err == io.EOF && n > 0:
+			return n, nil
+		case err == nil || err == io.EOF:
+			return n, err
+		}
+
+		if m > 0 {
+			// progress was made, start counting again
+			failures = 0
+		}
+		failures++
+		if failures >= r.policy.MaxAttempts || !r.policy.Retryable(err) || !r.wait(failures) {
+			return n, err
+		}
+
+		// the state of the wrapped file is unknown after a failure
+		if _, seekErr := r.file.Seek(r.offset, io.SeekStart); seekErr != nil {
+			return n, err
+		}
+	}
+}
+
+// Write writes p to the wrapped file. Failed writes are only retried if the
+// policy enables it and no byte of p was accepted.
+func (r *RetryFile) Write(p []byte) (n int, err error) {
+	for attempt := 1; ; attempt++ {
+		n, err = r.file.Write(p)
+		r.offset += int64(n)
+		if err == nil || n > 0 || !r.policy.RetryWrites {
+			return n, err
+		}
+		if attempt >= r.policy.MaxAttempts || !r.policy.Retryable(err) || !r.wait(attempt) {
+			return n, err
+		}
+	}
+}
+
+// Open opens name through the wrapped file, retrying failures, and wraps the
+// result with the same policy
+func (r *RetryFile) Open(name string) (source.ParquetFile, error) {
+	var file source.ParquetFile
+	err := r.do(func() (err error) {
+		file, err = r.file.Open(name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &RetryFile{ctx: r.ctx, file: file, policy: r.policy}, nil
+}
+
+// Create creates name through the wrapped file, retrying failures, and wraps
+// the result with the same policy
+func (r *RetryFile) Create(name string) (source.ParquetFile, error) {
+	var file source.ParquetFile
+	err := r.do(func() (err error) {
+		file, err = r.file.Create(name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &RetryFile{ctx: r.ctx, file: file, policy: r.policy}, nil
+}
+
+// Abort aborts the wrapped file if it implements abort.Aborter. It is not
+// retried.
+func (r *RetryFile) Abort(err error) error {
+	return abort.Abort(r.file, err)
+}
+
+// Close closes the wrapped file. It is not retried, as closing a writer
+// commits its upload.
+func (r *RetryFile) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,243 @@
+package retry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go-source/sourcetest"
+	"github.com/xitongsys/parquet-go/source"
+	"google.golang.org/api/googleapi"
+)
+
+var fastPolicy = Policy{InitialBackoff: time.Microsecond, MaxBackoff: time.Millisecond}
+
+// flakyFile serves data and fails reads and writes with the queued errors.
+// A failing read returns half of the requested bytes first, unless stall is
+// set.
+type flakyFile struct {
+	data     []byte
+	offset   int64
+	errs     []error
+	stall    bool
+	reads    int
+	written  bytes.Buffer
+	writeErr []error
+}
+
+func (f *flakyFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.data))
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *flakyFile) Read(p []byte) (int, error) {
+	f.reads++
+	if f.offset >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data[f.offset:])
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		n /= 2
+		if f.stall {
+			n = 0
+		}
+		// the position after a failure is garbage
+		f.offset += int64(n) + 3
+		return n, err
+	}
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *flakyFile) Write(p []byte) (int, error) {
+	if len(f.writeErr) > 0 {
+		err := f.writeErr[0]
+		f.writeErr = f.writeErr[1:]
+		return 0, err
+	}
+	return f.written.Write(p)
+}
+
+func (f *flakyFile) Open(string) (source.ParquetFile, error)   { return f, nil }
+func (f *flakyFile) Create(string) (source.ParquetFile, error) { return f, nil }
+func (f *flakyFile) Close() error                              { return nil }
+
+func TestReadResumes(t *testing.T) {
+	data := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	reset := fmt.Errorf("read tcp: %w", syscall.ECONNRESET)
+	f := &flakyFile{data: data, errs: []error{reset, reset, reset}}
+	r := NewRetryFile(context.Background(), f, fastPolicy)
+
+	if _, err := r.Seek(4, io.SeekStart); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if string(got) != string(data[4:]) {
+		t.Errorf("expected %q but got %q", data[4:], got)
+	}
+}
+
+func TestReadGivesUp(t *testing.T) {
+	data := make([]byte, 100)
+	failure := &azcore.ResponseError{StatusCode: http.StatusServiceUnavailable}
+	f := &flakyFile{data: data, errs: []error{failure, failure, failure}, stall: true}
+	r := NewRetryFile(context.Background(), f, Policy{MaxAttempts: 2, InitialBackoff: time.Microsecond})
+
+	n, err := r.Read(make([]byte, 100))
+	if err != failure {
+		t.Errorf("expected the last error unchanged but got %v", err)
+	}
+	if n != 0 || f.reads != 2 {
+		t.Errorf("expected 2 reads without data but got %d reads and %d bytes", f.reads, n)
+	}
+}
+
+func TestReadNotRetryable(t *testing.T) {
+	notFound := awserr.New("NoSuchKey", "not found", nil)
+	f := &flakyFile{data: make([]byte, 10), errs: []error{notFound}}
+	r := NewRetryFile(context.Background(), f, fastPolicy)
+
+	if _, err := r.Read(make([]byte, 10)); err != notFound {
+		t.Errorf("expected %v but got %v", notFound, err)
+	}
+	if f.reads != 1 {
+		t.Errorf("expected a single read but got %d", f.reads)
+	}
+}
+
+func TestReadHonoursDeadline(t *testing.T) {
+	f := &flakyFile{data: make([]byte, 10), errs: []error{io.ErrUnexpectedEOF, io.ErrUnexpectedEOF}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	r := NewRetryFile(ctx, f, Policy{InitialBackoff: time.Hour})
+
+	start := time.Now()
+	if _, err := r.Read(make([]byte, 10)); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected %v but got %v", io.ErrUnexpectedEOF, err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("expected retries to stop at the context deadline")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	throttled := &googleapi.Error{Code: http.StatusTooManyRequests}
+
+	f := &flakyFile{writeErr: []error{throttled}}
+	r := NewRetryFile(context.Background(), f, fastPolicy)
+	if _, err := r.Write([]byte("data")); err != throttled {
+		t.Errorf("expected writes not to be retried by default but got %v", err)
+	}
+
+	policy := fastPolicy
+	policy.RetryWrites = true
+	f = &flakyFile{writeErr: []error{throttled}}
+	r = NewRetryFile(context.Background(), f, policy)
+	if n, err := r.Write([]byte("data")); err != nil || n != 4 {
+		t.Errorf("expected write to be retried but got %d, %v", n, err)
+	}
+	if f.written.String() != "data" {
+		t.Errorf("expected data to be written once but got %q", f.written.String())
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	cases := []struct {
+		err       error
+		retryable bool
+	}{
+		{nil, false},
+		{io.EOF, false},
+		{context.Canceled, false},
+		{context.DeadlineExceeded, false},
+		{errors.New("boom"), false},
+		{io.ErrUnexpectedEOF, true},
+		{fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, false},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "bucket.invalid", IsNotFound: true}}, false},
+		{&net.OpError{Op: "read", Net: "tcp", Err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}}, true},
+		{awserr.New("SlowDown", "slow down", nil), true},
+		{awserr.New("NoSuchKey", "not found", nil), false},
+		{awserr.New("RequestError", "send request failed", syscall.ECONNRESET), true},
+		{awserr.NewRequestFailure(awserr.New("InternalError", "", nil), 500, "id"), true},
+		{awserr.NewRequestFailure(awserr.New("AccessDenied", "", nil), 403, "id"), false},
+		{&azcore.ResponseError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&azcore.ResponseError{StatusCode: http.StatusNotFound}, false},
+		{&googleapi.Error{Code: http.StatusTooManyRequests}, true},
+		{fmt.Errorf("wrapped: %w", &googleapi.Error{Code: http.StatusForbidden}), false},
+		{sourceerrors.Wrap(sourceerrors.ErrThrottled, errors.New("busy")), true},
+		{sourceerrors.Wrap(sourceerrors.ErrNotFound, io.ErrUnexpectedEOF), false},
+	}
+
+	for _, c := range cases {
+		if got := IsRetryable(c.err); got != c.retryable {
+			t.Errorf("IsRetryable(%v): expected %v but got %v", c.err, c.retryable, got)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := Policy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond, Jitter: -1}.withDefaults()
+	expected := []time.Duration{10, 20, 40, 50, 50}
+	for i, e := range expected {
+		if got := p.backoff(i + 1); got != e*time.Millisecond {
+			t.Errorf("backoff(%d): expected %v but got %v", i+1, e*time.Millisecond, got)
+		}
+	}
+
+	// jitter is on by default
+	p = Policy{InitialBackoff: 10 * time.Millisecond}.withDefaults()
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(1); got < 5*time.Millisecond || got > 10*time.Millisecond {
+			t.Fatalf("expected jittered backoff within [5ms, 10ms] but got %v", got)
+		}
+	}
+}
+
+func TestConformance(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	sourcetest.RunConformance(t, sourcetest.Factory{
+		Open: func(name string) (source.ParquetFile, error) {
+			file, err := local.NewLocalFileReader(name)
+			if err != nil {
+				return nil, err
+			}
+			return NewRetryFile(ctx, file, fastPolicy), nil
+		},
+		Create: func(name string) (source.ParquetFile, error) {
+			file, err := local.NewLocalFileWriter(name)
+			if err != nil {
+				return nil, err
+			}
+			return NewRetryFile(ctx, file, fastPolicy), nil
+		},
+		Path: func(name string) string {
+			return filepath.Join(dir, name)
+		},
+	})
+}
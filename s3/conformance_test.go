@@ -0,0 +1,92 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/xitongsys/parquet-go-source/abort"
+	"github.com/xitongsys/parquet-go-source/footer"
+	"github.com/xitongsys/parquet-go-source/s3fake"
+	"github.com/xitongsys/parquet-go-source/sourcetest"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+func TestConformance(t *testing.T) {
+	srv := s3fake.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("bucket")
+	client := s3.New(srv.Session())
+	ctx := context.Background()
+
+	for _, minRequestSize := range []int{0, 1000} {
+		for _, footerCache := range []*footer.Cache{nil, footer.NewCache(1000, 0)} {
+			name := fmt.Sprintf("MinRequestSize=%d/FooterCache=%t", minRequestSize, footerCache != nil)
+			minRequestSize, footerCache := minRequestSize, footerCache
+			t.Run(name, func(t *testing.T) {
+				sourcetest.RunConformance(t, sourcetest.Factory{
+					Open: func(name string) (source.ParquetFile, error) {
+						return NewS3FileReaderWithParams(ctx, S3FileReaderParams{
+							Bucket:         "bucket",
+							Key:            name,
+							S3Client:       client,
+							MinRequestSize: minRequestSize,
+							FooterCache:    footerCache,
+						})
+					},
+					Create: func(name string) (source.ParquetFile, error) {
+						return NewS3FileWriterWithClient(ctx, client, "bucket", name, "", nil)
+					},
+				})
+			})
+		}
+	}
+}
+
+func TestAbort(t *testing.T) {
+	srv := s3fake.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("bucket")
+	client := s3.New(srv.Session())
+	ctx := context.Background()
+
+	// before the first write, with a single part buffered, and a multipart
+	// upload with parts already sent
+	for _, size := range []int64{0, 10, s3manager.MinUploadPartSize + 10} {
+		w, err := NewS3FileWriterWithClient(ctx, client, "bucket", "key", "", nil)
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		if _, err = w.Write(make([]byte, size)); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		if size > s3manager.MinUploadPartSize {
+			// the multipart upload starts once the first part is read
+			deadline := time.Now().Add(5 * time.Second)
+			for srv.Uploads() == 0 && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if srv.Uploads() != 1 {
+				t.Fatalf("expected a multipart upload to be started but got %d", srv.Uploads())
+			}
+		}
+
+		cause := errors.New("job failed")
+		if err = w.(abort.Aborter).Abort(cause); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		if _, err = w.Write([]byte("more")); !errors.Is(err, cause) {
+			t.Errorf("size %d: expected writes after Abort to fail with the cause but got %v", size, err)
+		}
+		if err = w.Close(); !errors.Is(err, cause) {
+			t.Errorf("size %d: expected Close after Abort to fail with the cause but got %v", size, err)
+		}
+		if _, ok := srv.GetObject("bucket", "key"); ok || srv.Uploads() != 0 {
+			t.Errorf("size %d: expected nothing to be published but got %d uploads", size, srv.Uploads())
+		}
+	}
+}
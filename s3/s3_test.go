@@ -4,15 +4,22 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"os"
+	"strings"
+	"syscall"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/golang/mock/gomock"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
 	"github.com/xitongsys/parquet-go-source/s3/mocks"
 )
 
@@ -30,10 +37,11 @@ func TestSeek(t *testing.T) {
 		{"no file size seek current", 0, 500, 5, io.SeekCurrent, 5, nil},
 		{"no file size seek end", 0, 500, -8, io.SeekEnd, -8, nil},
 		{"seek start", 20, 10, 5, io.SeekStart, 5, nil},
-		{"seek start read past end", 20, 0, 21, io.SeekStart, 0, errInvalidOffset},
+		{"seek start past end", 20, 0, 21, io.SeekStart, 21, nil},
 		{"seek current", 20, 5, 5, io.SeekCurrent, 10, nil},
-		{"seek current read past end", 20, 10, 20, io.SeekCurrent, 0, errInvalidOffset},
-		{"seek end", 20, 10, -5, io.SeekEnd, -5, nil},
+		{"seek current past end", 20, 10, 20, io.SeekCurrent, 30, nil},
+		{"seek end", 20, 10, -5, io.SeekEnd, 15, nil},
+		{"seek end past end", 20, 10, 5, io.SeekEnd, 25, nil},
 		{"seek end read past beginning", 20, 0, -30, io.SeekEnd, 0, errInvalidOffset},
 		{"seek end offset 0", 20, 0, 0, io.SeekEnd, 20, nil},
 		{"invalid whence", 20, 0, 0, 6, 0, errWhence},
@@ -160,6 +168,126 @@ func TestRead(t *testing.T) {
 	}
 }
 
+// resetBody returns data and then fails like a reset connection.
+type resetBody struct {
+	data []byte
+}
+
+func (b *resetBody) Read(p []byte) (int, error) {
+	if len(b.data) == 0 {
+		return 0, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	}
+	n := copy(p, b.data)
+	b.data = b.data[n:]
+	return n, nil
+}
+
+func (b *resetBody) Close() error {
+	return nil
+}
+
+func TestReadResumesAfterConnectionReset(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	data := "some data that is read in two requests"
+	etag := `"some-etag"`
+	mockClient := mocks.NewMockS3API(ctrl)
+	gomock.InOrder(
+		mockClient.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ aws.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+				return &s3.GetObjectOutput{Body: &resetBody{data: []byte(data[:10])}}, nil
+			}),
+		mockClient.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ aws.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+				expectedRange := fmt.Sprintf(rangeHeader, 10, len(data)-1)
+				if aws.StringValue(in.Range) != expectedRange {
+					t.Errorf("expected range to be %q but got %q", expectedRange, aws.StringValue(in.Range))
+				}
+				if aws.StringValue(in.IfMatch) != etag {
+					t.Errorf("expected If-Match to be %q but got %q", etag, aws.StringValue(in.IfMatch))
+				}
+				return &s3.GetObjectOutput{Body: ioutil.NopCloser(strings.NewReader(data[10:]))}, nil
+			}),
+	)
+	s := &S3File{
+		ctx:            context.Background(),
+		client:         mockClient,
+		fileSize:       int64(len(data)),
+		minRequestSize: defaultMinRequestSize,
+		maxReadRetries: defaultMaxReadRetries,
+		etag:           etag,
+	}
+
+	b := make([]byte, len(data))
+	readBytes, err := s.Read(b)
+	if err != nil {
+		t.Errorf("expected error to be nil but got %q", err.Error())
+	}
+	if readBytes != len(data) || string(b) != data {
+		t.Errorf("expected data to be %q but got %q", data, string(b[:readBytes]))
+	}
+}
+
+func TestReadResumeRetriesExhausted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mocks.NewMockS3API(ctrl)
+	mockClient.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ aws.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{Body: &resetBody{}}, nil
+		}).Times(2)
+	s := &S3File{
+		ctx:            context.Background(),
+		client:         mockClient,
+		fileSize:       100,
+		minRequestSize: defaultMinRequestSize,
+		maxReadRetries: 1,
+	}
+
+	readBytes, err := s.Read(make([]byte, 10))
+	if readBytes != 0 {
+		t.Errorf("expected to read 0 bytes but got %d", readBytes)
+	}
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("expected connection reset error but got %v", err)
+	}
+}
+
+func TestReadObjectChanged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	etag := `"some-etag"`
+	mockClient := mocks.NewMockS3API(ctrl)
+	mockClient.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ aws.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+			if aws.StringValue(in.IfMatch) != etag {
+				t.Errorf("expected If-Match to be %q but got %q", etag, aws.StringValue(in.IfMatch))
+			}
+			return nil, awserr.NewRequestFailure(awserr.New("PreconditionFailed", "At least one of the pre-conditions you specified did not hold", nil), http.StatusPreconditionFailed, "")
+		})
+	s := &S3File{
+		ctx:            context.Background(),
+		client:         mockClient,
+		fileSize:       100,
+		minRequestSize: defaultMinRequestSize,
+		etag:           etag,
+		BucketName:     "bucket",
+		Key:            "key",
+	}
+
+	_, err := s.Read(make([]byte, 10))
+	if !errors.Is(err, sourceerrors.ErrObjectChanged) {
+		t.Errorf("expected ErrObjectChanged but got %v", err)
+	}
+	var reqErr awserr.RequestFailure
+	if !errors.As(err, &reqErr) {
+		t.Errorf("expected the S3 error to be wrapped but got %v", err)
+	}
+}
+
 func TestWriteWithPriorEncounteredError(t *testing.T) {
 	data := []byte("some data")
 	errMessage := "some write error"
@@ -533,3 +661,20 @@ func TestGetBytesRange(t *testing.T) {
 		})
 	}
 }
+
+func TestWrapPreconditionFailed(t *testing.T) {
+	failure := awserr.NewRequestFailure(awserr.New("PreconditionFailed", "", nil), http.StatusPreconditionFailed, "id")
+
+	// without a pinned version, e.g. on writes, a 412 is only a failed condition
+	s := &S3File{BucketName: "bucket", Key: "key"}
+	err := s.wrapError(failure)
+	if !errors.Is(err, sourceerrors.ErrPreconditionFailed) || errors.Is(err, sourceerrors.ErrObjectChanged) {
+		t.Errorf("expected ErrPreconditionFailed but got %v", err)
+	}
+
+	s.etag = `"etag"`
+	var changed *sourceerrors.ObjectChangedError
+	if err = s.wrapError(failure); !errors.As(err, &changed) || changed.Version != s.etag {
+		t.Errorf("expected ObjectChangedError for the pinned version but got %v", err)
+	}
+}
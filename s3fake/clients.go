@@ -0,0 +1,53 @@
+package s3fake
+
+import (
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	credentialsv2 "github.com/aws/aws-sdk-go-v2/credentials"
+	s3v2 "github.com/aws/aws-sdk-go-v2/service/s3"
+	awsv1 "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/minio/minio-go/v7"
+	miniocredentials "github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Session returns an aws-sdk-go session using the server, e.g. for s3.New.
+func (s *Server) Session() *session.Session {
+	return session.Must(session.NewSession(&awsv1.Config{
+		Endpoint:         awsv1.String(s.URL),
+		Region:           awsv1.String(Region),
+		Credentials:      credentials.NewStaticCredentials(AccessKey, SecretKey, ""),
+		S3ForcePathStyle: awsv1.Bool(true),
+	}))
+}
+
+// ClientV2 returns an aws-sdk-go-v2 client using the server. optFns are
+// applied after the options pointing the client at the server.
+func (s *Server) ClientV2(optFns ...func(*s3v2.Options)) *s3v2.Client {
+	return s3v2.New(s3v2.Options{
+		BaseEndpoint: aws.String(s.URL),
+		Region:       Region,
+		Credentials:  credentialsv2.NewStaticCredentialsProvider(AccessKey, SecretKey, ""),
+		UsePathStyle: true,
+	}, optFns...)
+}
+
+// MinioClient returns a minio client using the server.
+func (s *Server) MinioClient() *minio.Client {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		panic(err)
+	}
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:        miniocredentials.NewStaticV4(AccessKey, SecretKey, ""),
+		Secure:       false,
+		Region:       Region,
+		BucketLookup: minio.BucketLookupPath,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
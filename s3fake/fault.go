@@ -0,0 +1,129 @@
+package s3fake
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// chunkSize is the amount of data written between the delays of a slow body.
+const chunkSize = 32 << 10
+
+// Fault describes how the server misbehaves for a request.
+type Fault struct {
+	// Status makes the server reply with an error of this status instead of
+	// serving the request. Optional.
+	Status int
+	// Code is the S3 error code sent with Status. It defaults to SlowDown for
+	// 503, InternalError for other 5xx statuses and AccessDenied otherwise.
+	// Optional.
+	Code string
+	// Drop makes the server close the connection after sending DropAfter bytes
+	// of the response body, or before replying if DropAfter is zero. Optional.
+	Drop      bool
+	DropAfter int64
+	// Delay is waited before every 32KiB of the response body. Optional.
+	Delay time.Duration
+}
+
+func (f *Fault) code() string {
+	switch {
+	case f.Code != "":
+		return f.Code
+	case f.Status == http.StatusServiceUnavailable:
+		return "SlowDown"
+	case f.Status >= 500:
+		return "InternalError"
+	default:
+		return "AccessDenied"
+	}
+}
+
+// FaultFunc returns the fault to inject for a request, or nil to serve it
+// normally. It is called concurrently.
+type FaultFunc func(r *http.Request) *Fault
+
+// SetFault installs the function choosing the faults to inject. A nil function
+// removes it.
+func (s *Server) SetFault(f FaultFunc) {
+	s.lock.Lock()
+	s.fault = f
+	s.lock.Unlock()
+}
+
+// Throttle replies to the next n requests with 503 SlowDown.
+func Throttle(n int) FaultFunc {
+	return limit(n, &Fault{Status: http.StatusServiceUnavailable})
+}
+
+// DropConnection closes the connection of the next n GET requests after
+// sending after bytes of their body.
+func DropConnection(n int, after int64) FaultFunc {
+	drop := limit(n, &Fault{Drop: true, DropAfter: after})
+	return func(r *http.Request) *Fault {
+		if _, key := splitPath(r.URL.Path); r.Method != http.MethodGet || key == "" {
+			return nil
+		}
+		return drop(r)
+	}
+}
+
+// SlowBody waits delay before every 32KiB of the response bodies.
+func SlowBody(delay time.Duration) FaultFunc {
+	return func(r *http.Request) *Fault {
+		return &Fault{Delay: delay}
+	}
+}
+
+// limit returns fault for the first n requests.
+func limit(n int, fault *Fault) FaultFunc {
+	var lock sync.Mutex
+	return func(r *http.Request) *Fault {
+		lock.Lock()
+		defer lock.Unlock()
+		if n <= 0 {
+			return nil
+		}
+		n--
+		return fault
+	}
+}
+
+// faultWriter slows down or cuts the body of a response.
+type faultWriter struct {
+	http.ResponseWriter
+	fault     *Fault
+	remaining int64
+}
+
+func (w *faultWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+		if w.fault.Drop && int64(len(chunk)) >= w.remaining {
+			chunk = chunk[:w.remaining]
+		}
+		if w.fault.Delay > 0 {
+			time.Sleep(w.fault.Delay)
+		}
+
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		w.remaining -= int64(n)
+		if err != nil {
+			return written, err
+		}
+		if w.fault.Drop && w.remaining <= 0 {
+			if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+				flusher.Flush()
+			}
+			// makes the server close the connection without ending the response
+			panic(http.ErrAbortHandler)
+		}
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
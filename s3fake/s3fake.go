@@ -0,0 +1,735 @@
+// Package s3fake runs an in-memory server speaking enough of the S3 REST API
+// to test the s3, s3v2 and minio backends without network access or mocks:
+//
+//	srv := s3fake.NewServer()
+//	defer srv.Close()
+//	srv.CreateBucket("bucket")
+//	pf, err := s3.NewS3FileWriterWithClient(ctx, awss3.New(srv.Session()), "bucket", "key", nil)
+//
+// The server supports path-style HEAD, ranged GET, PUT and DELETE of objects,
+// multipart uploads, versioning, ETags and the If-Match and If-None-Match
+// conditions. Requests are not authenticated. Faults such as throttling,
+// dropped connections and slow bodies can be injected with SetFault.
+package s3fake
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Region is the region of the server.
+	Region = "us-east-1"
+	// AccessKey and SecretKey are the credentials used by the clients built by
+	// the server. Any credentials are accepted.
+	AccessKey = "s3fake"
+	SecretKey = "s3fake-secret"
+
+	// MinPartSize is the smallest size of the parts of a multipart upload,
+	// except for the last one.
+	MinPartSize = 5 << 20
+)
+
+// Object is a version of an object stored by the server.
+type Object struct {
+	Data         []byte
+	ETag         string
+	VersionID    string
+	LastModified time.Time
+	DeleteMarker bool
+	// ContentType and Metadata are taken from the Content-Type and
+	// x-amz-meta-* headers of the upload. The keys of Metadata are lower case.
+	ContentType string
+	Metadata    map[string]string
+}
+
+// setHeaders records the content type and user metadata sent with an upload.
+func (obj *Object) setHeaders(header http.Header) {
+	obj.ContentType = header.Get("Content-Type")
+	for name := range header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, metaPrefix) {
+			if obj.Metadata == nil {
+				obj.Metadata = map[string]string{}
+			}
+			obj.Metadata[strings.TrimPrefix(lower, metaPrefix)] = header.Get(name)
+		}
+	}
+}
+
+const metaPrefix = "x-amz-meta-"
+
+type bucket struct {
+	versioning bool
+	// objects holds the versions of every key, the latest last
+	objects map[string][]*Object
+}
+
+type upload struct {
+	bucket string
+	key    string
+	header http.Header
+	parts  map[int][]byte
+}
+
+// Server is an in-memory S3 server listening on a local port.
+type Server struct {
+	// URL is the endpoint of the server, e.g. http://127.0.0.1:1234.
+	URL string
+
+	srv *httptest.Server
+
+	lock     sync.Mutex
+	buckets  map[string]*bucket
+	uploads  map[string]*upload
+	nextID   int
+	fault    FaultFunc
+	requests int
+}
+
+// NewServer starts a server without buckets.
+func NewServer() *Server {
+	s := &Server{
+		buckets: map[string]*bucket{},
+		uploads: map[string]*upload{},
+	}
+	s.srv = httptest.NewServer(s)
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// CreateBucket creates an empty bucket, if it does not exist yet.
+func (s *Server) CreateBucket(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.buckets[name] == nil {
+		s.buckets[name] = &bucket{objects: map[string][]*Object{}}
+	}
+}
+
+// EnableVersioning makes the bucket keep the previous versions of its objects.
+// The bucket is created if needed.
+func (s *Server) EnableVersioning(name string) {
+	s.CreateBucket(name)
+	s.lock.Lock()
+	s.buckets[name].versioning = true
+	s.lock.Unlock()
+}
+
+// PutObject stores data as the latest version of key, bypassing the HTTP API.
+// The bucket is created if needed.
+func (s *Server) PutObject(bucketName, key string, data []byte) *Object {
+	s.CreateBucket(bucketName)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.put(s.buckets[bucketName], key, data)
+}
+
+// GetObject returns the latest version of key.
+func (s *Server) GetObject(bucketName, key string) (*Object, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	b := s.buckets[bucketName]
+	if b == nil {
+		return nil, false
+	}
+	obj := latest(b, key)
+	return obj, obj != nil
+}
+
+// Uploads returns the number of multipart uploads neither completed nor
+// aborted.
+func (s *Server) Uploads() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.uploads)
+}
+
+// Requests returns the number of requests received so far.
+func (s *Server) Requests() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests
+}
+
+// put stores a new version of key. The lock must be held.
+func (s *Server) put(b *bucket, key string, data []byte) *Object {
+	sum := md5.Sum(data)
+	return s.store(b, key, data, `"`+hex.EncodeToString(sum[:])+`"`)
+}
+
+// store stores a new version of key with the given ETag. The lock must be
+// held.
+func (s *Server) store(b *bucket, key string, data []byte, etag string) *Object {
+	obj := &Object{
+		Data: data,
+		ETag: etag,
+		// Last-Modified has a resolution of a second
+		LastModified: time.Now().UTC().Truncate(time.Second),
+	}
+	if b.versioning {
+		s.nextID++
+		obj.VersionID = fmt.Sprintf("v%d", s.nextID)
+		b.objects[key] = append(b.objects[key], obj)
+	} else {
+		b.objects[key] = []*Object{obj}
+	}
+	return obj
+}
+
+// latest returns the latest version of key, or nil if it does not exist or
+// was deleted. The lock must be held.
+func latest(b *bucket, key string) *Object {
+	versions := b.objects[key]
+	if len(versions) == 0 || versions[len(versions)-1].DeleteMarker {
+		return nil
+	}
+	return versions[len(versions)-1]
+}
+
+// ServeHTTP implements the S3 REST API for path-style URLs.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	s.requests++
+	faultFunc := s.fault
+	s.lock.Unlock()
+
+	var fault *Fault
+	if faultFunc != nil {
+		fault = faultFunc(r)
+	}
+	if fault != nil {
+		if fault.Status != 0 {
+			// the body is drained so that clients see the response rather than
+			// a reset connection
+			io.Copy(ioutil.Discard, r.Body)
+			writeError(w, r, fault.Status, fault.code(), "injected fault")
+			return
+		}
+		if fault.Drop && fault.DropAfter == 0 {
+			panic(http.ErrAbortHandler)
+		}
+		w = &faultWriter{ResponseWriter: w, fault: fault, remaining: fault.DropAfter}
+	}
+
+	bucketName, key := splitPath(r.URL.Path)
+	query := r.URL.Query()
+	_, hasUploads := query["uploads"]
+	uploadID := query.Get("uploadId")
+
+	switch {
+	case bucketName == "":
+		writeError(w, r, http.StatusNotImplemented, "NotImplemented", "listing buckets is not supported")
+	case key == "":
+		s.serveBucket(w, r, bucketName)
+	case r.Method == http.MethodPost && hasUploads:
+		s.createMultipartUpload(w, r, bucketName, key)
+	case r.Method == http.MethodPut && uploadID != "":
+		s.uploadPart(w, r, uploadID)
+	case r.Method == http.MethodPost && uploadID != "":
+		s.completeMultipartUpload(w, r, bucketName, key, uploadID)
+	case r.Method == http.MethodDelete && uploadID != "":
+		s.abortMultipartUpload(w, r, uploadID)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		s.getObject(w, r, bucketName, key)
+	case r.Method == http.MethodPut:
+		s.putObject(w, r, bucketName, key)
+	case r.Method == http.MethodDelete:
+		s.deleteObject(w, r, bucketName, key)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "method not allowed")
+	}
+}
+
+// splitPath splits /bucket/key into its bucket and key.
+func splitPath(path string) (string, string) {
+	path = strings.TrimPrefix(path, "/")
+	i := strings.IndexByte(path, '/')
+	if i < 0 {
+		return path, ""
+	}
+	return path[:i], path[i+1:]
+}
+
+func (s *Server) serveBucket(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method == http.MethodPut {
+		s.CreateBucket(name)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	b := s.buckets[name]
+	if b == nil {
+		writeError(w, r, http.StatusNotFound, "NoSuchBucket", "the bucket does not exist")
+		return
+	}
+
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet && query.Get("location") != "" || hasKey(query, "location"):
+		writeXML(w, http.StatusOK, struct {
+			XMLName xml.Name `xml:"LocationConstraint"`
+			Region  string   `xml:",chardata"`
+		}{Region: Region})
+	case r.Method == http.MethodGet:
+		prefix := query.Get("prefix")
+		result := listResult{Name: name, Prefix: prefix}
+		keys := make([]string, 0, len(b.objects))
+		for key := range b.objects {
+			if strings.HasPrefix(key, prefix) && latest(b, key) != nil {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			obj := latest(b, key)
+			result.Contents = append(result.Contents, listEntry{
+				Key:          key,
+				Size:         int64(len(obj.Data)),
+				ETag:         obj.ETag,
+				LastModified: obj.LastModified.Format(time.RFC3339),
+			})
+		}
+		result.KeyCount = len(result.Contents)
+		writeXML(w, http.StatusOK, result)
+	default:
+		writeError(w, r, http.StatusNotImplemented, "NotImplemented", "bucket operation is not supported")
+	}
+}
+
+func hasKey(query map[string][]string, key string) bool {
+	_, ok := query[key]
+	return ok
+}
+
+type listEntry struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified string
+}
+
+type listResult struct {
+	XMLName  xml.Name `xml:"ListBucketResult"`
+	Name     string
+	Prefix   string
+	KeyCount int
+	Contents []listEntry
+}
+
+// lookup returns the bucket and the requested version of key, or writes the
+// matching error. The lock must be held.
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request, bucketName, key string) (*bucket, *Object) {
+	b := s.buckets[bucketName]
+	if b == nil {
+		writeError(w, r, http.StatusNotFound, "NoSuchBucket", "the bucket does not exist")
+		return nil, nil
+	}
+
+	versionID := r.URL.Query().Get("versionId")
+	if versionID == "" {
+		obj := latest(b, key)
+		if obj == nil {
+			writeError(w, r, http.StatusNotFound, "NoSuchKey", "the key does not exist")
+		}
+		return b, obj
+	}
+
+	for _, obj := range b.objects[key] {
+		if obj.VersionID == versionID && !obj.DeleteMarker {
+			return b, obj
+		}
+	}
+	writeError(w, r, http.StatusNotFound, "NoSuchVersion", "the version does not exist")
+	return b, nil
+}
+
+// checkConditions writes the response of a failed If-Match or If-None-Match
+// condition. obj is nil if the object does not exist.
+func checkConditions(w http.ResponseWriter, r *http.Request, obj *Object) bool {
+	if match := r.Header.Get("If-Match"); match != "" {
+		if obj == nil || !etagMatches(match, obj.ETag) {
+			writeError(w, r, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+			return false
+		}
+	}
+	if noneMatch := r.Header.Get("If-None-Match"); noneMatch != "" && obj != nil {
+		if noneMatch == "*" || etagMatches(noneMatch, obj.ETag) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotModified)
+			} else {
+				writeError(w, r, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// etagMatches reports whether one of the ETags listed in a condition header
+// matches etag. Quotes are optional, as with S3.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.Trim(candidate, `"`) == strings.Trim(etag, `"`) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, bucketName, key string) {
+	s.lock.Lock()
+	b, obj := s.lookup(w, r, bucketName, key)
+	s.lock.Unlock()
+	if obj == nil || !checkConditions(w, r, obj) {
+		return
+	}
+
+	size := int64(len(obj.Data))
+	start, end := int64(0), size-1
+	status := http.StatusOK
+	if header := r.Header.Get("Range"); header != "" {
+		var ok bool
+		if start, end, ok = parseRange(header, size); !ok {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			writeError(w, r, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable")
+			return
+		}
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	}
+
+	header := w.Header()
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	header.Set("Content-Type", "application/octet-stream")
+	if obj.ContentType != "" {
+		header.Set("Content-Type", obj.ContentType)
+	}
+	for name, value := range obj.Metadata {
+		header.Set(metaPrefix+name, value)
+	}
+	header.Set("ETag", obj.ETag)
+	header.Set("Last-Modified", obj.LastModified.Format(http.TimeFormat))
+	if b.versioning {
+		header.Set("x-amz-version-id", obj.VersionID)
+	}
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		w.Write(obj.Data[start : end+1])
+	}
+}
+
+// parseRange parses a single range of a Range header, as S3 does. It returns
+// false if the range cannot be satisfied.
+func parseRange(header string, size int64) (int64, int64, bool) {
+	spec := strings.TrimPrefix(header, "bytes=")
+	i := strings.IndexByte(spec, '-')
+	if spec == header || i < 0 || strings.Contains(spec, ",") {
+		// S3 ignores invalid and multiple ranges
+		return 0, size - 1, size > 0
+	}
+
+	first, last := spec[:i], spec[i+1:]
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, true
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, bucketName, key string) {
+	data, err := readBody(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	b := s.buckets[bucketName]
+	if b == nil {
+		writeError(w, r, http.StatusNotFound, "NoSuchBucket", "the bucket does not exist")
+		return
+	}
+	if !checkConditions(w, r, latest(b, key)) {
+		return
+	}
+
+	obj := s.put(b, key, data)
+	obj.setHeaders(r.Header)
+	w.Header().Set("ETag", obj.ETag)
+	if b.versioning {
+		w.Header().Set("x-amz-version-id", obj.VersionID)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) deleteObject(w http.ResponseWriter, r *http.Request, bucketName, key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	b := s.buckets[bucketName]
+	if b == nil {
+		writeError(w, r, http.StatusNotFound, "NoSuchBucket", "the bucket does not exist")
+		return
+	}
+
+	versionID := r.URL.Query().Get("versionId")
+	switch {
+	case versionID != "":
+		versions := b.objects[key][:0]
+		for _, obj := range b.objects[key] {
+			if obj.VersionID != versionID {
+				versions = append(versions, obj)
+			}
+		}
+		b.objects[key] = versions
+	case b.versioning:
+		s.nextID++
+		marker := &Object{VersionID: fmt.Sprintf("v%d", s.nextID), DeleteMarker: true, LastModified: time.Now().UTC()}
+		b.objects[key] = append(b.objects[key], marker)
+		w.Header().Set("x-amz-delete-marker", "true")
+		w.Header().Set("x-amz-version-id", marker.VersionID)
+	default:
+		delete(b.objects, key)
+	}
+	if len(b.objects[key]) == 0 {
+		delete(b.objects, key)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucketName, key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.buckets[bucketName] == nil {
+		writeError(w, r, http.StatusNotFound, "NoSuchBucket", "the bucket does not exist")
+		return
+	}
+
+	s.nextID++
+	id := fmt.Sprintf("upload-%d", s.nextID)
+	s.uploads[id] = &upload{bucket: bucketName, key: key, header: r.Header.Clone(), parts: map[int][]byte{}}
+	writeXML(w, http.StatusOK, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Bucket   string
+		Key      string
+		UploadId string
+	}{Bucket: bucketName, Key: key, UploadId: id})
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, uploadID string) {
+	number, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || number < 1 || number > 10000 {
+		writeError(w, r, http.StatusBadRequest, "InvalidArgument", "invalid part number")
+		return
+	}
+	data, err := readBody(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	u := s.uploads[uploadID]
+	if u == nil {
+		writeError(w, r, http.StatusNotFound, "NoSuchUpload", "the upload does not exist")
+		return
+	}
+	u.parts[number] = data
+	sum := md5.Sum(data)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+type completeRequest struct {
+	Parts []struct {
+		PartNumber int
+		ETag       string
+	} `xml:"Part"`
+}
+
+func (s *Server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, bucketName, key, uploadID string) {
+	var req completeRequest
+	body, err := readBody(r)
+	if err == nil {
+		err = xml.Unmarshal(body, &req)
+	}
+	if err != nil || len(req.Parts) == 0 {
+		writeError(w, r, http.StatusBadRequest, "MalformedXML", "invalid CompleteMultipartUpload request")
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	u := s.uploads[uploadID]
+	if u == nil || u.bucket != bucketName || u.key != key {
+		writeError(w, r, http.StatusNotFound, "NoSuchUpload", "the upload does not exist")
+		return
+	}
+	b := s.buckets[bucketName]
+	if b == nil {
+		writeError(w, r, http.StatusNotFound, "NoSuchBucket", "the bucket does not exist")
+		return
+	}
+	if !checkConditions(w, r, latest(b, key)) {
+		return
+	}
+
+	var data, sums []byte
+	for i, part := range req.Parts {
+		if i > 0 && part.PartNumber <= req.Parts[i-1].PartNumber {
+			writeError(w, r, http.StatusBadRequest, "InvalidPartOrder", "parts must be listed in ascending order")
+			return
+		}
+		partData, ok := u.parts[part.PartNumber]
+		sum := md5.Sum(partData)
+		if !ok || strings.Trim(part.ETag, `"`) != hex.EncodeToString(sum[:]) {
+			writeError(w, r, http.StatusBadRequest, "InvalidPart", fmt.Sprintf("part %d was not uploaded", part.PartNumber))
+			return
+		}
+		if i < len(req.Parts)-1 && len(partData) < MinPartSize {
+			writeError(w, r, http.StatusBadRequest, "EntityTooSmall", fmt.Sprintf("part %d is smaller than the minimum allowed size", part.PartNumber))
+			return
+		}
+		data = append(data, partData...)
+		sums = append(sums, sum[:]...)
+	}
+
+	sum := md5.Sum(sums)
+	obj := s.store(b, key, data, fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sum[:]), len(req.Parts)))
+	obj.setHeaders(u.header)
+	delete(s.uploads, uploadID)
+	if b.versioning {
+		w.Header().Set("x-amz-version-id", obj.VersionID)
+	}
+	writeXML(w, http.StatusOK, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket  string
+		Key     string
+		ETag    string
+	}{Bucket: bucketName, Key: key, ETag: obj.ETag})
+}
+
+func (s *Server) abortMultipartUpload(w http.ResponseWriter, r *http.Request, uploadID string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.uploads[uploadID] == nil {
+		writeError(w, r, http.StatusNotFound, "NoSuchUpload", "the upload does not exist")
+		return
+	}
+	delete(s.uploads, uploadID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readBody reads the body of a request, decoding the aws-chunked encoding used
+// by streaming signatures.
+func readBody(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") &&
+		!strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") {
+		return ioutil.ReadAll(r.Body)
+	}
+
+	var data []byte
+	body := bufio.NewReader(r.Body)
+	for {
+		line, err := body.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		// the size is followed by ";chunk-signature=..." when signed
+		sizeHex := strings.TrimSpace(strings.SplitN(line, ";", 2)[0])
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunk size %q", sizeHex)
+		}
+		if size == 0 {
+			// trailers are ignored
+			return data, nil
+		}
+		chunk := make([]byte, size+2)
+		if _, err = io.ReadFull(body, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk[:size]...)
+	}
+}
+
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string
+	Message   string
+	Resource  string
+	RequestId string
+}
+
+// writeError writes an S3 error response. HEAD responses have no body.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	w.Header().Set("x-amz-request-id", "s3fake")
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	writeXML(w, status, errorResponse{
+		Code:      code,
+		Message:   message,
+		Resource:  r.URL.Path,
+		RequestId: "s3fake",
+	})
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Length", strconv.Itoa(len(xml.Header)+len(data)))
+	w.WriteHeader(status)
+	io.WriteString(w, xml.Header)
+	w.Write(data)
+}
@@ -0,0 +1,195 @@
+package s3fake
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+func statusOf(err error) int {
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.HTTPStatusCode()
+	}
+	return 0
+}
+
+func TestRangeAndConditions(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	obj := srv.PutObject("bucket", "key", []byte("0123456789"))
+	client := srv.ClientV2()
+	ctx := context.Background()
+
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:  aws.String("bucket"),
+		Key:     aws.String("key"),
+		Range:   aws.String("bytes=2-4"),
+		IfMatch: aws.String(obj.ETag),
+	})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	data, _ := ioutil.ReadAll(out.Body)
+	out.Body.Close()
+	if string(data) != "234" || aws.ToString(out.ContentRange) != "bytes 2-4/10" {
+		t.Errorf("expected bytes 2-4 but got %q (%s)", data, aws.ToString(out.ContentRange))
+	}
+
+	_, err = client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:  aws.String("bucket"),
+		Key:     aws.String("key"),
+		IfMatch: aws.String(`"other"`),
+	})
+	if statusOf(err) != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 but got %v", err)
+	}
+
+	_, err = client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("key"),
+		Range:  aws.String("bytes=10-"),
+	})
+	if statusOf(err) != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("expected 416 but got %v", err)
+	}
+
+	_, err = client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("missing")})
+	var noSuchKey *types.NoSuchKey
+	if !errors.As(err, &noSuchKey) {
+		t.Errorf("expected NoSuchKey but got %v", err)
+	}
+}
+
+func TestVersioning(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.EnableVersioning("bucket")
+	first := srv.PutObject("bucket", "key", []byte("first"))
+	srv.PutObject("bucket", "key", []byte("second"))
+	client := srv.ClientV2()
+	ctx := context.Background()
+
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:    aws.String("bucket"),
+		Key:       aws.String("key"),
+		VersionId: aws.String(first.VersionID),
+	})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	data, _ := ioutil.ReadAll(out.Body)
+	out.Body.Close()
+	if string(data) != "first" || aws.ToString(out.VersionId) != first.VersionID {
+		t.Errorf("expected the first version but got %q (%s)", data, aws.ToString(out.VersionId))
+	}
+
+	if _, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key")}); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if _, ok := srv.GetObject("bucket", "key"); ok {
+		t.Error("expected the key to be deleted")
+	}
+	_, err = client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:    aws.String("bucket"),
+		Key:       aws.String("key"),
+		VersionId: aws.String(first.VersionID),
+	})
+	if err != nil {
+		t.Errorf("expected the first version to be kept but got %q", err.Error())
+	}
+}
+
+func TestMultipart(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.CreateBucket("bucket")
+	client := srv.ClientV2()
+	ctx := context.Background()
+
+	create, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Bucket: aws.String("bucket"), Key: aws.String("key")})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	var parts []types.CompletedPart
+	for i, size := range []int{MinPartSize, 10} {
+		out, err := client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String("bucket"),
+			Key:        aws.String("key"),
+			UploadId:   create.UploadId,
+			PartNumber: aws.Int32(int32(i + 1)),
+			Body:       bytes.NewReader(make([]byte, size)),
+		})
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		parts = append(parts, types.CompletedPart{ETag: out.ETag, PartNumber: aws.Int32(int32(i + 1))})
+	}
+	if srv.Uploads() != 1 {
+		t.Errorf("expected 1 upload in progress but got %d", srv.Uploads())
+	}
+
+	// the order of the parts matters
+	_, err = client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String("bucket"),
+		Key:             aws.String("key"),
+		UploadId:        create.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: []types.CompletedPart{parts[1], parts[0]}},
+	})
+	if statusOf(err) != http.StatusBadRequest {
+		t.Errorf("expected 400 but got %v", err)
+	}
+
+	out, err := client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String("bucket"),
+		Key:             aws.String("key"),
+		UploadId:        create.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	obj, ok := srv.GetObject("bucket", "key")
+	if !ok || len(obj.Data) != MinPartSize+10 || obj.ETag != aws.ToString(out.ETag) {
+		t.Errorf("expected the parts to be assembled but got %v", obj)
+	}
+	if srv.Uploads() != 0 {
+		t.Errorf("expected no upload in progress but got %d", srv.Uploads())
+	}
+}
+
+func TestFaults(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.PutObject("bucket", "key", make([]byte, 1000))
+	client := srv.ClientV2()
+	ctx := context.Background()
+
+	// the client retries throttled requests
+	srv.SetFault(Throttle(2))
+	if _, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key")}); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if srv.Requests() != 3 {
+		t.Errorf("expected 3 requests but got %d", srv.Requests())
+	}
+
+	srv.SetFault(DropConnection(1, 100))
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key")})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	data, err := ioutil.ReadAll(out.Body)
+	out.Body.Close()
+	if err == nil || len(data) != 100 {
+		t.Errorf("expected the body to be cut after 100 bytes but got %d bytes and %v", len(data), err)
+	}
+}
@@ -0,0 +1,120 @@
+package s3v2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/xitongsys/parquet-go-source/abort"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"github.com/xitongsys/parquet-go-source/footer"
+	"github.com/xitongsys/parquet-go-source/s3fake"
+	"github.com/xitongsys/parquet-go-source/sourcetest"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+func TestConformance(t *testing.T) {
+	srv := s3fake.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("bucket")
+	client := srv.ClientV2()
+	ctx := context.Background()
+
+	for _, minRequestSize := range []int{0, 1000} {
+		for _, footerCache := range []*footer.Cache{nil, footer.NewCache(1000, 0)} {
+			name := fmt.Sprintf("MinRequestSize=%d/FooterCache=%t", minRequestSize, footerCache != nil)
+			minRequestSize, footerCache := minRequestSize, footerCache
+			t.Run(name, func(t *testing.T) {
+				sourcetest.RunConformance(t, sourcetest.Factory{
+					Open: func(name string) (source.ParquetFile, error) {
+						return NewS3FileReaderWithParams(ctx, S3FileReaderParams{
+							Bucket:         "bucket",
+							Key:            name,
+							S3Client:       client,
+							MinRequestSize: minRequestSize,
+							FooterCache:    footerCache,
+						})
+					},
+					Create: func(name string) (source.ParquetFile, error) {
+						return NewS3FileWriterWithClient(ctx, client, "bucket", name, nil)
+					},
+				})
+			})
+		}
+	}
+}
+
+func TestObjectChanged(t *testing.T) {
+	srv := s3fake.NewServer()
+	defer srv.Close()
+	first := srv.PutObject("bucket", "key", []byte("first version"))
+	ctx := context.Background()
+
+	r, err := NewS3FileReaderWithParams(ctx, S3FileReaderParams{
+		Bucket:         "bucket",
+		Key:            "key",
+		S3Client:       srv.ClientV2(),
+		MinRequestSize: 4,
+	})
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	clone, err := r.Open("")
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	b := make([]byte, 4)
+	if _, err = r.Read(b); err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+
+	srv.PutObject("bucket", "key", []byte("second version"))
+
+	for _, pf := range []source.ParquetFile{r, clone} {
+		_, err = pf.Read(b)
+		if !errors.Is(err, sourceerrors.ErrObjectChanged) {
+			t.Fatalf("expected ErrObjectChanged but got %v", err)
+		}
+		var changed *sourceerrors.ObjectChangedError
+		if !errors.As(err, &changed) || changed.Version != first.ETag {
+			t.Errorf("expected ObjectChangedError for the opened version but got %v", err)
+		}
+	}
+}
+
+func TestAbort(t *testing.T) {
+	srv := s3fake.NewServer()
+	defer srv.Close()
+	srv.CreateBucket("bucket")
+	client := srv.ClientV2()
+	ctx := context.Background()
+
+	// a single part, and a multipart upload with parts already sent
+	for _, size := range []int64{10, manager.MinUploadPartSize + 10} {
+		w, err := NewS3FileWriterWithClient(ctx, client, "bucket", "key", nil)
+		if err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		if _, err = w.Write(make([]byte, size)); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+
+		cause := errors.New("job failed")
+		if err = w.(abort.Aborter).Abort(cause); err != nil {
+			t.Fatalf("expected error to be nil but got %q", err.Error())
+		}
+		if _, err = w.Write([]byte("more")); !errors.Is(err, cause) {
+			t.Errorf("expected writes after Abort to fail with the cause but got %v", err)
+		}
+		if err = w.Close(); !errors.Is(err, cause) {
+			t.Errorf("expected Close after Abort to fail with the cause but got %v", err)
+		}
+
+		if _, ok := srv.GetObject("bucket", "key"); ok || srv.Uploads() != 0 {
+			t.Errorf("size %d: expected nothing to be published but got %d uploads", size, srv.Uploads())
+		}
+	}
+}
@@ -7,12 +7,19 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
+	"net"
+	"net/http"
 	"sync"
+	"syscall"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/xitongsys/parquet-go-source/abort"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"github.com/xitongsys/parquet-go-source/footer"
 	"github.com/xitongsys/parquet-go/source"
 )
 
@@ -47,6 +54,10 @@ type S3File struct {
 	fileSize       int64
 	socket         io.ReadCloser
 	minRequestSize int64
+	maxReadRetries int
+	etag           string
+	footerCache    *footer.Cache
+	footer         *footer.Tail
 
 	lock       sync.RWMutex
 	err        error
@@ -59,6 +70,7 @@ const (
 	rangeHeader           = "bytes=%d-%d"
 	rangeHeaderSuffix     = "bytes=%d"
 	defaultMinRequestSize = math.MaxUint32
+	defaultMaxReadRetries = 3
 )
 
 var (
@@ -145,7 +157,8 @@ func NewS3FileReaderWithClientVersioned(ctx context.Context, s3Client S3API, buc
 	})
 }
 
-// Seek tracks the offset for the next Read. Has no effect on Write.
+// Seek tracks the offset for the next Read. Has no effect on Write. Once the
+// file size is known offsets are absolute, and seeking past the end is allowed.
 func (s *S3File) Seek(offset int64, whence int) (int64, error) {
 	if whence < io.SeekStart || whence > io.SeekEnd {
 		return 0, errWhence
@@ -153,22 +166,15 @@ func (s *S3File) Seek(offset int64, whence int) (int64, error) {
 
 	if s.fileSize > 0 {
 		switch whence {
-		case io.SeekStart:
-			if offset < 0 || offset > s.fileSize {
-				return 0, errInvalidOffset
-			}
 		case io.SeekCurrent:
 			offset += s.offset
-			if offset < 0 || offset > s.fileSize {
-				return 0, errInvalidOffset
-			}
 		case io.SeekEnd:
-			if offset == 0 {
-				offset = s.fileSize
-			} else if offset > 0 || -offset > s.fileSize {
-				return 0, errInvalidOffset
-			}
+			offset += s.fileSize
+		}
+		if offset < 0 {
+			return 0, errInvalidOffset
 		}
+		whence = io.SeekStart
 	}
 
 	s.offset = offset
@@ -178,36 +184,88 @@ func (s *S3File) Seek(offset int64, whence int) (int64, error) {
 	return s.offset, nil
 }
 
-// Read up to len(p) bytes into p and return the number of bytes read
+// Read up to len(p) bytes into p and return the number of bytes read. p is
+// filled completely unless the end of the file is reached.
 func (s *S3File) Read(p []byte) (n int, err error) {
 	if s.fileSize > 0 && s.offset >= s.fileSize {
 		return 0, io.EOF
 	}
 
+	if n, ok := s.footer.ReadAt(p, s.offset); ok {
+		s.closeSocket()
+		s.offset += int64(n)
+		return n, nil
+	}
+
 	defer func() {
 		if err != nil {
 			s.closeSocket()
 		}
 	}()
 
-	if s.socket == nil {
-		err = s.openSocket(int64(len(p)))
-		if err != nil {
-			return 0, err
+	retries := 0
+	for n < len(p) {
+		opened := false
+		if s.socket == nil {
+			err = s.openSocket(int64(len(p) - n))
+			if err != nil {
+				return n, err
+			}
+			opened = true
 		}
-	}
-	n, err = s.socket.Read(p)
-	// Because the chunk size is not infinite, we might hit the end of the socket while
-	// there's still data in the file. In this case, we close the socket so that the next
-	// read call will request a new one, and we return a nil error so that the caller
-	// will not think the file is done.
-	if err == io.EOF {
+
+		var bytesRead int
+		bytesRead, err = io.ReadFull(s.socket, p[n:])
+		n += bytesRead
+		s.offset += int64(bytesRead)
+		if err == nil {
+			break
+		}
+		if err != io.EOF && err != io.ErrUnexpectedEOF {
+			if bytesRead > 0 {
+				retries = 0
+			}
+			if !s.canResume(err) || retries >= s.maxReadRetries {
+				return n, s.wrapError(err)
+			}
+			// the connection failed, request the rest from the current offset
+			retries++
+			err = nil
+			s.closeSocket()
+			continue
+		}
+
+		// Because the chunk size is not infinite, we might hit the end of the socket while
+		// there's still data in the file. In this case, we close the socket so that the next
+		// iteration will request a new one, and we return a nil error so that the caller
+		// will not think the file is done.
 		err = nil
 		s.closeSocket()
+		if s.fileSize > 0 && s.offset >= s.fileSize {
+			break
+		}
+		// a new socket without data, or an unknown file size, means we are done
+		if (opened && bytesRead == 0) || (s.fileSize < 1 && bytesRead > 0) {
+			break
+		}
 	}
-	s.offset += int64(n)
 
-	return n, err
+	if n == 0 && len(p) > 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// canResume reports whether a failure reading a response body can be recovered
+// from by requesting the rest of the object again, e.g. after a reset connection.
+// Resumed requests are pinned to the version or ETag seen when the object was
+// opened, so they never return bytes of another object.
+func (s *S3File) canResume(err error) bool {
+	if s.fileSize < 1 || (s.ctx != nil && s.ctx.Err() != nil) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
 }
 
 // openSocket issues a new GetObject request to retrieve the next chunk of data from the
@@ -222,18 +280,36 @@ func (s *S3File) openSocket(numBytes int64) error {
 		Key:       aws.String(s.Key),
 		VersionId: s.version,
 	}
+	if s.etag != "" {
+		getObj.IfMatch = aws.String(s.etag)
+	}
 	if len(getObjRange) > 0 {
 		getObj.Range = aws.String(getObjRange)
 	}
 
 	out, err := s.client.GetObject(s.ctx, getObj)
 	if err != nil {
-		return err
+		return s.wrapError(err)
 	}
 	s.socket = out.Body
 	return nil
 }
 
+// wrapError returns an ObjectChangedError if err reports that the object no
+// longer matches the ETag seen when it was opened, and otherwise annotates err
+// with its kind from sourceerrors.
+func (s *S3File) wrapError(err error) error {
+	var respErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusPreconditionFailed && s.etag != "" {
+		return &sourceerrors.ObjectChangedError{
+			Name:    s.BucketName + "/" + s.Key,
+			Version: s.etag,
+			Err:     err,
+		}
+	}
+	return sourceerrors.Classify(err)
+}
+
 func (s *S3File) closeSocket() {
 	if s.socket != nil {
 		s.socket.Close()
@@ -245,16 +321,13 @@ func (s *S3File) closeSocket() {
 func (s *S3File) Write(p []byte) (n int, err error) {
 	s.lock.RLock()
 	writeOpened := s.writeOpened
-	s.lock.RUnlock()
-	if !writeOpened {
-		s.openWrite()
-	}
-
-	s.lock.RLock()
 	writeError := s.err
 	s.lock.RUnlock()
 	if writeError != nil {
-		return 0, writeError
+		return 0, s.wrapError(writeError)
+	}
+	if !writeOpened {
+		s.openWrite()
 	}
 
 	// prevent further writes upon error
@@ -265,7 +338,7 @@ func (s *S3File) Write(p []byte) (n int, err error) {
 		s.lock.Unlock()
 
 		s.pipeWriter.CloseWithError(err)
-		return 0, writeError
+		return 0, s.wrapError(writeError)
 	}
 
 	return bytesWritten, nil
@@ -280,7 +353,7 @@ func (s *S3File) Close() error {
 
 	if s.pipeWriter != nil {
 		if err = s.pipeWriter.Close(); err != nil {
-			return err
+			return s.wrapError(err)
 		}
 	}
 
@@ -288,12 +361,79 @@ func (s *S3File) Close() error {
 	if s.writeDone != nil {
 		err = <-s.writeDone
 	}
+	if err == nil {
+		// Abort, or a failed Write, already waited for the upload
+		s.lock.RLock()
+		err = s.err
+		s.lock.RUnlock()
+	}
 
-	return err
+	return s.wrapError(err)
+}
+
+// Abort discards the data written so far instead of publishing it. The upload
+// fails with err as the cause of its next read, upon which the uploader aborts
+// the multipart upload, and Abort waits for it to finish. Close then returns
+// err. Abort has no effect once Close has returned.
+func (s *S3File) Abort(err error) error {
+	err = abort.Cause(err)
+
+	// prevent further writes, and make Close report the cause
+	s.lock.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.lock.Unlock()
+
+	if s.pipeWriter == nil {
+		return nil
+	}
+	s.pipeWriter.CloseWithError(err)
+	if s.writeDone != nil {
+		<-s.writeDone
+	}
+	return nil
+}
+
+// Identity names the object and the version being read, e.g. for use as a
+// cache key. It is empty until the object is opened for reading.
+func (s *S3File) Identity() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	switch {
+	case s.version != nil:
+		return fmt.Sprintf("s3://%s/%s?versionId=%s", s.BucketName, s.Key, *s.version)
+	case s.etag != "":
+		return fmt.Sprintf("s3://%s/%s#%s", s.BucketName, s.Key, s.etag)
+	}
+	return ""
 }
 
 // Open creates a new S3 File instance to perform concurrent reads
 func (s *S3File) Open(name string) (source.ParquetFile, error) {
+	// ColumBuffer passes in an empty string for name
+	if len(name) == 0 {
+		name = s.Key
+	}
+
+	// a different object needs its own size and footer
+	if name != s.Key {
+		pf := &S3File{
+			ctx:            s.ctx,
+			client:         s.client,
+			BucketName:     s.BucketName,
+			Key:            name,
+			minRequestSize: s.minRequestSize,
+			maxReadRetries: s.maxReadRetries,
+			footerCache:    s.footerCache,
+		}
+		if err := pf.openRead(); err != nil {
+			return nil, err
+		}
+		return pf, nil
+	}
+
 	s.lock.RLock()
 	readOpened := s.readOpened
 	s.lock.RUnlock()
@@ -303,11 +443,6 @@ func (s *S3File) Open(name string) (source.ParquetFile, error) {
 		}
 	}
 
-	// ColumBuffer passes in an empty string for name
-	if len(name) == 0 {
-		name = s.Key
-	}
-
 	// create a new instance
 	pf := &S3File{
 		ctx:            s.ctx,
@@ -318,6 +453,10 @@ func (s *S3File) Open(name string) (source.ParquetFile, error) {
 		readOpened:     s.readOpened,
 		fileSize:       s.fileSize,
 		minRequestSize: s.minRequestSize,
+		maxReadRetries: s.maxReadRetries,
+		etag:           s.etag,
+		footerCache:    s.footerCache,
+		footer:         s.footer,
 		offset:         0,
 	}
 	return pf, nil
@@ -366,8 +505,11 @@ func (s *S3File) openWrite() {
 		// upload data and signal done when complete
 		_, err := uploader.Upload(s.ctx, params)
 		if err != nil {
+			// keep the cause given to Abort
 			s.lock.Lock()
-			s.err = err
+			if s.err == nil {
+				s.err = err
+			}
 			s.lock.Unlock()
 
 			if s.writeOpened {
@@ -390,7 +532,7 @@ func (s *S3File) openRead() error {
 
 	hoo, err := s.client.HeadObject(s.ctx, hoi)
 	if err != nil {
-		return err
+		return s.wrapError(err)
 	}
 
 	s.lock.Lock()
@@ -398,11 +540,62 @@ func (s *S3File) openRead() error {
 	if hoo.ContentLength != nil && *hoo.ContentLength != 0 {
 		s.fileSize = *hoo.ContentLength
 	}
+	if hoo.ETag != nil {
+		s.etag = *hoo.ETag
+	}
+	size, etag := s.fileSize, s.etag
 	s.lock.Unlock()
 
+	// the footer is fetched without the lock, which would block Close and Abort
+	tail, err := s.loadFooter(size, etag)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.footer = tail
+	s.lock.Unlock()
 	return nil
 }
 
+// loadFooter fetches the end of the object of the given size and ETag through
+// the footer cache, if one is configured.
+func (s *S3File) loadFooter(size int64, etag string) (*footer.Tail, error) {
+	if s.footerCache == nil || size < 1 {
+		return nil, nil
+	}
+
+	version := etag
+	if s.version != nil {
+		version = *s.version + "/" + etag
+	}
+	return s.footerCache.Get(footer.Key{
+		Backend: "s3",
+		Name:    s.BucketName + "/" + s.Key,
+		Version: version,
+		Size:    size,
+	}, s.fetchRange)
+}
+
+// fetchRange reads length bytes at offset with a single GetObject request.
+func (s *S3File) fetchRange(offset, length int64) ([]byte, error) {
+	getObj := &s3.GetObjectInput{
+		Bucket:    aws.String(s.BucketName),
+		Key:       aws.String(s.Key),
+		VersionId: s.version,
+		Range:     aws.String(fmt.Sprintf(rangeHeader, offset, offset+length-1)),
+	}
+	if s.etag != "" {
+		getObj.IfMatch = aws.String(s.etag)
+	}
+	out, err := s.client.GetObject(s.ctx, getObj)
+	if err != nil {
+		return nil, s.wrapError(err)
+	}
+	defer out.Body.Close()
+
+	return ioutil.ReadAll(out.Body)
+}
+
 // getBytesRange returns the range request header string
 func (s *S3File) getBytesRange(numBytes int64) string {
 	var (
@@ -466,6 +659,14 @@ type S3FileReaderParams struct {
 	// S3File will not buffer a large amount of data in memory at one time, regardless
 	// of the value of MinRequestSize.
 	MinRequestSize int
+	// MaxReadRetries is the number of times in a row a read resumes the object from
+	// the current offset after the connection failed part way through a response.
+	// Defaults to 3, a negative value disables resuming. Optional.
+	MaxReadRetries int
+	// FooterCache, if set, makes the S3File fetch the end of the object in a single
+	// request when it is opened and serve the parquet footer from memory, sharing it
+	// with all readers created through Open. Optional.
+	FooterCache *footer.Cache
 }
 
 // NewS3FileReaderWithParams creates an S3 FileReader for an object identified by and
@@ -481,6 +682,11 @@ func NewS3FileReaderWithParams(ctx context.Context, params S3FileReaderParams) (
 		minRequestSize = defaultMinRequestSize
 	}
 
+	maxReadRetries := params.MaxReadRetries
+	if maxReadRetries == 0 {
+		maxReadRetries = defaultMaxReadRetries
+	}
+
 	file := &S3File{
 		ctx:            ctx,
 		client:         s3Client,
@@ -488,6 +694,8 @@ func NewS3FileReaderWithParams(ctx context.Context, params S3FileReaderParams) (
 		Key:            params.Key,
 		version:        params.Version,
 		minRequestSize: minRequestSize,
+		maxReadRetries: maxReadRetries,
+		footerCache:    params.FooterCache,
 	}
 
 	return file.Open(params.Key)
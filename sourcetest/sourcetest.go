@@ -0,0 +1,578 @@
+// Package sourcetest provides a conformance suite for source.ParquetFile
+// implementations. Every backend of this module runs it against an in-process
+// fake of its storage, so that code written against one backend behaves the
+// same way on the others:
+//
+//   - Seek accepts io.SeekStart, io.SeekCurrent and io.SeekEnd, returns the
+//     new absolute offset, rejects negative offsets and allows seeking past
+//     the end of the file.
+//   - Read fills the whole buffer unless the end of the file is reached. The
+//     final, possibly short, read returns a nil error and io.EOF is only
+//     returned together with zero bytes.
+//   - Open("") returns an independent reader positioned at the start of the
+//     same object, and is safe to call concurrently.
+//   - Data written through Create/Write is readable once Close returns.
+//   - Opening an object that does not exist fails with an error matching
+//     sourceerrors.ErrNotFound.
+package sourcetest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Factory gives the conformance suite access to one backend.
+type Factory struct {
+	// Open returns a reader for the object called name. Required.
+	Open func(name string) (source.ParquetFile, error)
+	// Create returns a writer for the object called name. Optional for read-only
+	// backends, in which case Put must be set.
+	Create func(name string) (source.ParquetFile, error)
+	// Put stores data as the object called name, bypassing the backend. If nil,
+	// objects are written through Create.
+	Put func(name string, data []byte) error
+	// Path maps the object names used by the suite to names understood by the
+	// backend, e.g. paths below a temporary directory. Optional.
+	Path func(name string) string
+	// SingleObject is set for backends whose Open and Create methods ignore
+	// their name argument and always address the object they were built for.
+	SingleObject bool
+}
+
+// fileSize is the size of the objects used by the byte-level tests. It is not
+// a multiple of any of the buffer sizes used below on purpose.
+const fileSize = 10007
+
+var errNoWriter = errors.New("sourcetest: factory has neither Put nor Create")
+
+// RunConformance runs the conformance suite against the backend described by
+// factory.
+func RunConformance(t *testing.T, factory Factory) {
+	c := &conformance{factory: factory}
+
+	t.Run("Seek", c.testSeek)
+	t.Run("SeekPastEOF", c.testSeekPastEOF)
+	t.Run("Read", c.testRead)
+	t.Run("ReadAfterSeek", c.testReadAfterSeek)
+	t.Run("Open", c.testOpen)
+	t.Run("OpenName", c.testOpenName)
+	t.Run("OpenMissing", c.testOpenMissing)
+	t.Run("ConcurrentOpen", c.testConcurrentOpen)
+	t.Run("Write", c.testWrite)
+	t.Run("Create", c.testCreate)
+	t.Run("ParquetRoundTrip", c.testParquetRoundTrip)
+}
+
+type conformance struct {
+	factory Factory
+}
+
+// testData returns fileSize bytes of deterministic, non-repeating content.
+func testData(seed byte) []byte {
+	data := make([]byte, fileSize)
+	for i := range data {
+		data[i] = byte(i*7+i/251) ^ seed
+	}
+	return data
+}
+
+func (c *conformance) path(name string) string {
+	if c.factory.Path == nil {
+		return name
+	}
+	return c.factory.Path(name)
+}
+
+// put stores data under name through Put, or through Create if Put is unset.
+func (c *conformance) put(t *testing.T, name string, data []byte) {
+	t.Helper()
+
+	var err error
+	switch {
+	case c.factory.Put != nil:
+		err = c.factory.Put(c.path(name), data)
+	case c.factory.Create != nil:
+		err = c.write(c.path(name), data)
+	default:
+		err = errNoWriter
+	}
+	if err != nil {
+		t.Fatalf("failed to store %s: %v", name, err)
+	}
+}
+
+func (c *conformance) write(name string, data []byte) error {
+	w, err := c.factory.Create(name)
+	if err != nil {
+		return err
+	}
+	if err = writeAll(w, data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// writeAll writes data in uneven chunks, as parquet-go does.
+func writeAll(w io.Writer, data []byte) error {
+	for chunk := 1; len(data) > 0; chunk *= 3 {
+		if chunk > len(data) {
+			chunk = len(data)
+		}
+		n, err := w.Write(data[:chunk])
+		if err != nil {
+			return err
+		}
+		if n != chunk {
+			return fmt.Errorf("short write: %d of %d bytes", n, chunk)
+		}
+		data = data[chunk:]
+	}
+	return nil
+}
+
+func (c *conformance) open(t *testing.T, name string) source.ParquetFile {
+	t.Helper()
+
+	r, err := c.factory.Open(c.path(name))
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", name, err)
+	}
+	return r
+}
+
+// readFull reads len(p) bytes from r, checking that Read never returns a
+// short read together with a nil error before the end of the file.
+func readFull(t *testing.T, r io.Reader, p []byte, remaining int) {
+	t.Helper()
+
+	n, err := r.Read(p)
+	want := len(p)
+	if remaining < want {
+		want = remaining
+	}
+	if n != want {
+		t.Fatalf("expected Read to return %d bytes but got %d (err: %v)", want, n, err)
+	}
+	if err != nil {
+		t.Fatalf("expected Read to return a nil error but got %v", err)
+	}
+}
+
+func expectEOF(t *testing.T, r io.Reader) {
+	t.Helper()
+
+	n, err := r.Read(make([]byte, 16))
+	if n != 0 || err != io.EOF {
+		t.Fatalf("expected Read to return 0, io.EOF but got %d, %v", n, err)
+	}
+}
+
+func expectOffset(t *testing.T, s io.Seeker, offset int64, whence int, expected int64) {
+	t.Helper()
+
+	got, err := s.Seek(offset, whence)
+	if err != nil {
+		t.Fatalf("Seek(%d, %d): expected error to be nil but got %v", offset, whence, err)
+	}
+	if got != expected {
+		t.Fatalf("Seek(%d, %d): expected offset %d but got %d", offset, whence, expected, got)
+	}
+}
+
+func (c *conformance) testSeek(t *testing.T) {
+	c.put(t, "seek", testData(1))
+	r := c.open(t, "seek")
+	defer r.Close()
+
+	expectOffset(t, r, 0, io.SeekEnd, fileSize)
+	expectOffset(t, r, -8, io.SeekEnd, fileSize-8)
+	expectOffset(t, r, -2, io.SeekCurrent, fileSize-10)
+	expectOffset(t, r, 5, io.SeekCurrent, fileSize-5)
+	expectOffset(t, r, 100, io.SeekStart, 100)
+	expectOffset(t, r, 0, io.SeekCurrent, 100)
+	expectOffset(t, r, 0, io.SeekStart, 0)
+	expectOffset(t, r, fileSize, io.SeekStart, fileSize)
+
+	if _, err := r.Seek(-1, io.SeekStart); err == nil {
+		t.Error("expected error seeking to a negative offset but got nil")
+	}
+	if _, err := r.Seek(-fileSize-1, io.SeekEnd); err == nil {
+		t.Error("expected error seeking before the start of the file but got nil")
+	}
+	if _, err := r.Seek(0, io.SeekEnd+1); err == nil {
+		t.Error("expected error for invalid whence but got nil")
+	}
+}
+
+func (c *conformance) testSeekPastEOF(t *testing.T) {
+	c.put(t, "seek-past-eof", testData(2))
+	r := c.open(t, "seek-past-eof")
+	defer r.Close()
+
+	expectOffset(t, r, fileSize+10, io.SeekStart, fileSize+10)
+	expectEOF(t, r)
+
+	expectOffset(t, r, 10, io.SeekEnd, fileSize+10)
+	expectEOF(t, r)
+
+	expectOffset(t, r, fileSize, io.SeekStart, fileSize)
+	expectEOF(t, r)
+}
+
+func (c *conformance) testRead(t *testing.T) {
+	data := testData(3)
+	c.put(t, "read", data)
+	r := c.open(t, "read")
+	defer r.Close()
+
+	for _, size := range []int{1, 7, 100, 4096} {
+		expectOffset(t, r, 0, io.SeekStart, 0)
+
+		var got []byte
+		buf := make([]byte, size)
+		for len(got) < fileSize {
+			readFull(t, r, buf, fileSize-len(got))
+			got = append(got, buf[:min(size, fileSize-len(got))]...)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("reading with a %d byte buffer returned different data", size)
+		}
+		expectEOF(t, r)
+	}
+
+	// a buffer larger than the file
+	expectOffset(t, r, 0, io.SeekStart, 0)
+	buf := make([]byte, fileSize+100)
+	readFull(t, r, buf, fileSize)
+	if !bytes.Equal(buf[:fileSize], data) {
+		t.Fatal("reading the whole file returned different data")
+	}
+	expectEOF(t, r)
+}
+
+func (c *conformance) testReadAfterSeek(t *testing.T) {
+	data := testData(4)
+	c.put(t, "read-after-seek", data)
+	r := c.open(t, "read-after-seek")
+	defer r.Close()
+
+	// the access pattern of parquet-go: footer length, footer, then chunks
+	type read struct {
+		offset int64
+		whence int
+		size   int
+	}
+	reads := []read{
+		{-8, io.SeekEnd, 4},
+		{-1000, io.SeekEnd, 992},
+		{4, io.SeekStart, 3000},
+		{-100, io.SeekCurrent, 50},
+		{5000, io.SeekStart, 5007},
+		{fileSize - 3, io.SeekStart, 3},
+	}
+	for _, rd := range reads {
+		pos, err := r.Seek(rd.offset, rd.whence)
+		if err != nil {
+			t.Fatalf("Seek(%d, %d): expected error to be nil but got %v", rd.offset, rd.whence, err)
+		}
+		if pos < 0 || pos > fileSize {
+			t.Fatalf("Seek(%d, %d): returned offset %d outside of the file", rd.offset, rd.whence, pos)
+		}
+
+		buf := make([]byte, rd.size)
+		readFull(t, r, buf, fileSize-int(pos))
+		if !bytes.Equal(buf, data[pos:pos+int64(rd.size)]) {
+			t.Fatalf("read of %d bytes at offset %d returned different data", rd.size, pos)
+		}
+	}
+}
+
+func (c *conformance) testOpen(t *testing.T) {
+	data := testData(5)
+	c.put(t, "open", data)
+	r := c.open(t, "open")
+	defer r.Close()
+
+	expectOffset(t, r, 100, io.SeekStart, 100)
+
+	clone, err := r.Open("")
+	if err != nil {
+		t.Fatalf("Open(\"\"): expected error to be nil but got %v", err)
+	}
+	defer clone.Close()
+
+	buf := make([]byte, fileSize)
+	readFull(t, clone, buf, fileSize)
+	if !bytes.Equal(buf, data) {
+		t.Fatal("clone returned different data")
+	}
+
+	// the original reader is not affected by the clone
+	buf = make([]byte, 10)
+	readFull(t, r, buf, fileSize-100)
+	if !bytes.Equal(buf, data[100:110]) {
+		t.Fatal("reading from the original after Open returned different data")
+	}
+
+	if err = clone.Close(); err != nil {
+		t.Fatalf("expected Close to return nil but got %v", err)
+	}
+	if err = r.Close(); err != nil {
+		t.Fatalf("expected Close to return nil but got %v", err)
+	}
+}
+
+func (c *conformance) testOpenName(t *testing.T) {
+	if c.factory.SingleObject {
+		t.Skip("backend addresses a single object")
+	}
+
+	first, second := testData(6), testData(7)
+	c.put(t, "open-name-1", first)
+	c.put(t, "open-name-2", second)
+	r := c.open(t, "open-name-1")
+	defer r.Close()
+
+	other, err := r.Open(c.path("open-name-2"))
+	if err != nil {
+		t.Fatalf("Open: expected error to be nil but got %v", err)
+	}
+	defer other.Close()
+
+	buf := make([]byte, fileSize)
+	readFull(t, other, buf, fileSize)
+	if !bytes.Equal(buf, second) {
+		t.Fatal("Open(name) did not return the named object")
+	}
+}
+
+// testOpenMissing is skipped for single object backends that do not look at
+// their storage before the first read.
+func (c *conformance) testOpenMissing(t *testing.T) {
+	r, err := c.factory.Open(c.path("open-missing"))
+	if err == nil && c.factory.SingleObject {
+		r.Close()
+		t.Skip("backend addresses a single object")
+	}
+	if !errors.Is(err, sourceerrors.ErrNotFound) {
+		t.Fatalf("expected an error matching ErrNotFound but got %v", err)
+	}
+}
+
+func (c *conformance) testConcurrentOpen(t *testing.T) {
+	const readers = 8
+
+	data := testData(8)
+	c.put(t, "concurrent-open", data)
+	r := c.open(t, "concurrent-open")
+	defer r.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, readers)
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			clone, err := r.Open("")
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer clone.Close()
+
+			// each reader reads its own section of the file
+			offset := int64(i * fileSize / readers)
+			if _, err = clone.Seek(offset, io.SeekStart); err != nil {
+				errs <- err
+				return
+			}
+			buf := make([]byte, fileSize/readers)
+			if _, err = io.ReadFull(clone, buf); err != nil {
+				errs <- err
+				return
+			}
+			if !bytes.Equal(buf, data[offset:offset+int64(len(buf))]) {
+				errs <- fmt.Errorf("reader %d returned different data", i)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func (c *conformance) testWrite(t *testing.T) {
+	if c.factory.Create == nil {
+		t.Skip("backend is read-only")
+	}
+
+	data := testData(9)
+	if err := c.write(c.path("write"), data); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	r := c.open(t, "write")
+	defer r.Close()
+
+	buf := make([]byte, fileSize)
+	readFull(t, r, buf, fileSize)
+	if !bytes.Equal(buf, data) {
+		t.Fatal("reading back a written file returned different data")
+	}
+	expectEOF(t, r)
+}
+
+func (c *conformance) testCreate(t *testing.T) {
+	if c.factory.Create == nil {
+		t.Skip("backend is read-only")
+	}
+	if c.factory.SingleObject {
+		t.Skip("backend addresses a single object")
+	}
+
+	w, err := c.factory.Create(c.path("create-1"))
+	if err != nil {
+		t.Fatalf("Create: expected error to be nil but got %v", err)
+	}
+	if err = writeAll(w, testData(10)); err != nil {
+		t.Fatalf("Write: expected error to be nil but got %v", err)
+	}
+
+	// Create on an existing writer addresses a new, independent object
+	w2, err := w.Create(c.path("create-2"))
+	if err != nil {
+		t.Fatalf("Create: expected error to be nil but got %v", err)
+	}
+	data := testData(11)
+	if err = writeAll(w2, data); err != nil {
+		t.Fatalf("Write: expected error to be nil but got %v", err)
+	}
+	if err = w2.Close(); err != nil {
+		t.Fatalf("Close: expected error to be nil but got %v", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close: expected error to be nil but got %v", err)
+	}
+
+	r := c.open(t, "create-2")
+	defer r.Close()
+
+	buf := make([]byte, fileSize)
+	readFull(t, r, buf, fileSize)
+	if !bytes.Equal(buf, data) {
+		t.Fatal("Create(name) did not write the named object")
+	}
+}
+
+type record struct {
+	ID    int64   `parquet:"name=id, type=INT64"`
+	Name  string  `parquet:"name=name, type=UTF8"`
+	Score float64 `parquet:"name=score, type=DOUBLE"`
+	Flag  bool    `parquet:"name=flag, type=BOOLEAN"`
+}
+
+// memFile collects the output of parquet-go's writer for read-only backends.
+type memFile struct {
+	bytes.Buffer
+}
+
+func (f *memFile) Create(string) (source.ParquetFile, error) { return nil, errNoWriter }
+func (f *memFile) Open(string) (source.ParquetFile, error)   { return nil, errNoWriter }
+func (f *memFile) Seek(int64, int) (int64, error)            { return 0, errNoWriter }
+func (f *memFile) Close() error                              { return nil }
+
+func writeParquet(w source.ParquetFile, rows []record) error {
+	pw, err := writer.NewParquetWriter(w, new(record), 2)
+	if err != nil {
+		return err
+	}
+	// small row groups and pages so the reader has several chunks to fetch
+	pw.RowGroupSize = 16 * 1024
+	pw.PageSize = 1024
+	for i := range rows {
+		if err = pw.Write(rows[i]); err != nil {
+			return err
+		}
+	}
+	return pw.WriteStop()
+}
+
+func (c *conformance) testParquetRoundTrip(t *testing.T) {
+	const numRows = 5000
+
+	rows := make([]record, numRows)
+	for i := range rows {
+		rows[i] = record{
+			ID:    int64(i),
+			Name:  fmt.Sprintf("name-%d", i),
+			Score: float64(i) / 3,
+			Flag:  i%3 == 0,
+		}
+	}
+
+	name := c.path("round-trip.parquet")
+	if c.factory.Create != nil {
+		w, err := c.factory.Create(name)
+		if err != nil {
+			t.Fatalf("Create: expected error to be nil but got %v", err)
+		}
+		if err = writeParquet(w, rows); err != nil {
+			t.Fatalf("failed to write parquet file: %v", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("Close: expected error to be nil but got %v", err)
+		}
+	} else {
+		f := &memFile{}
+		if err := writeParquet(f, rows); err != nil {
+			t.Fatalf("failed to write parquet file: %v", err)
+		}
+		c.put(t, "round-trip.parquet", f.Bytes())
+	}
+
+	r := c.open(t, "round-trip.parquet")
+	defer r.Close()
+
+	pr, err := reader.NewParquetReader(r, new(record), 4)
+	if err != nil {
+		t.Fatalf("failed to open parquet file: %v", err)
+	}
+	defer pr.ReadStop()
+
+	if n := pr.GetNumRows(); n != numRows {
+		t.Fatalf("expected %d rows but got %d", numRows, n)
+	}
+	got := make([]record, numRows)
+	if err = pr.Read(&got); err != nil {
+		t.Fatalf("failed to read rows: %v", err)
+	}
+	if len(got) != numRows {
+		t.Fatalf("expected to read %d rows but got %d", numRows, len(got))
+	}
+	for i := range rows {
+		if got[i] != rows[i] {
+			t.Fatalf("row %d: expected %+v but got %+v", i, rows[i], got[i])
+		}
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
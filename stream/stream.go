@@ -0,0 +1,102 @@
+// Package stream reads remote objects sequentially through ranged responses.
+//
+// parquet-go reads a column chunk with many small reads. Remote backends open
+// one response for at least MinRequestSize bytes and keep reading it while the
+// reads continue where the previous one ended, so a large MinRequestSize saves
+// requests without buffering data in memory.
+package stream
+
+import (
+	"io"
+	"math"
+)
+
+// DefaultMinRequestSize is used when MinRequestSize is not set, so that each
+// response covers the rest of the object.
+const DefaultMinRequestSize int64 = math.MaxUint32
+
+// OpenFunc opens a response for length bytes of the object from offset.
+type OpenFunc func(offset, length int64) (io.ReadCloser, error)
+
+// Reader keeps a response open across sequential reads. The zero value
+// requests the rest of the object.
+type Reader struct {
+	// MinRequestSize is the minimum number of bytes requested at a time.
+	// Defaults to DefaultMinRequestSize if less than 1.
+	MinRequestSize int64
+
+	body io.ReadCloser
+	// offset is the position of the next byte of body in the object
+	offset int64
+}
+
+// Read fills p from offset of an object of size bytes unless its end is
+// reached, opening responses with open as needed. Responses may return short
+// reads, so they are read until p is full. Read returns io.EOF if nothing is
+// left to read. Other errors, of open or of a response, are returned
+// unchanged for the backend to annotate.
+func (r *Reader) Read(p []byte, offset, size int64, open OpenFunc) (n int, err error) {
+	if r.body != nil && r.offset != offset {
+		r.Close()
+	}
+
+	for n < len(p) && offset < size {
+		opened := false
+		if r.body == nil {
+			if r.body, err = open(offset, r.length(int64(len(p)-n), size-offset)); err != nil {
+				r.body = nil
+				return n, err
+			}
+			r.offset = offset
+			opened = true
+		}
+
+		var bytesRead int
+		bytesRead, err = io.ReadFull(r.body, p[n:])
+		n += bytesRead
+		offset += int64(bytesRead)
+		r.offset = offset
+		if err == nil {
+			break
+		}
+		r.Close()
+		if err != io.EOF && err != io.ErrUnexpectedEOF {
+			return n, err
+		}
+		// the response ended, the next iteration requests the rest of p
+		err = nil
+		if opened && bytesRead == 0 {
+			// the object is shorter than its size claimed
+			break
+		}
+	}
+
+	if n == 0 && len(p) > 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// length returns the number of bytes to request for a read of want bytes,
+// with remaining bytes left in the object.
+func (r *Reader) length(want, remaining int64) int64 {
+	minRequestSize := r.MinRequestSize
+	if minRequestSize < 1 {
+		minRequestSize = DefaultMinRequestSize
+	}
+	if want < minRequestSize {
+		want = minRequestSize
+	}
+	if want > remaining {
+		want = remaining
+	}
+	return want
+}
+
+// Close closes the response being read, if any.
+func (r *Reader) Close() {
+	if r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+}
@@ -0,0 +1,135 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+)
+
+// opener serves ranges of data and counts the responses it opened.
+type opener struct {
+	data  []byte
+	opens int
+	// err, if set, is returned by open
+	err error
+}
+
+func (o *opener) open(offset, length int64) (io.ReadCloser, error) {
+	if o.err != nil {
+		return nil, o.err
+	}
+	o.opens++
+	end := offset + length
+	if end > int64(len(o.data)) {
+		end = int64(len(o.data))
+	}
+	// responses return short reads
+	return ioutil.NopCloser(iotest.HalfReader(bytes.NewReader(o.data[offset:end]))), nil
+}
+
+func TestReadSequential(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+
+	tests := []struct {
+		minRequestSize int64
+		opens          int
+	}{
+		{0, 1},
+		{-1, 1},
+		{100, 10},
+		{1, 100},
+	}
+	for _, test := range tests {
+		o := &opener{data: data}
+		r := Reader{MinRequestSize: test.minRequestSize}
+		var got []byte
+		var offset int64
+		for {
+			p := make([]byte, 10)
+			n, err := r.Read(p, offset, int64(len(data)), o.open)
+			offset += int64(n)
+			got = append(got, p[:n]...)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("expected error to be nil but got %q", err.Error())
+			}
+			if n != len(p) {
+				t.Fatalf("MinRequestSize %d: expected p to be filled but got %d bytes", test.minRequestSize, n)
+			}
+		}
+		r.Close()
+		if !bytes.Equal(got, data) {
+			t.Errorf("MinRequestSize %d: expected to read the data", test.minRequestSize)
+		}
+		if o.opens != test.opens {
+			t.Errorf("MinRequestSize %d: expected %d responses but got %d", test.minRequestSize, test.opens, o.opens)
+		}
+	}
+}
+
+func TestReadAcrossResponses(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	o := &opener{data: data}
+	r := Reader{MinRequestSize: 100}
+	size := int64(len(data))
+
+	p := make([]byte, 250)
+	if n, _ := r.Read(p[:50], 0, size, o.open); n != 50 || o.opens != 1 {
+		t.Fatalf("expected 50 bytes from one response but got %d from %d", n, o.opens)
+	}
+	// the response is kept for the next sequential read
+	if n, _ := r.Read(p[:10], 50, size, o.open); n != 10 || o.opens != 1 {
+		t.Errorf("expected the response to be kept but got %d responses", o.opens)
+	}
+	// reads longer than the rest of the response continue in a new one
+	n, err := r.Read(p, 60, size, o.open)
+	if err != nil {
+		t.Fatalf("expected error to be nil but got %q", err.Error())
+	}
+	if n != len(p) || !bytes.Equal(p, data[60:310]) || o.opens != 2 {
+		t.Errorf("expected 250 bytes from two responses but got %d from %d", n, o.opens)
+	}
+	// reads elsewhere replace the response
+	if n, _ = r.Read(p[:10], 500, size, o.open); n != 10 || !bytes.Equal(p[:10], data[500:510]) || o.opens != 3 {
+		t.Errorf("expected a new response for another offset but got %d responses", o.opens)
+	}
+}
+
+func TestReadEnd(t *testing.T) {
+	o := &opener{data: []byte("0123456789")}
+	var r Reader
+
+	p := make([]byte, 20)
+	n, err := r.Read(p, 5, 10, o.open)
+	if n != 5 || err != nil {
+		t.Errorf("expected 5 bytes up to the end but got %d and %v", n, err)
+	}
+	if _, err = r.Read(p, 10, 10, o.open); err != io.EOF {
+		t.Errorf("expected io.EOF at the end but got %v", err)
+	}
+
+	// an object shorter than its size ends the read
+	short := &opener{data: []byte("01234")}
+	n, err = r.Read(p, 0, 10, short.open)
+	if n != 5 || err != nil {
+		t.Errorf("expected the 5 bytes of the object but got %d and %v", n, err)
+	}
+	if _, err = r.Read(p, 5, 10, short.open); err != io.EOF {
+		t.Errorf("expected io.EOF past the data but got %v", err)
+	}
+}
+
+func TestReadOpenError(t *testing.T) {
+	errOpen := errors.New("open failed")
+	o := &opener{err: errOpen}
+	var r Reader
+
+	if n, err := r.Read(make([]byte, 10), 0, 10, o.open); n != 0 || err != errOpen {
+		t.Errorf("expected the error of open to be returned unchanged but got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package swiftsource
+
+import (
+	"testing"
+
+	"github.com/ncw/swift"
+	"github.com/ncw/swift/swifttest"
+	"github.com/xitongsys/parquet-go-source/sourcetest"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+func TestConformance(t *testing.T) {
+	srv, err := swifttest.NewSwiftServer("localhost")
+	if err != nil {
+		t.Fatalf("failed to start swift server: %v", err)
+	}
+	defer srv.Close()
+
+	conn := &swift.Connection{
+		UserName: swifttest.TEST_ACCOUNT,
+		ApiKey:   swifttest.TEST_ACCOUNT,
+		AuthUrl:  srv.AuthURL,
+	}
+	if err = conn.Authenticate(); err != nil {
+		t.Fatalf("failed to authenticate: %v", err)
+	}
+	if err = conn.ContainerCreate("container", nil); err != nil {
+		t.Fatalf("failed to create container: %v", err)
+	}
+
+	sourcetest.RunConformance(t, sourcetest.Factory{
+		Open: func(name string) (source.ParquetFile, error) {
+			return NewSwiftFileReader("container", name, conn)
+		},
+		Create: func(name string) (source.ParquetFile, error) {
+			return NewSwiftFileWriter("container", name, conn)
+		},
+	})
+}
@@ -1,7 +1,11 @@
 package swiftsource
 
 import (
+	"errors"
+	"io"
+
 	"github.com/ncw/swift"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
 	"github.com/xitongsys/parquet-go/source"
 )
 
@@ -13,8 +17,15 @@ type SwiftFile struct {
 
 	FileReader *swift.ObjectOpenFile
 	FileWriter *swift.ObjectCreateFile
+
+	offset int64
 }
 
+var (
+	errWhence        = errors.New("Seek: invalid whence")
+	errInvalidOffset = errors.New("Seek: invalid offset")
+)
+
 func newSwiftFile(containerName string, filePath string, conn *swift.Connection) *SwiftFile {
 	return &SwiftFile{
 		Connection: conn,
@@ -40,7 +51,7 @@ func (file *SwiftFile) Open(name string) (source.ParquetFile, error) {
 
 	fr, _, err := file.Connection.ObjectOpen(file.Container, name, false, nil)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 
 	res := &SwiftFile{
@@ -60,7 +71,7 @@ func (file *SwiftFile) Create(name string) (source.ParquetFile, error) {
 
 	fw, err := file.Connection.ObjectCreate(file.Container, name, false, "", "", nil)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 
 	res := &SwiftFile{
@@ -73,28 +84,90 @@ func (file *SwiftFile) Create(name string) (source.ParquetFile, error) {
 	return res, nil
 }
 
-func (file *SwiftFile) Read(b []byte) (n int, err error) {
-	return file.FileReader.Read(b)
+func (file *SwiftFile) Read(b []byte) (cnt int, err error) {
+	size, err := file.FileReader.Length()
+	if err != nil {
+		return 0, wrapError(err)
+	}
+	if file.offset >= size {
+		return 0, io.EOF
+	}
+
+	var n int
+	for cnt < len(b) {
+		n, err = file.FileReader.Read(b[cnt:])
+		cnt += n
+		if err != nil {
+			break
+		}
+	}
+	file.offset += int64(cnt)
+	// io.EOF is only reported once no data is left
+	if err == io.EOF && cnt > 0 {
+		err = nil
+	}
+	return cnt, wrapError(err)
 }
 
+// Seek validates the offset itself, as swift.ObjectOpenFile panics on an
+// unknown whence and re-opens the object with a Range header that the server
+// rejects when seeking past the end.
 func (file *SwiftFile) Seek(offset int64, whence int) (int64, error) {
-	return file.FileReader.Seek(offset, whence)
+	size, err := file.FileReader.Length()
+	if err != nil {
+		return 0, err
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += file.offset
+	case io.SeekEnd:
+		offset += size
+	default:
+		return 0, errWhence
+	}
+
+	if offset < 0 {
+		return 0, errInvalidOffset
+	}
+
+	file.offset = offset
+	if offset >= size {
+		// Read reports io.EOF without touching the reader
+		return offset, nil
+	}
+	if _, err = file.FileReader.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return offset, nil
 }
 
 func (file *SwiftFile) Write(p []byte) (n int, err error) {
-	return file.FileWriter.Write(p)
+	n, err = file.FileWriter.Write(p)
+	return n, wrapError(err)
 }
 
 func (file *SwiftFile) Close() error {
 	if file.FileWriter != nil {
 		if err := file.FileWriter.Close(); err != nil {
-			return err
+			return wrapError(err)
 		}
 	}
 	if file.FileReader != nil {
 		if err := file.FileReader.Close(); err != nil {
-			return err
+			return wrapError(err)
 		}
 	}
 	return nil
 }
+
+// wrapError annotates errors of the swift client with their kind from
+// sourceerrors.
+func wrapError(err error) error {
+	var swiftErr *swift.Error
+	if errors.As(err, &swiftErr) {
+		return sourceerrors.Wrap(sourceerrors.KindOfStatus(swiftErr.StatusCode), err)
+	}
+	return sourceerrors.Classify(err)
+}
@@ -0,0 +1,31 @@
+package writerfile
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/buffer"
+	sourceerrors "github.com/xitongsys/parquet-go-source/errors"
+	"github.com/xitongsys/parquet-go-source/sourcetest"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// WriterFile cannot be read back, so the written bytes are served by a
+// BufferFile and only the write side is exercised here.
+func TestConformance(t *testing.T) {
+	files := map[string]*bytes.Buffer{}
+	sourcetest.RunConformance(t, sourcetest.Factory{
+		Open: func(name string) (source.ParquetFile, error) {
+			written, ok := files[name]
+			if !ok {
+				return nil, sourceerrors.ErrNotFound
+			}
+			return buffer.NewBufferFileFromBytes(written.Bytes()), nil
+		},
+		Create: func(name string) (source.ParquetFile, error) {
+			files[name] = &bytes.Buffer{}
+			return NewWriterFile(files[name]), nil
+		},
+		SingleObject: true,
+	})
+}